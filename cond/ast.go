@@ -0,0 +1,466 @@
+package cond
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"strings"
+)
+
+// 语法树节点类型
+const (
+	NodeSection = "section"
+	NodeAnd     = "and"
+	NodeOr      = "or"
+	NodeNot     = "not"
+	NodePass    = "pass"
+	NodeUnary   = "unary"
+	NodeFunc    = "func"
+)
+
+var (
+	opToken = map[op]string{
+		Eq:     "eq",
+		Re:     "re",
+		Cn:     "cn",
+		In:     "in",
+		Lt:     "lt",
+		Le:     "le",
+		Ge:     "ge",
+		Gt:     "gt",
+		Call:   "->",
+		Regex:  "~",
+		Cidr:   "cidr",
+		Prefix: "prefix",
+		Suffix: "suffix",
+		Len:    "len",
+		Before: "before",
+		After:  "after",
+		Within: "within",
+	}
+
+	//支持忽略大小写的运算符 eg: ieq , icn
+	opFold = map[op]bool{
+		Eq:     true,
+		Re:     true,
+		Cn:     true,
+		In:     true,
+		Prefix: true,
+		Suffix: true,
+	}
+)
+
+// SectionAST 条件的语法树
+// {"type":"section","keys":["name"],"op":"eq","values":["vela"]}
+// {"type":"or","nodes":[{"type":"section",...},{"type":"not","nodes":[...]}]}
+type SectionAST struct {
+	Type   string        `json:"type"`
+	Keys   []string      `json:"keys,omitempty"`
+	Op     string        `json:"op,omitempty"`
+	Not    bool          `json:"not,omitempty"`
+	ICase  bool          `json:"icase,omitempty"`
+	Values []string      `json:"values,omitempty"`
+	Nodes  []*SectionAST `json:"nodes,omitempty"`
+	Raw    string        `json:"raw,omitempty"`
+}
+
+// CondAST 条件组的语法树 logic: and , or
+type CondAST struct {
+	Logic    string        `json:"logic"`
+	Sections []*SectionAST `json:"sections"`
+}
+
+func lookupOp(token string) (op, bool) {
+	for method, text := range opToken {
+		if text == token {
+			return method, false
+		}
+
+		if opFold[method] && "i"+text == token {
+			return method, true
+		}
+	}
+	return Oop, false
+}
+
+func (s *Section) token() string {
+	text := opToken[s.method]
+	if s.iCase && opFold[s.method] {
+		text = "i" + text
+	}
+
+	if s.not {
+		return "!" + text
+	}
+	return text
+}
+
+// String 规范化的条件文本 eg: name,addr !eq a,b
+func (s *Section) String() string {
+	switch s.method {
+	case Pass:
+		return "*"
+	case Tree:
+		if s.expr == nil {
+			return s.raw
+		}
+		return s.expr.String()
+	case Unary:
+		if len(s.keys) == 0 {
+			return s.raw
+		}
+		if s.not {
+			return "!" + s.keys[0]
+		}
+		return s.keys[0]
+	case Fn, Oop:
+		return s.raw
+	}
+
+	if _, ok := opToken[s.method]; !ok || len(s.keys) == 0 {
+		return s.raw
+	}
+
+	return strings.Join(s.keys, ",") + " " + s.token() + " " + strings.Join(s.data, ",")
+}
+
+// String 按优先级 or < and < not 输出 必要时加括号
+func (e *Expr) String() string {
+	switch e.kind {
+	case ExprSection:
+		return e.sec.String()
+	case ExprNot:
+		node := e.nodes[0]
+		if node.kind == ExprAnd || node.kind == ExprOr {
+			return "not (" + node.String() + ")"
+		}
+		return "not " + node.String()
+	}
+
+	sep := " and "
+	if e.kind == ExprOr {
+		sep = " or "
+	}
+
+	var buf strings.Builder
+	for i, node := range e.nodes {
+		if i != 0 {
+			buf.WriteString(sep)
+		}
+
+		if e.kind == ExprAnd && node.kind == ExprOr {
+			buf.WriteString("(" + node.String() + ")")
+			continue
+		}
+		buf.WriteString(node.String())
+	}
+	return buf.String()
+}
+
+func (e *Expr) AST() *SectionAST {
+	if e.kind == ExprSection {
+		return e.sec.AST()
+	}
+
+	node := &SectionAST{Type: e.kind.String()}
+	for _, sub := range e.nodes {
+		node.Nodes = append(node.Nodes, sub.AST())
+	}
+	return node
+}
+
+func (s *Section) AST() *SectionAST {
+	switch s.method {
+	case Pass:
+		return &SectionAST{Type: NodePass}
+	case Tree:
+		if s.expr != nil {
+			return s.expr.AST()
+		}
+	case Unary:
+		if len(s.keys) > 0 {
+			return &SectionAST{Type: NodeUnary, Keys: s.keys, Not: s.not}
+		}
+	case Fn:
+		return &SectionAST{Type: NodeFunc, Raw: s.raw}
+	}
+
+	return &SectionAST{
+		Type:   NodeSection,
+		Keys:   s.keys,
+		Op:     opToken[s.method],
+		Not:    s.not,
+		ICase:  s.iCase && opFold[s.method],
+		Values: s.data,
+	}
+}
+
+func (s *Section) MarshalJSON() ([]byte, error) {
+	if !s.Ok() {
+		return nil, fmt.Errorf("%s %v", s.raw, s.err)
+	}
+
+	if s.method == Oop {
+		return nil, fmt.Errorf("%s unknown operator", s.raw)
+	}
+
+	return json.Marshal(s.AST())
+}
+
+func (s *Section) UnmarshalJSON(data []byte) error {
+	var node SectionAST
+	if err := json.Unmarshal(data, &node); err != nil {
+		return err
+	}
+
+	sec, err := NewSectionAST(&node)
+	if err != nil {
+		return err
+	}
+	*s = *sec
+	return nil
+}
+
+func (node *SectionAST) expr() (*Expr, error) {
+	switch node.Type {
+	case NodeAnd, NodeOr:
+		if len(node.Nodes) == 0 {
+			return nil, fmt.Errorf("%s without nodes", node.Type)
+		}
+
+		e := &Expr{kind: ExprAnd}
+		if node.Type == NodeOr {
+			e.kind = ExprOr
+		}
+
+		for _, item := range node.Nodes {
+			sub, err := item.expr()
+			if err != nil {
+				return nil, err
+			}
+			e.nodes = append(e.nodes, sub)
+		}
+		return e, nil
+
+	case NodeNot:
+		if len(node.Nodes) != 1 {
+			return nil, fmt.Errorf("not want 1 node got %d", len(node.Nodes))
+		}
+
+		sub, err := node.Nodes[0].expr()
+		if err != nil {
+			return nil, err
+		}
+		return &Expr{kind: ExprNot, nodes: []*Expr{sub}}, nil
+	}
+
+	sec, err := node.section()
+	if err != nil {
+		return nil, err
+	}
+	return &Expr{kind: ExprSection, sec: sec}, nil
+}
+
+func (node *SectionAST) section() (*Section, error) {
+	s := &Section{
+		not:       node.Not,
+		partition: -1,
+	}
+
+	switch node.Type {
+	case NodePass:
+		s.method = Pass
+		s.raw = "*"
+		return s, nil
+
+	case NodeUnary:
+		if len(node.Keys) != 1 {
+			return nil, fmt.Errorf("unary want 1 key got %d", len(node.Keys))
+		}
+		s.method = Unary
+		s.keys = []string{node.Keys[0]}
+		s.data = []string{""}
+		s.raw = s.String()
+		return s, nil
+
+	case NodeFunc:
+		return nil, fmt.Errorf("func section %s not support unmarshal", node.Raw)
+
+	case NodeSection:
+	default:
+		return nil, fmt.Errorf("unknown node type %s", node.Type)
+	}
+
+	method, fold := lookupOp(node.Op)
+	if method == Oop {
+		return nil, fmt.Errorf("unknown operator %q", node.Op)
+	}
+
+	if len(node.Keys) == 0 {
+		return nil, fmt.Errorf("%s not found keys", node.Op)
+	}
+
+	s.method = method
+	s.iCase = fold || (node.ICase && opFold[method])
+	s.keys = append(s.keys, node.Keys...)
+	s.data = append(s.data, node.Values...)
+	s.raw = s.String()
+	s.opAt = len(strings.Join(s.keys, ",")) + 1
+	s.valAt = s.opAt + len(s.token()) + 1
+	s.build()
+	if !s.Ok() {
+		return nil, fmt.Errorf("%s %v", s.raw, s.err)
+	}
+	return s, nil
+}
+
+// NewSectionAST 根据语法树构建条件 不再经过文本解析
+func NewSectionAST(node *SectionAST) (*Section, error) {
+	if node == nil {
+		return nil, fmt.Errorf("empty section node")
+	}
+
+	switch node.Type {
+	case NodeAnd, NodeOr, NodeNot:
+		e, err := node.expr()
+		if err != nil {
+			return nil, err
+		}
+
+		return &Section{
+			raw:       e.String(),
+			method:    Tree,
+			expr:      e,
+			partition: -1,
+		}, nil
+	}
+
+	return node.section()
+}
+
+// String 原始条件文本 逗号分隔
+func (cnd *Cond) String() string {
+	n := cnd.Len()
+	if n == 0 {
+		return ""
+	}
+
+	var buf bytes.Buffer
+	for i := 0; i < n; i++ {
+		if i != 0 {
+			buf.WriteByte(',')
+		}
+		buf.WriteString(cnd.data[i].raw)
+	}
+	return buf.String()
+}
+
+// Canonical 规范化的条件组文本 可以通过 NewText 重新编译
+func (cnd *Cond) Canonical() string {
+	n := cnd.Len()
+	if n == 0 {
+		return ""
+	}
+
+	sep := " and "
+	if cnd.Logic() == OR {
+		sep = " or "
+	}
+
+	var buf strings.Builder
+	for i := 0; i < n; i++ {
+		s := cnd.data[i]
+		if i != 0 {
+			buf.WriteString(sep)
+		}
+
+		if n > 1 && s.method == Tree && s.expr != nil && s.expr.kind != ExprSection && s.expr.kind != ExprNot {
+			buf.WriteString("(" + s.String() + ")")
+			continue
+		}
+		buf.WriteString(s.String())
+	}
+	return buf.String()
+}
+
+func (cnd *Cond) AST() *CondAST {
+	node := &CondAST{
+		Logic:    cnd.Logic().Text(),
+		Sections: make([]*SectionAST, 0, len(cnd.data)),
+	}
+
+	for _, s := range cnd.data {
+		node.Sections = append(node.Sections, s.AST())
+	}
+	return node
+}
+
+func (cnd *Cond) MarshalJSON() ([]byte, error) {
+	for _, s := range cnd.data {
+		if !s.Ok() {
+			return nil, fmt.Errorf("%s %v", s.raw, s.err)
+		}
+	}
+	return json.Marshal(cnd.AST())
+}
+
+func (cnd *Cond) UnmarshalJSON(data []byte) error {
+	var node CondAST
+	if err := json.Unmarshal(data, &node); err != nil {
+		return err
+	}
+
+	v, err := NewCondAST(&node)
+	if err != nil {
+		return err
+	}
+	*cnd = *v
+	return nil
+}
+
+// NewCondAST 根据语法树构建条件组
+func NewCondAST(node *CondAST) (*Cond, error) {
+	cnd := New()
+	switch node.Logic {
+	case "", "and":
+	case "or":
+		cnd.logic.set(OR)
+	default:
+		return nil, fmt.Errorf("unknown logic %s", node.Logic)
+	}
+
+	for i, item := range node.Sections {
+		s, err := NewSectionAST(item)
+		if err != nil {
+			return nil, fmt.Errorf("section %d %v", i, err)
+		}
+		cnd.append(s)
+	}
+	return cnd, nil
+}
+
+func (iv *Combine) MarshalJSON() ([]byte, error) {
+	return json.Marshal([]*Cond(*iv))
+}
+
+func (iv *Combine) UnmarshalJSON(data []byte) error {
+	var v []*Cond
+	if err := json.Unmarshal(data, &v); err != nil {
+		return err
+	}
+	*iv = v
+	return nil
+}
+
+func (iv *Ignore) MarshalJSON() ([]byte, error) {
+	return json.Marshal([]*Cond(*iv))
+}
+
+func (iv *Ignore) UnmarshalJSON(data []byte) error {
+	var v []*Cond
+	if err := json.Unmarshal(data, &v); err != nil {
+		return err
+	}
+	*iv = v
+	return nil
+}
@@ -0,0 +1,322 @@
+package cond
+
+import (
+	"container/list"
+	"fmt"
+	"github.com/vela-public/onekit/cast"
+	"github.com/vela-public/onekit/layer"
+	"github.com/vela-public/onekit/lua"
+	"net/url"
+	"strings"
+	"sync"
+	"time"
+)
+
+const (
+	CallTTL   = 30 * time.Second
+	CallCache = 4096
+)
+
+// Resolver -> 运算的查询函数 value:键值 args:目标参数
+type Resolver func(value string, args url.Values) (any, error)
+
+// Answer 查询结果 Have:是否命中 Field:结果字段
+type Answer struct {
+	Have  bool
+	Field Lookup
+}
+
+func (a Answer) Get(key string) string {
+	if a.Field == nil {
+		return ""
+	}
+	return a.Field(key)
+}
+
+type callEntry struct {
+	key    string
+	answer Answer
+	expire time.Time
+}
+
+// Provider 查询结果按 LRU 缓存 超过 size 时淘汰最久未使用的一条
+type Provider struct {
+	name    string
+	ttl     time.Duration
+	size    int
+	resolve Resolver
+	mutex   sync.Mutex
+	cache   map[string]*list.Element
+	recent  *list.List //*callEntry 最近使用的在前
+}
+
+func (p *Provider) Name() string {
+	return p.name
+}
+
+func (p *Provider) TTL(d time.Duration) {
+	p.ttl = d
+}
+
+func (p *Provider) Size(n int) {
+	p.size = n
+}
+
+func (p *Provider) Purge() {
+	p.mutex.Lock()
+	p.cache = nil
+	p.recent = nil
+	p.mutex.Unlock()
+}
+
+// cacheKey 相同 value 不同参数的查询结果不同
+func cacheKey(value string, args url.Values) string {
+	if len(args) == 0 {
+		return value
+	}
+	return value + "?" + args.Encode()
+}
+
+func (p *Provider) load(key string, now time.Time) (Answer, bool) {
+	if p.ttl <= 0 {
+		return Answer{}, false
+	}
+
+	p.mutex.Lock()
+	defer p.mutex.Unlock()
+
+	elem, ok := p.cache[key]
+	if !ok {
+		return Answer{}, false
+	}
+
+	entry := elem.Value.(*callEntry)
+	if now.After(entry.expire) {
+		p.recent.Remove(elem)
+		delete(p.cache, key)
+		return Answer{}, false
+	}
+
+	p.recent.MoveToFront(elem)
+	return entry.answer, true
+}
+
+func (p *Provider) store(key string, answer Answer, now time.Time) {
+	if p.ttl <= 0 {
+		return
+	}
+
+	p.mutex.Lock()
+	defer p.mutex.Unlock()
+
+	if p.cache == nil {
+		p.cache = make(map[string]*list.Element)
+		p.recent = list.New()
+	}
+
+	if elem, ok := p.cache[key]; ok {
+		entry := elem.Value.(*callEntry)
+		entry.answer = answer
+		entry.expire = now.Add(p.ttl)
+		p.recent.MoveToFront(elem)
+		return
+	}
+
+	p.cache[key] = p.recent.PushFront(&callEntry{key: key, answer: answer, expire: now.Add(p.ttl)})
+	for p.size > 0 && p.recent.Len() > p.size {
+		oldest := p.recent.Back()
+		p.recent.Remove(oldest)
+		delete(p.cache, oldest.Value.(*callEntry).key)
+	}
+}
+
+func (p *Provider) Lookup(value string, args url.Values) (Answer, error) {
+	now := time.Now()
+	key := cacheKey(value, args)
+	if answer, ok := p.load(key, now); ok {
+		return answer, nil
+	}
+
+	if p.resolve == nil {
+		return Answer{}, fmt.Errorf("provider %s not found resolver", p.name)
+	}
+
+	v, err := p.resolve(value, args)
+	if err != nil {
+		return Answer{}, err
+	}
+
+	answer := NewAnswer(v)
+	p.store(key, answer, now)
+	return answer, nil
+}
+
+func NewAnswer(v any) Answer {
+	switch item := v.(type) {
+	case nil:
+		return Answer{}
+	case Answer:
+		return item
+	case bool:
+		return Answer{Have: item}
+	case string:
+		return Answer{Have: item != "", Field: String(item)}
+	case lua.LValue:
+		switch item.Type() {
+		case lua.LTNil:
+			return Answer{}
+		case lua.LTBool:
+			return Answer{Have: lua.IsTrue(item)}
+		}
+	}
+
+	ov := &option{}
+	if !ov.NewPeek(v) {
+		return Answer{Have: true, Field: String(cast.ToString(v))}
+	}
+	return Answer{Have: true, Field: ov.field}
+}
+
+func NewProvider(name string, fn Resolver) *Provider {
+	return &Provider{
+		name:    name,
+		ttl:     CallTTL,
+		size:    CallCache,
+		resolve: fn,
+	}
+}
+
+var providers = struct {
+	mutex sync.RWMutex
+	data  map[string]*Provider
+}{data: make(map[string]*Provider)}
+
+// Register 注册 -> 运算的查询提供者 eg: key -> /risk/ip?have
+func Register(name string, fn Resolver, options ...func(*Provider)) *Provider {
+	p := NewProvider(name, fn)
+	for _, option := range options {
+		option(p)
+	}
+
+	providers.mutex.Lock()
+	providers.data[name] = p
+	providers.mutex.Unlock()
+	return p
+}
+
+func Unregister(name string) {
+	providers.mutex.Lock()
+	delete(providers.data, name)
+	providers.mutex.Unlock()
+}
+
+func TTL(d time.Duration) func(*Provider) {
+	return func(p *Provider) {
+		p.ttl = d
+	}
+}
+
+// TransportResolver 通过layer.Transport 查询 {"value": value, "args": args} => json
+// args 是缓存键的一部分 同一个 value 不同参数的查询由服务端区分
+func TransportResolver(path string, tr layer.Transport) Resolver {
+	return func(value string, args url.Values) (any, error) {
+		var reply map[string]any
+		if args == nil {
+			args = url.Values{}
+		}
+		err := tr.JSON(path, map[string]any{"value": value, "args": args}, &reply)
+		if err != nil {
+			return nil, err
+		}
+
+		if len(reply) == 0 {
+			return nil, nil
+		}
+		return reply, nil
+	}
+}
+
+func LookupProvider(name string) (*Provider, bool) {
+	providers.mutex.RLock()
+	p, ok := providers.data[name]
+	providers.mutex.RUnlock()
+	if ok {
+		return p, true
+	}
+
+	if !strings.HasPrefix(name, "/") || !layer.Ready() {
+		return nil, false
+	}
+
+	tr := layer.LazyEnv().Transport()
+	if tr == nil {
+		return nil, false
+	}
+
+	return Register(name, TransportResolver(name, tr)), true
+}
+
+type callTarget struct {
+	raw  string
+	name string
+	args url.Values
+}
+
+func (ct *callTarget) Match(answer Answer) bool {
+	if len(ct.args) == 0 {
+		return answer.Have
+	}
+
+	for key, values := range ct.args {
+		switch key {
+		case "have":
+			if !answer.Have {
+				return false
+			}
+			continue
+		case "!have":
+			if answer.Have {
+				return false
+			}
+			continue
+		}
+
+		if !answer.Have {
+			return false
+		}
+
+		val := answer.Get(key)
+		hit := false
+		for _, want := range values {
+			if val == want {
+				hit = true
+				break
+			}
+		}
+
+		if !hit {
+			return false
+		}
+	}
+	return true
+}
+
+func newCallTarget(raw string) (*callTarget, error) {
+	ct := &callTarget{raw: raw}
+	name, query, _ := strings.Cut(strings.TrimSpace(raw), "?")
+	if name == "" {
+		return nil, fmt.Errorf("call target %s not found provider", raw)
+	}
+	ct.name = name
+
+	if query == "" {
+		return ct, nil
+	}
+
+	args, err := url.ParseQuery(query)
+	if err != nil {
+		return nil, fmt.Errorf("call target %s parse fail %v", raw, err)
+	}
+	ct.args = args
+	return ct, nil
+}
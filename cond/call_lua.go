@@ -0,0 +1,69 @@
+package cond
+
+import (
+	"github.com/vela-public/onekit/lua"
+	"net/url"
+	"sync"
+	"time"
+)
+
+func (p *Provider) String() string                         { return "cnd.provider." + p.name }
+func (p *Provider) Type() lua.LValueType                   { return lua.LTObject }
+func (p *Provider) AssertFloat64() (float64, bool)         { return 0, false }
+func (p *Provider) AssertString() (string, bool)           { return "", false }
+func (p *Provider) AssertFunction() (*lua.LFunction, bool) { return nil, false }
+func (p *Provider) Hijack(*lua.CallFrameFSM) bool          { return false }
+
+func (p *Provider) purgeL(L *lua.LState) int {
+	p.Purge()
+	return 0
+}
+
+func (p *Provider) Index(L *lua.LState, key string) lua.LValue {
+	switch key {
+	case "name":
+		return lua.S2L(p.name)
+	case "ttl":
+		return lua.LInt(p.ttl / time.Second)
+	case "purge":
+		return lua.NewFunction(p.purgeL)
+	}
+	return lua.LNil
+}
+
+// LuaResolver 注册时在 L 所在的协程创建独立的线程 匹配可能在任意协程执行
+// LState 不能并发使用 同一个提供者的查询串行执行 结果有缓存
+func LuaResolver(L *lua.LState, fn *lua.LFunction) Resolver {
+	var mutex sync.Mutex
+	co, _ := L.NewThread()
+
+	return func(value string, args url.Values) (any, error) {
+		mutex.Lock()
+		defer mutex.Unlock()
+		defer co.SetTop(0)
+
+		np := lua.P{
+			Fn:      fn,
+			Protect: true,
+			NRet:    1,
+		}
+
+		err := co.CallByParam(np, lua.S2L(value), lua.S2L(args.Encode()))
+		if err != nil {
+			return nil, err
+		}
+		return co.Get(-1), nil
+	}
+}
+
+// vela.cnd.provider("/risk/ip" , function(value , query) return {kind = "tor"} end , 60)
+func NewProviderL(L *lua.LState) int {
+	name := L.CheckString(1)
+	fn := L.CheckFunction(2)
+	p := Register(name, LuaResolver(L, fn))
+	if ttl := L.Get(3); ttl.Type() != lua.LTNil {
+		p.TTL(time.Duration(L.IsInt(3)) * time.Second)
+	}
+	L.Push(p)
+	return 1
+}
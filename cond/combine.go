@@ -27,6 +27,10 @@ func (iv *Combine) Match(data interface{}, opt ...OptionFunc) bool {
 		return true
 	}
 
+	if t := explainOf(opt); t != nil {
+		return explainAny(v, data, opt, t)
+	}
+
 	for _, cnd := range v {
 		if cnd.Match(data, opt...) {
 			return true
@@ -42,12 +42,19 @@ func (iv *Combine) MatchL(L *lua.LState) int {
 	return 1
 }
 
+func (iv *Combine) ExplainL(L *lua.LState) int {
+	L.Push(iv.Explain(L.Get(1), LState(L)))
+	return 1
+}
+
 func (iv *Combine) Index(L *lua.LState, key string) lua.LValue {
 	switch key {
 	case "cnd":
 		return lua.NewFunction(iv.cndL)
 	case "match":
 		return lua.NewFunction(iv.MatchL)
+	case "explain":
+		return lua.NewFunction(iv.ExplainL)
 	default:
 		return lua.LNil
 	}
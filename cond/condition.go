@@ -37,7 +37,7 @@ func NewText(v ...string) *Cond {
 }
 
 func CheckMany(L *lua.LState, opt ...OptionFunc) *Cond {
-	cnd := &Cond{}
+	cnd := New()
 	cnd.CheckMany(L, opt...)
 	return cnd
 }
@@ -1,8 +1,18 @@
 package cond
 
 import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"github.com/vela-public/onekit/layer"
+	"github.com/vela-public/onekit/lua"
+	"github.com/vela-public/onekit/netkit"
+	"net/url"
 	"strconv"
+	"strings"
+	"sync"
 	"testing"
+	"time"
 )
 
 type Event struct {
@@ -47,6 +57,40 @@ func TestUnary(t *testing.T) {
 	}))
 }
 
+func TestKeys(t *testing.T) {
+	sec := NewSectionText("name,addr,type eq x")
+	if strings.Join(sec.keys, "|") != "name|addr|type" {
+		t.Fatalf("bad keys %q", sec.keys)
+	}
+
+	//任意一个键命中
+	if !NewText("name,addr eq x").Match(map[string]string{"addr": "x"}) {
+		t.Fatal("second key should match")
+	}
+}
+
+func TestLogic(t *testing.T) {
+	data := map[string]string{"a": "1", "b": "3"}
+	cnd := NewText("a eq 1", "b eq 2")
+	if cnd.Match(data) {
+		t.Fatal("and mode should not match")
+	}
+
+	cnd.logic.set(OR)
+	if !cnd.Match(data) {
+		t.Fatal("or mode should match")
+	}
+
+	co := lua.NewState()
+	defer co.Close()
+	co.Push(OR)
+	co.Push(lua.S2L("a eq 2"))
+	co.Push(lua.S2L("b eq 3"))
+	if v := CheckMany(co); v.Logic() != OR || !v.Match(data) {
+		t.Fatal("lua or mode should match")
+	}
+}
+
 func TestString(t *testing.T) {
 
 	raw := "12-345-67.raw"
@@ -67,3 +111,610 @@ func TestRegex(t *testing.T) {
 
 	t.Log(cnd.Match(val, Payload(pay)))
 }
+
+func TestCall(t *testing.T) {
+	hit := 0
+	Register("/risk/ip", func(value string, args url.Values) (any, error) {
+		hit++
+		if value != "1.1.1.1" {
+			return nil, nil
+		}
+		return map[string]string{"kind": "tor"}, nil
+	})
+	defer Unregister("/risk/ip")
+
+	cnd := NewText("addr -> /risk/ip?have&kind=tor")
+	if !cnd.Match(map[string]string{"addr": "1.1.1.1"}) {
+		t.Fatal("call should match 1.1.1.1")
+	}
+
+	if cnd.Match(map[string]string{"addr": "2.2.2.2"}) {
+		t.Fatal("call should not match 2.2.2.2")
+	}
+
+	cnd.Match(map[string]string{"addr": "1.1.1.1"})
+	if hit != 2 {
+		t.Fatalf("cache miss got %d resolve", hit)
+	}
+}
+
+func TestCallArgs(t *testing.T) {
+	hit := 0
+	Register("/risk/level", func(value string, args url.Values) (any, error) {
+		hit++
+		return map[string]string{"level": args.Get("level")}, nil
+	})
+	defer Unregister("/risk/level")
+
+	//相同 value 不同参数 不能共用缓存
+	data := map[string]string{"addr": "1.1.1.1"}
+	if !NewText("addr -> /risk/level?level=high").Match(data) {
+		t.Fatal("level=high should match")
+	}
+
+	if !NewText("addr -> /risk/level?level=low").Match(data) {
+		t.Fatal("level=low should not use the cached answer of level=high")
+	}
+
+	NewText("addr -> /risk/level?level=low").Match(data)
+	if hit != 2 {
+		t.Fatalf("cache key got %d resolve want 2", hit)
+	}
+}
+
+func TestExpr(t *testing.T) {
+	cnd := NewText("(a eq 1 and b cn x) or not (c in 3,4)")
+	cases := []struct {
+		data map[string]string
+		want bool
+	}{
+		{map[string]string{"a": "1", "b": "xyz", "c": "3"}, true},
+		{map[string]string{"a": "2", "b": "xyz", "c": "3"}, false},
+		{map[string]string{"a": "2", "b": "xyz", "c": "5"}, true},
+		{map[string]string{"a": "1", "b": "abc", "c": "4"}, false},
+	}
+
+	for i, c := range cases {
+		if got := cnd.Match(c.data); got != c.want {
+			t.Fatalf("case %d got %v want %v", i, got, c.want)
+		}
+	}
+
+	if _, err := ParseExpr("(a eq 1 and b eq 2"); err == nil {
+		t.Fatal("missing ')' should fail")
+	}
+
+	if !NewText("value ~ (.*)").Match(map[string]string{"value": "456"}) {
+		t.Fatal("single section should keep working")
+	}
+}
+
+func TestExprCompat(t *testing.T) {
+	cases := []struct {
+		text string
+		expr bool
+		data map[string]string
+		want bool
+	}{
+		{"title cn Terms and Conditions", false, map[string]string{"title": "Terms and Conditions"}, true},
+		{"title cn Terms and Conditions", false, map[string]string{"title": "Terms"}, false},
+		{"title eq black or white", false, map[string]string{"title": "black or white"}, true},
+		{"title cn Terms and name eq x", true, map[string]string{"title": "Terms", "name": "x"}, true},
+		{"title cn Terms and !debug", true, map[string]string{"title": "Terms"}, true},
+		{"(title cn Terms) and Conditions", true, map[string]string{"title": "Terms", "Conditions": "1"}, true},
+		{"a eq 1\tand b eq 2", true, map[string]string{"a": "1", "b": "3"}, false},
+		{"a eq 1\tand b eq 2", true, map[string]string{"a": "1", "b": "2"}, true},
+		{"a eq 2\n or\tb eq 2", true, map[string]string{"a": "1", "b": "2"}, true},
+		{"a eq 1\u00a0and\u3000b eq 2", true, map[string]string{"a": "1", "b": "2"}, true},
+		{"not\t(a eq 1)", true, map[string]string{"a": "2"}, true},
+	}
+
+	for i, c := range cases {
+		if got := isExpr(c.text); got != c.expr {
+			t.Fatalf("case %d %s expr got %v want %v", i, c.text, got, c.expr)
+		}
+
+		if got := NewText(c.text).Match(c.data); got != c.want {
+			t.Fatalf("case %d %s got %v want %v", i, c.text, got, c.want)
+		}
+	}
+}
+
+func TestCompiled(t *testing.T) {
+	cases := []struct {
+		text string
+		data map[string]string
+		want bool
+	}{
+		{"name eq a,b,c", map[string]string{"name": "b"}, true},
+		{"name ieq ABC", map[string]string{"name": "abc"}, true},
+		{"name eq nil", map[string]string{}, true},
+		{"name cn a1,a2,a3,a4,a5,a6,a7,a8,Xyz", map[string]string{"name": "--xyz--"}, false},
+		{"name icn a1,a2,a3,a4,a5,a6,a7,a8,Xyz", map[string]string{"name": "--xyz--"}, true},
+		{"name cn a1,a2,a3,a4,a5,a6,a7,a8,Xyz", map[string]string{"name": "--Xyz--"}, true},
+		{"name re *.jar,*.war", map[string]string{"name": "app.war"}, true},
+		{"value gt 10,100", map[string]string{"value": "50"}, true},
+		{"value lt 10", map[string]string{"value": "50"}, false},
+		{"name isuffix .JAR", map[string]string{"name": "a.jar"}, true},
+	}
+
+	for i, c := range cases {
+		if got := NewText(c.text).Match(c.data); got != c.want {
+			t.Fatalf("case %d %s got %v want %v", i, c.text, got, c.want)
+		}
+	}
+}
+
+// BenchmarkSection 每次迭代匹配 1<<20 个事件
+func BenchmarkSection(b *testing.B) {
+	words := make([]string, 64)
+	for i := range words {
+		words[i] = "word" + strconv.Itoa(i)
+	}
+	values := strings.Join(words, ",")
+
+	const size = 1 << 20
+	events := map[string][]string{
+		"name":  make([]string, size),
+		"value": make([]string, size),
+	}
+	for i := 0; i < size; i++ {
+		events["name"][i] = "prefix-" + strconv.Itoa(i) + "-suffix"
+		events["value"][i] = strconv.Itoa(i)
+	}
+
+	texts := []string{
+		"name eq " + values,
+		"name cn " + values,
+		"name re *word1*,*word2*,*word3*",
+		"value gt 100,200,300",
+	}
+
+	for _, text := range texts {
+		sec := NewSectionText(text)
+		column := events[sec.keys[0]]
+
+		//逐个比较 编译前的匹配方式
+		b.Run("dynamic/"+sec.method.String(), func(b *testing.B) {
+			for i := 0; i < b.N; i++ {
+				for _, v := range column {
+					for _, item := range sec.data {
+						if sec.compare(v, item) {
+							break
+						}
+					}
+				}
+			}
+		})
+
+		b.Run("compiled/"+sec.method.String(), func(b *testing.B) {
+			for i := 0; i < b.N; i++ {
+				for _, v := range column {
+					sec.matcher(v)
+				}
+			}
+		})
+	}
+}
+
+func TestExplain(t *testing.T) {
+	cnd := NewText("name !eq a,b,c", "(value gt 10 and value lt 20) or addr cn x")
+	trace := cnd.Explain(map[string]string{"name": "d", "value": "15"})
+	if !trace.Match || len(trace.Sections) != 2 {
+		t.Fatalf("bad trace %s", trace)
+	}
+
+	st := trace.Sections[0]
+	if !st.Not || st.Method != "equal" || len(st.Keys[0].Tried) != 3 {
+		t.Fatalf("bad section trace %s", trace)
+	}
+
+	tree := trace.Sections[1]
+	if tree.Method != "tree" || tree.Nodes[0].Method != "or" {
+		t.Fatalf("bad tree trace %s", trace)
+	}
+
+	iv := NewCombine()
+	iv.Add(NewText("name eq x"))
+	iv.Add(cnd)
+	trace = iv.Explain(map[string]string{"name": "d", "value": "15"})
+	if !trace.Match || len(trace.Conds) != 2 || trace.Conds[0].Match {
+		t.Fatalf("bad combine trace %s", trace)
+	}
+}
+
+func TestExplainCall(t *testing.T) {
+	hit := 0
+	Register("/risk/explain", func(value string, args url.Values) (any, error) {
+		hit++
+		if value != "1.1.1.1" {
+			return nil, nil
+		}
+		return map[string]string{"kind": "tor"}, nil
+	}, TTL(0))
+	defer Unregister("/risk/explain")
+
+	cnd := NewText("addr -> /risk/explain?kind=vpn,/risk/explain?kind=tor")
+	trace := cnd.Explain(map[string]string{"addr": "1.1.1.1"})
+	if !trace.Match {
+		t.Fatalf("bad trace %s", trace)
+	}
+
+	kt := trace.Sections[0].Keys[0]
+	if len(kt.Tried) != 2 || kt.Hit != "/risk/explain?kind=tor" {
+		t.Fatalf("bad key trace %s", trace)
+	}
+
+	//记录过程不能再次查询
+	if hit != 2 {
+		t.Fatalf("explain resolve %d times want 2", hit)
+	}
+}
+
+func TestLint(t *testing.T) {
+	codes := func(r *Report) []string {
+		var v []string
+		for _, d := range r.Diagnostics {
+			v = append(v, d.Code)
+		}
+		return v
+	}
+
+	cases := []struct {
+		text []string
+		want string
+	}{
+		{[]string{"a eq 1"}, ""},
+		{[]string{"a xx 1"}, "operator"},
+		{[]string{"a lt abc"}, "numeric"},
+		{[]string{"ip cidr 10.0.0.0/33"}, "cidr"},
+		{[]string{"a eq 1", "a !eq 1"}, "contradiction"},
+		{[]string{"a eq 1 or a !eq 1"}, "tautology"},
+		{[]string{"a eq 1 and a eq 2"}, "contradiction"},
+		{[]string{"(a eq 1 and b eq 2"}, "syntax"},
+		{[]string{"a eq 1 and b eq"}, "dangling"},
+		{[]string{"a eq 1 or"}, "dangling"},
+		{[]string{"a eq 1\tand"}, "dangling"},
+		{[]string{"title cn Terms and Conditions"}, ""},
+		{[]string{"title eq black or white"}, ""},
+	}
+
+	for i, c := range cases {
+		got := strings.Join(codes(Lint(c.text...)), ",")
+		if got != c.want {
+			t.Fatalf("case %d %v got %q want %q", i, c.text, got, c.want)
+		}
+	}
+
+	r := Lint("x eq 1 and a lt abc")
+	if len(r.Diagnostics) != 1 || r.Diagnostics[0].Pos != 16 {
+		t.Fatalf("bad position %s", r)
+	}
+
+	r = Lint("a eq 1 and b eq")
+	if len(r.Diagnostics) != 1 || r.Diagnostics[0].Pos != 7 || r.Ok() {
+		t.Fatalf("dangling position %s", r)
+	}
+
+	or := NewText("a eq 1", "a !eq 1")
+	or.logic.set(OR)
+	if got := strings.Join(codes(or.Lint()), ","); got != "tautology" {
+		t.Fatalf("or mode got %q want tautology", got)
+	}
+
+	or = NewText("a eq 1", "a eq 2")
+	or.logic.set(OR)
+	if got := strings.Join(codes(or.Lint()), ","); got != "" {
+		t.Fatalf("or mode got %q want nothing", got)
+	}
+
+	iv := NewCombine()
+	iv.Add(NewText("a eq 1"))
+	iv.Add(NewText("a eq 1"))
+	if got := strings.Join(codes(iv.Lint()), ","); got != "duplicate" {
+		t.Fatalf("combine duplicate got %q", got)
+	}
+}
+
+func TestWindow(t *testing.T) {
+	now := time.Now()
+	data := map[string]string{
+		"name": "hello",
+		"ts":   strconv.FormatInt(now.Add(-2*time.Minute).Unix(), 10),
+		"old":  now.Add(-48 * time.Hour).Format("2006-01-02 15:04:05"),
+	}
+
+	cases := []struct {
+		text string
+		want bool
+	}{
+		{"name len 5", true},
+		{"name len >5", false},
+		{"name len 1-3,4-8", true},
+		{"ts within 5m", true},
+		{"ts within 1m", false},
+		{"old before 1d", true},
+		{"old after 1d", false},
+		{"ts after 2000-01-01", true},
+	}
+
+	for i, c := range cases {
+		cnd := NewText(c.text)
+		if got := cnd.Match(data); got != c.want {
+			t.Fatalf("case %d %s got %v want %v", i, c.text, got, c.want)
+		}
+	}
+}
+
+func TestSource(t *testing.T) {
+	ipm := &netkit.IPMatch{Name: "blacklist"}
+	_ = ipm.Add("10.0.0.0/8")
+	_ = ipm.Add("1.1.1.1")
+	RegisterSet("ipset", "blacklist", ipm)
+	defer UnregisterSet("ipset", "blacklist")
+
+	h := NewHashmap("users")
+	h.Add("root", "admin")
+	RegisterSet("hashmap", "users", h)
+	defer UnregisterSet("hashmap", "users")
+
+	cnd := NewText("src_ip in 8.8.8.8,@ipset:blacklist")
+	for ip, want := range map[string]bool{"10.2.3.4": true, "1.1.1.1": true, "8.8.8.8": true, "9.9.9.9": false} {
+		if got := cnd.Match(map[string]string{"src_ip": ip}); got != want {
+			t.Fatalf("%s got %v want %v", ip, got, want)
+		}
+	}
+
+	if !NewText("user eq @hashmap:users").Match(map[string]string{"user": "root"}) {
+		t.Fatal("hashmap source should match")
+	}
+
+	if sec := NewSectionText("user cn @hashmap:users"); sec.Ok() {
+		t.Fatal("value source should only support eq,in")
+	}
+}
+
+func TestSourceRegister(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	L := lua.NewState()
+	defer L.Close()
+	L.SetContext(ctx)
+	L.SetGlobal("hashmap", lua.NewFunction(NewHashMapL))
+	L.SetGlobal("ipset", lua.NewFunction(NewIPSetL))
+
+	cnd := NewText("user eq @hashmap:staff", "src_ip in @ipset:office")
+	data := map[string]string{"user": "root", "src_ip": "10.1.1.1"}
+
+	if err := L.DoString(`
+		local h = hashmap("temp")
+		hashmap("staff").register()
+		ipset("office").register()
+	`); err != nil {
+		t.Fatal(err)
+	}
+	if _, ok := LookupSet("hashmap", "temp"); ok {
+		t.Fatal("hashmap registered without register()")
+	}
+
+	h, _ := LookupSet("hashmap", "staff")
+	s, _ := LookupSet("ipset", "office")
+	if h == nil || s == nil {
+		t.Fatal("register() not registered")
+	}
+	h.(*Hashmap).Add("root")
+	_ = s.(*IPSet).Add("10.0.0.0/8")
+	if !cnd.Match(data) {
+		t.Fatal("registered sets should match")
+	}
+
+	// 新的注册不会被旧集合注销
+	other := NewHashmap("staff")
+	other.Add("root")
+	unregister := RegisterSet("hashmap", "staff", other)
+	defer unregister()
+
+	cancel()
+	deadline := time.Now().Add(time.Second)
+	for {
+		_, ok := LookupSet("ipset", "office")
+		if !ok {
+			break
+		}
+		if time.Now().After(deadline) {
+			t.Fatal("ipset not unregistered after context done")
+		}
+		time.Sleep(time.Millisecond)
+	}
+
+	if v, ok := LookupSet("hashmap", "staff"); !ok || v != Set(other) {
+		t.Fatal("newer registration removed")
+	}
+}
+
+func TestHashmapConcurrent(t *testing.T) {
+	h := NewHashmap("race")
+	var wg sync.WaitGroup
+	for i := 0; i < 4; i++ {
+		wg.Add(2)
+		go func(i int) {
+			defer wg.Done()
+			for k := 0; k < 200; k++ {
+				h.Add(fmt.Sprintf("%d.%d", i, k))
+			}
+		}(i)
+		go func() {
+			defer wg.Done()
+			for k := 0; k < 200; k++ {
+				h.Match("0.1")
+				_ = h.Len()
+			}
+		}()
+	}
+	wg.Wait()
+
+	if n := h.Len(); n != 800 {
+		t.Fatalf("size %d want 800", n)
+	}
+}
+
+func TestAST(t *testing.T) {
+	cnd := NewText("name !icn vela", "(a eq 1 and b cn x) or not (c in 3,4)", "ts within 5m", "!debug")
+	text, err := json.Marshal(cnd)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var v Cond
+	if err = json.Unmarshal(text, &v); err != nil {
+		t.Fatal(err)
+	}
+
+	if v.Canonical() != cnd.Canonical() {
+		t.Fatalf("round trip got %s want %s", v.Canonical(), cnd.Canonical())
+	}
+
+	if NewText(cnd.Canonical()).Canonical() != cnd.Canonical() {
+		t.Fatalf("canonical text %s not stable", cnd.Canonical())
+	}
+
+	if cnd.String() != "name !icn vela,(a eq 1 and b cn x) or not (c in 3,4),ts within 5m,!debug" {
+		t.Fatalf("String should keep the raw text got %s", cnd.String())
+	}
+
+	data := map[string]string{"name": "x", "a": "1", "b": "xyz", "c": "3", "ts": strconv.FormatInt(time.Now().Unix(), 10)}
+	if v.Match(data) != cnd.Match(data) || !v.Match(data) {
+		t.Fatal("round trip match not equal")
+	}
+
+	iv := NewCombine()
+	iv.Add(cnd)
+	iv.Add(NewText("a eq 2"))
+	text, err = json.Marshal(iv)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var cv Combine
+	if err = json.Unmarshal(text, &cv); err != nil || len(cv) != 2 {
+		t.Fatalf("combine round trip %v", err)
+	}
+
+	if err = json.Unmarshal([]byte(`{"logic":"and","sections":[{"type":"section","keys":["a"],"op":"xx"}]}`), &v); err == nil {
+		t.Fatal("unknown operator should fail")
+	}
+}
+
+func TestStringIndex(t *testing.T) {
+	lookup := String("hello world")
+	cases := map[string]string{
+		"[1]":   "h",
+		"[5]":   "o",
+		"[1:3]": "el",
+		"[6:0]": "world",
+		"[x]":   "hello world",
+		"[1":    "hello world",
+	}
+
+	for key, want := range cases {
+		if got := lookup(key); got != want {
+			t.Fatalf("%s got %q want %q", key, got, want)
+		}
+	}
+}
+
+type fakeTransport struct {
+	layer.Transport
+	bodies []map[string]any
+}
+
+func (tr *fakeTransport) JSON(path string, data interface{}, result interface{}) error {
+	body := data.(map[string]any)
+	tr.bodies = append(tr.bodies, body)
+	args := body["args"].(url.Values)
+	*(result.(*map[string]any)) = map[string]any{"level": args.Get("level")}
+	return nil
+}
+
+func TestCallTransport(t *testing.T) {
+	tr := &fakeTransport{}
+	Register("/risk/remote", TransportResolver("/risk/remote", tr))
+	defer Unregister("/risk/remote")
+
+	data := map[string]string{"addr": "1.1.1.1"}
+	if !NewText("addr -> /risk/remote?level=high").Match(data) {
+		t.Fatal("level=high should match")
+	}
+	if !NewText("addr -> /risk/remote?level=low").Match(data) {
+		t.Fatal("level=low should match")
+	}
+
+	if len(tr.bodies) != 2 || tr.bodies[0]["value"] != "1.1.1.1" || tr.bodies[1]["args"].(url.Values).Get("level") != "low" {
+		t.Fatalf("transport bodies %v", tr.bodies)
+	}
+}
+
+func TestCallEvict(t *testing.T) {
+	hit := make(map[string]int)
+	p := NewProvider("/evict", func(value string, args url.Values) (any, error) {
+		hit[value]++
+		return true, nil
+	})
+	p.Size(2)
+
+	lookup := func(values ...string) {
+		for _, v := range values {
+			if _, err := p.Lookup(v, nil); err != nil {
+				t.Fatal(err)
+			}
+		}
+	}
+
+	// a 最近使用过 只淘汰最久未使用的 b
+	lookup("a", "b", "a", "c", "a", "c", "b")
+	if hit["a"] != 1 || hit["c"] != 1 || hit["b"] != 2 {
+		t.Fatalf("evict one entry at a time got %v", hit)
+	}
+
+	if p.recent.Len() != 2 || len(p.cache) != 2 {
+		t.Fatalf("cache size %d %d", p.recent.Len(), len(p.cache))
+	}
+}
+
+// 匹配在多个协程并发执行 Lua 提供者不能并发使用虚拟机
+func TestCallLuaConcurrent(t *testing.T) {
+	L := lua.NewState()
+	defer L.Close()
+	if err := L.DoString(`return function(value, query) return value == "1.1.1.1" end`); err != nil {
+		t.Fatal(err)
+	}
+	fn := L.Get(-1).(*lua.LFunction)
+	L.Pop(1)
+
+	Register("/lua/ip", LuaResolver(L, fn), TTL(0))
+	defer Unregister("/lua/ip")
+
+	cnd := NewText("addr -> /lua/ip")
+	var wg sync.WaitGroup
+	errs := make(chan string, 8)
+	for i := 0; i < 8; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			for k := 0; k < 100; k++ {
+				addr := "1.1.1.1"
+				if k%2 == 1 {
+					addr = "2.2.2.2"
+				}
+				if cnd.Match(map[string]string{"addr": addr}) != (k%2 == 0) {
+					errs <- fmt.Sprintf("worker %d round %d %s", i, k, addr)
+					return
+				}
+			}
+		}(i)
+	}
+	wg.Wait()
+	close(errs)
+	for e := range errs {
+		t.Fatal(e)
+	}
+}
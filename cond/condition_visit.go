@@ -1,7 +1,6 @@
 package cond
 
 import (
-	"bytes"
 	"github.com/vela-public/onekit/errkit"
 	"github.com/vela-public/onekit/lua"
 )
@@ -36,7 +35,7 @@ func (cnd *Cond) CheckMany(L *lua.LState, opt ...OptionFunc) {
 
 	cm, ok := cnd.Mode(L, ov.seek+1)
 	if ok {
-		cnd.logic.put(cm)
+		cnd.logic.set(cm)
 		ov.seek++
 		if top-ov.seek <= 0 {
 			return
@@ -68,20 +67,12 @@ func (cnd *Cond) Len() int {
 	return len(cnd.data)
 }
 
-func (cnd *Cond) String() string {
-	if cnd.Len() == 0 {
-		return ""
+// Logic 条件组之间的关系 默认为 and
+func (cnd *Cond) Logic() Logic {
+	if cnd.logic != nil && cnd.logic.has(OR) {
+		return OR
 	}
-
-	n := cnd.Len()
-	var buf bytes.Buffer
-	for i := 0; i < n; i++ {
-		if i != 0 {
-			buf.WriteByte(',')
-		}
-		buf.WriteString(cnd.data[i].raw)
-	}
-	return buf.String()
+	return AND
 }
 
 func (cnd *Cond) matchOr(ov *option, n int) bool {
@@ -124,12 +115,18 @@ func (cnd *Cond) matchAnd(ov *option, n int) bool {
 func (cnd *Cond) with(v interface{}, opt ...OptionFunc) *option {
 	ov := &option{
 		value: v,
-		logic: AND,
+		logic: cnd.Logic(),
 		errs:  errkit.Errors(),
 	}
 	for _, fn := range opt {
 		fn(ov)
 	}
+
+	if ov.trace != nil {
+		ov.trace.Sections = nil
+		ov.explain = &ov.trace.Sections
+	}
+
 	ov.NewPeek(v)
 	return ov
 }
@@ -141,7 +138,15 @@ func (cnd *Cond) Match(v interface{}, opt ...OptionFunc) bool {
 	}
 
 	ov := cnd.with(v, opt...)
+	ok := cnd.match(ov, n)
+	if ov.trace != nil {
+		ov.trace.Cond = cnd.String()
+		ov.trace.Match = ok
+	}
+	return ok
+}
 
+func (cnd *Cond) match(ov *option, n int) bool {
 	if ov.field == nil && ov.compare == nil {
 		return false
 	}
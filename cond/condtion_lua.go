@@ -43,10 +43,17 @@ func (lc *LCond) matchL(L *lua.LState) int {
 	return 1
 }
 
+func (lc *LCond) explainL(L *lua.LState) int {
+	L.Push(lc.cnd.Explain(L.Get(1), LState(L)))
+	return 1
+}
+
 func (lc *LCond) Index(L *lua.LState, key string) lua.LValue {
 	switch key {
 	case "match":
 		return lua.NewFunction(lc.matchL)
+	case "explain":
+		return lua.NewFunction(lc.explainL)
 	}
 
 	return lua.LNil
@@ -0,0 +1,218 @@
+package cond
+
+import (
+	"encoding/json"
+	"github.com/vela-public/onekit/cast"
+	"github.com/vela-public/onekit/lua"
+)
+
+// KeyTrace 单个键的匹配过程
+type KeyTrace struct {
+	Key   string   `json:"key"`
+	Value string   `json:"value"`
+	Tried []string `json:"tried,omitempty"`
+	Hit   string   `json:"hit,omitempty"`
+	Match bool     `json:"match"`
+}
+
+// SectionTrace 单个条件的匹配过程 表达式的and,or,not 节点记录在Nodes中
+type SectionTrace struct {
+	Raw    string          `json:"raw,omitempty"`
+	Method string          `json:"method"`
+	Not    bool            `json:"not"`
+	Keys   []*KeyTrace     `json:"keys,omitempty"`
+	Nodes  []*SectionTrace `json:"nodes,omitempty"`
+	Result bool            `json:"result"`
+	Error  string          `json:"error,omitempty"`
+}
+
+// Trace 匹配过程 Combine 和 Ignore 每个条件的过程记录在Conds中
+type Trace struct {
+	Cond     string          `json:"cond,omitempty"`
+	Match    bool            `json:"match"`
+	Sections []*SectionTrace `json:"sections,omitempty"`
+	Conds    []*Trace        `json:"conds,omitempty"`
+}
+
+func (t *Trace) Json() []byte {
+	text, _ := json.Marshal(t)
+	return text
+}
+
+func (t *Trace) String() string                         { return cast.B2S(t.Json()) }
+func (t *Trace) Type() lua.LValueType                   { return lua.LTObject }
+func (t *Trace) AssertFloat64() (float64, bool)         { return 0, false }
+func (t *Trace) AssertString() (string, bool)           { return t.String(), true }
+func (t *Trace) AssertFunction() (*lua.LFunction, bool) { return nil, false }
+func (t *Trace) Hijack(*lua.CallFrameFSM) bool          { return false }
+
+func (t *Trace) Index(L *lua.LState, key string) lua.LValue {
+	switch key {
+	case "match":
+		return lua.LBool(t.Match)
+	case "cond":
+		return lua.S2L(t.Cond)
+	case "json":
+		return lua.S2L(t.String())
+	}
+	return lua.LNil
+}
+
+// Explain 记录匹配过程 eg: cnd.Match(v, cond.Explain(trace))
+func Explain(t *Trace) OptionFunc {
+	return func(o *option) {
+		o.trace = t
+	}
+}
+
+func explainOf(opt []OptionFunc) *Trace {
+	ov := &option{}
+	for _, fn := range opt {
+		fn(ov)
+	}
+	return ov.trace
+}
+
+func (opt *option) record(st *SectionTrace) {
+	if opt.explain == nil {
+		return
+	}
+	*opt.explain = append(*opt.explain, st)
+}
+
+// enter 进入子节点 返回恢复函数
+func (opt *option) enter(st *SectionTrace) func() {
+	opt.record(st)
+	prev := opt.explain
+	opt.explain = &st.Nodes
+	return func() {
+		opt.explain = prev
+	}
+}
+
+// candidate 逐个值检查 用于记录尝试过的值
+func (s *Section) candidate(i int, v string) bool {
+	switch s.method {
+	case Regex:
+		return i < len(s.regex) && s.regex[i].MatchString(v)
+	case Len, Before, After, Within:
+		return s.matcher != nil && s.matcher(v)
+	default:
+		if vs := s.sourceOf(s.data[i]); vs != nil {
+			return vs.Match(v)
+		}
+		return s.compare(v, s.data[i])
+	}
+}
+
+// traceKey 记录当前键的匹配过程 -> 运算在匹配时已经记录 不再重复查询
+func (s *Section) traceKey(match bool, ov *option) {
+	st := ov.section
+	kt := ov.key
+	ov.key = nil
+	if st == nil || kt == nil {
+		return
+	}
+
+	kt.Match = match
+	st.Keys = append(st.Keys, kt)
+
+	switch s.method {
+	case Call:
+		return
+	case Cidr:
+		for _, sub := range s.subnet {
+			kt.Tried = append(kt.Tried, sub.String())
+		}
+		return
+	}
+
+	for i, item := range s.data {
+		kt.Tried = append(kt.Tried, item)
+		if s.candidate(i, kt.Value) {
+			kt.Hit = item
+			return
+		}
+	}
+}
+
+// explain 记录当前条件的匹配过程
+func (s *Section) explain(ov *option) (bool, error) {
+	st := &SectionTrace{
+		Raw:    s.raw,
+		Method: s.method.String(),
+		Not:    s.not,
+	}
+
+	prev := ov.section
+	ov.section = st
+
+	var ok bool
+	var err error
+	if s.method == Tree && s.Ok() {
+		leave := ov.enter(st)
+		ok, err = s.exec(ov)
+		leave()
+	} else {
+		ov.record(st)
+		ok, err = s.exec(ov)
+	}
+
+	ov.section = prev
+	st.Result = ok
+	if err != nil {
+		st.Error = err.Error()
+	}
+	return ok, err
+}
+
+func (e *Expr) explain(ov *option) bool {
+	if e.kind == ExprSection {
+		return e.call(ov)
+	}
+
+	st := &SectionTrace{
+		Method: e.kind.String(),
+		Not:    e.kind == ExprNot,
+	}
+
+	leave := ov.enter(st)
+	st.Result = e.call(ov)
+	leave()
+	return st.Result
+}
+
+func (cnd *Cond) Explain(v any, opt ...OptionFunc) *Trace {
+	t := &Trace{}
+	t.Match = cnd.Match(v, append(opt, Explain(t))...)
+	t.Cond = cnd.String()
+	return t
+}
+
+func (iv *Combine) Explain(v any, opt ...OptionFunc) *Trace {
+	t := &Trace{}
+	t.Match = iv.Match(v, append(opt, Explain(t))...)
+	return t
+}
+
+func (iv *Ignore) Explain(v any, opt ...OptionFunc) *Trace {
+	t := &Trace{}
+	t.Match = iv.Match(v, append(opt, Explain(t))...)
+	return t
+}
+
+// explainAny Combine 和 Ignore 为每个条件生成独立的记录 任意命中即返回
+func explainAny(data []*Cond, v any, opt []OptionFunc, t *Trace) bool {
+	t.Conds = nil
+	t.Match = false
+	for _, cnd := range data {
+		sub := &Trace{Cond: cnd.String()}
+		sub.Match = cnd.Match(v, append(opt, Explain(sub))...)
+		t.Conds = append(t.Conds, sub)
+		if sub.Match {
+			t.Match = true
+			break
+		}
+	}
+	return t.Match
+}
@@ -0,0 +1,442 @@
+package cond
+
+import (
+	"fmt"
+	"strings"
+	"unicode"
+	"unicode/utf8"
+)
+
+const (
+	ExprSection ExprKind = iota
+	ExprAnd
+	ExprOr
+	ExprNot
+)
+
+type ExprKind uint8
+
+func (k ExprKind) String() string {
+	switch k {
+	case ExprSection:
+		return "section"
+	case ExprAnd:
+		return "and"
+	case ExprOr:
+		return "or"
+	case ExprNot:
+		return "not"
+	default:
+		return "unknown"
+	}
+}
+
+// Expr 条件表达式语法树
+// (a eq 1 and b cn x) or not (c in 3,4)
+type Expr struct {
+	kind  ExprKind
+	pos   int
+	sec   *Section
+	nodes []*Expr
+}
+
+func (e *Expr) Kind() ExprKind {
+	return e.kind
+}
+
+func (e *Expr) Pos() int {
+	return e.pos
+}
+
+func (e *Expr) Section() *Section {
+	return e.sec
+}
+
+func (e *Expr) Nodes() []*Expr {
+	return e.nodes
+}
+
+// Walk 深度优先遍历所有叶子条件
+func (e *Expr) Walk(fn func(*Section)) {
+	if e.kind == ExprSection {
+		fn(e.sec)
+		return
+	}
+
+	for _, node := range e.nodes {
+		node.Walk(fn)
+	}
+}
+
+func (e *Expr) Call(ov *option) bool {
+	if ov.explain != nil {
+		return e.explain(ov)
+	}
+	return e.call(ov)
+}
+
+func (e *Expr) call(ov *option) bool {
+	switch e.kind {
+	case ExprSection:
+		ok, err := e.sec.Call(ov)
+		if err != nil {
+			ov.Try(e.sec.raw, err)
+			return false
+		}
+		return ok
+
+	case ExprAnd:
+		for _, node := range e.nodes {
+			if !node.Call(ov) {
+				return false
+			}
+		}
+		return true
+
+	case ExprOr:
+		for _, node := range e.nodes {
+			if node.Call(ov) {
+				return true
+			}
+		}
+		return false
+
+	case ExprNot:
+		return !e.nodes[0].Call(ov)
+	}
+
+	return false
+}
+
+// PosError 带有偏移的编译错误
+type PosError struct {
+	Pos int
+	Err error
+}
+
+func (e *PosError) Error() string {
+	return fmt.Sprintf("offset %d: %v", e.Pos, e.Err)
+}
+
+func (e *PosError) Unwrap() error {
+	return e.Err
+}
+
+type exprParser struct {
+	raw string
+	pos int
+}
+
+func (p *exprParser) errorf(format string, v ...any) error {
+	return &PosError{Pos: p.pos, Err: fmt.Errorf(format, v...)}
+}
+
+// spaceAt offset处空白字符的长度 不是空白时返回0 制表符 换行和 unicode 空白都是分隔符
+func (p *exprParser) spaceAt(offset int) int {
+	if offset >= len(p.raw) {
+		return 0
+	}
+
+	if ch := p.raw[offset]; ch < utf8.RuneSelf {
+		if unicode.IsSpace(rune(ch)) {
+			return 1
+		}
+		return 0
+	}
+
+	r, size := utf8.DecodeRuneInString(p.raw[offset:])
+	if unicode.IsSpace(r) {
+		return size
+	}
+	return 0
+}
+
+// skip 跳过offset处连续的空白 返回之后的偏移
+func (p *exprParser) skip(offset int) int {
+	for {
+		w := p.spaceAt(offset)
+		if w == 0 {
+			return offset
+		}
+		offset += w
+	}
+}
+
+func (p *exprParser) space() {
+	p.pos = p.skip(p.pos)
+}
+
+func (p *exprParser) eof() bool {
+	return p.pos >= len(p.raw)
+}
+
+// keyword 判断offset处是否为关键字 and,or,not 后面必须为空格 括号 或者结束
+func (p *exprParser) keyword(offset int, word string) bool {
+	if !strings.HasPrefix(p.raw[offset:], word) {
+		return false
+	}
+
+	end := offset + len(word)
+	if end == len(p.raw) {
+		return true
+	}
+
+	return p.raw[end] == '(' || p.spaceAt(end) > 0
+}
+
+func (p *exprParser) accept(word string) bool {
+	p.space()
+	if p.eof() || !p.keyword(p.pos, word) {
+		return false
+	}
+	p.pos += len(word)
+	return true
+}
+
+func (p *exprParser) or() (*Expr, error) {
+	pos := p.pos
+	node, err := p.and()
+	if err != nil {
+		return nil, err
+	}
+
+	if !p.accept("or") {
+		return node, nil
+	}
+
+	e := &Expr{kind: ExprOr, pos: pos, nodes: []*Expr{node}}
+	for {
+		node, err = p.and()
+		if err != nil {
+			return nil, err
+		}
+		e.nodes = append(e.nodes, node)
+		if !p.accept("or") {
+			return e, nil
+		}
+	}
+}
+
+func (p *exprParser) and() (*Expr, error) {
+	pos := p.pos
+	node, err := p.unary()
+	if err != nil {
+		return nil, err
+	}
+
+	if !p.accept("and") {
+		return node, nil
+	}
+
+	e := &Expr{kind: ExprAnd, pos: pos, nodes: []*Expr{node}}
+	for {
+		node, err = p.unary()
+		if err != nil {
+			return nil, err
+		}
+		e.nodes = append(e.nodes, node)
+		if !p.accept("and") {
+			return e, nil
+		}
+	}
+}
+
+func (p *exprParser) unary() (*Expr, error) {
+	p.space()
+	if p.eof() {
+		return nil, p.errorf("unexpected end, want condition")
+	}
+
+	pos := p.pos
+	if p.accept("not") {
+		node, err := p.unary()
+		if err != nil {
+			return nil, err
+		}
+		return &Expr{kind: ExprNot, pos: pos, nodes: []*Expr{node}}, nil
+	}
+
+	if p.raw[p.pos] == '(' {
+		p.pos++
+		node, err := p.or()
+		if err != nil {
+			return nil, err
+		}
+
+		p.space()
+		if p.eof() || p.raw[p.pos] != ')' {
+			return nil, p.errorf("missing ')' for '(' at offset %d", pos)
+		}
+		p.pos++
+		return node, nil
+	}
+
+	return p.section()
+}
+
+// section 读取一个条件 直到遇到顶层的 and , or 或者未匹配的 ')'
+func (p *exprParser) section() (*Expr, error) {
+	start := p.pos
+	depth := 0
+	n := len(p.raw)
+
+	i := start
+loop:
+	for ; i < n; i++ {
+		switch p.raw[i] {
+		case '\\':
+			i++
+		case '(':
+			depth++
+		case ')':
+			if depth == 0 {
+				break loop
+			}
+			depth--
+		default:
+			if depth != 0 || p.spaceAt(i) == 0 {
+				continue
+			}
+
+			k := p.skip(i)
+			if k < n && (p.keyword(k, "and") || p.keyword(k, "or")) {
+				break loop
+			}
+		}
+	}
+
+	if i > n {
+		i = n
+	}
+
+	text := strings.TrimSpace(p.raw[start:i])
+	p.pos = i
+	if text == "" {
+		return nil, p.errorf("empty condition")
+	}
+
+	sec := newSection(text)
+	if !sec.Ok() {
+		return nil, &PosError{Pos: start, Err: fmt.Errorf("%s %v", text, sec.err)}
+	}
+
+	return &Expr{kind: ExprSection, pos: start, sec: sec}, nil
+}
+
+// ParseExpr 编译一个带有 and or not 和括号的表达式
+func ParseExpr(raw string) (*Expr, error) {
+	p := &exprParser{raw: raw}
+	e, err := p.or()
+	if err != nil {
+		return nil, err
+	}
+
+	p.space()
+	if !p.eof() {
+		return nil, p.errorf("unexpected '%s'", p.raw[p.pos:])
+	}
+	return e, nil
+}
+
+// isExpr 是否包含表达式语法 兼容原有单个条件的写法
+// 以 ( 或者 not 开头时为表达式 否则 and , or 拆分后每个条件都必须完整(有运算符 或者 !key)
+// 才当作表达式 eg: title cn Terms and Conditions 依旧是单个条件
+func isExpr(raw string) bool {
+	if raw == "" {
+		return false
+	}
+
+	if raw[0] == '(' {
+		return true
+	}
+
+	p := &exprParser{raw: raw}
+	if p.keyword(0, "not") {
+		return true
+	}
+
+	if !p.split() {
+		return false
+	}
+
+	e, err := ParseExpr(raw)
+	if err != nil {
+		//带括号时保留语法错误
+		return strings.ContainsRune(raw, '(')
+	}
+
+	complete := true
+	e.Walk(func(sec *Section) {
+		if sec.method == Unary && !strings.HasPrefix(sec.raw, "!") {
+			complete = false
+		}
+	})
+	return complete
+}
+
+// dangling 按单个条件处理但 and , or 后面没有完整条件 eg: a eq 1 and b eq
+// 返回最后一个出错位置之前的关键字和偏移
+func dangling(raw string) (int, string, bool) {
+	if isExpr(raw) {
+		return 0, "", false
+	}
+
+	_, err := ParseExpr(raw)
+	pe, ok := err.(*PosError)
+	if !ok {
+		return 0, "", false
+	}
+
+	p := &exprParser{raw: raw}
+	at, word := -1, ""
+	depth := 0
+	for i := 0; i < pe.Pos && i < len(raw); i++ {
+		switch raw[i] {
+		case '\\':
+			i++
+		case '(':
+			depth++
+		case ')':
+			depth--
+		default:
+			w := p.spaceAt(i)
+			if w == 0 || depth != 0 {
+				continue
+			}
+			k := p.skip(i)
+			switch {
+			case p.keyword(k, "and"):
+				at, word = k, "and"
+			case p.keyword(k, "or"):
+				at, word = k, "or"
+			}
+		}
+	}
+	return at, word, at >= 0
+}
+
+// split 顶层是否有 and , or
+func (p *exprParser) split() bool {
+	raw := p.raw
+	depth := 0
+	n := len(raw)
+	for i := 0; i < n; i++ {
+		switch raw[i] {
+		case '\\':
+			i++
+		case '(':
+			depth++
+		case ')':
+			depth--
+		default:
+			w := p.spaceAt(i)
+			if w == 0 || depth != 0 || i+w >= n {
+				continue
+			}
+			if p.keyword(i+w, "and") || p.keyword(i+w, "or") {
+				return true
+			}
+		}
+	}
+	return false
+}
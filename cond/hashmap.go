@@ -4,47 +4,72 @@ import (
 	"github.com/vela-public/onekit/libkit"
 	"github.com/vela-public/onekit/lua"
 	"path/filepath"
+	"sync"
 )
 
+// Hashmap 匹配可能在任意协程执行 读写需要加锁
 type Hashmap struct {
-	name string
-	data map[string]libkit.NULL
+	name  string
+	mutex sync.RWMutex
+	data  map[string]libkit.NULL
 }
 
 func (h *Hashmap) String() string                         { return "hashmap.filter." + h.name }
 func (h *Hashmap) Type() lua.LValueType                   { return lua.LTObject }
-func (h *Hashmap) AssertFloat64() (float64, bool)         { return float64(len(h.data)), true }
+func (h *Hashmap) AssertFloat64() (float64, bool)         { return float64(h.Len()), true }
 func (h *Hashmap) AssertString() (string, bool)           { return "", false }
 func (h *Hashmap) AssertFunction() (*lua.LFunction, bool) { return lua.NewFunction(h.MatchL), true }
 func (h *Hashmap) Hijack(fsm *lua.CallFrameFSM) bool      { return false }
 
-func (h *Hashmap) MatchL(L *lua.LState) int {
-	lv := L.CheckString(1)
+func (h *Hashmap) Match(v string) bool {
+	h.mutex.RLock()
+	defer h.mutex.RUnlock()
+	_, ok := h.data[v]
+	return ok
+}
+
+func (h *Hashmap) Len() int {
+	h.mutex.RLock()
+	defer h.mutex.RUnlock()
+	return len(h.data)
+}
+
+func (h *Hashmap) Add(v ...string) {
+	h.mutex.Lock()
+	defer h.mutex.Unlock()
+
 	if h.data == nil {
-		L.Push(lua.LFalse)
-		return 1
+		h.data = make(map[string]libkit.NULL, len(v))
 	}
 
-	_, ok := h.data[lv]
-	if ok {
-		L.Push(lua.LTrue)
-		return 1
+	for _, item := range v {
+		h.data[item] = libkit.NULL{}
 	}
+}
+
+// File 先读完文件再加锁写入 读文件时不阻塞匹配
+func (h *Hashmap) File(path string) error {
+	var lines []string
+	err := libkit.ReadlineFunc(path, func(text string) (bool, error) {
+		lines = append(lines, text)
+		return false, nil
+	})
+	if err != nil {
+		return err
+	}
+
+	h.Add(lines...)
+	return nil
+}
 
-	L.Push(lua.LFalse)
+func (h *Hashmap) MatchL(L *lua.LState) int {
+	L.Push(lua.LBool(h.Match(L.CheckString(1))))
 	return 1
 }
 
 func (h *Hashmap) fromL(L *lua.LState) int {
 	path := filepath.Clean(L.CheckString(1))
-	if h.data == nil {
-		h.data = make(map[string]libkit.NULL)
-	}
-
-	if e := libkit.ReadlineFunc(path, func(text string) (bool, error) {
-		h.data[text] = libkit.NULL{}
-		return false, nil
-	}); e != nil {
+	if e := h.File(path); e != nil {
 		L.RaiseError("readline fail %s %v", path, e)
 		return 0
 	}
@@ -57,16 +82,27 @@ func (h *Hashmap) Index(L *lua.LState, key string) lua.LValue {
 	case "file":
 		return lua.NewFunction(h.fromL)
 	case "size":
-		return lua.LInt(len(h.data))
+		return lua.LInt(h.Len())
+	case "register":
+		return lua.NewFunction(h.registerL)
 	}
 	return lua.LNil
 }
 
-func NewHashMapL(L *lua.LState) int {
-	name := L.CheckString(1)
-	h := &Hashmap{
+func NewHashmap(name string) *Hashmap {
+	return &Hashmap{
 		name: name,
 	}
+}
+
+func (h *Hashmap) registerL(L *lua.LState) int {
+	RegisterSetL(L, "hashmap", h.name, h)
 	L.Push(h)
 	return 1
 }
+
+// vela.cnd.hashmap("whitelist").file("/path").register() 注册后可以使用 key in @hashmap:whitelist
+func NewHashMapL(L *lua.LState) int {
+	L.Push(NewHashmap(L.CheckString(1)))
+	return 1
+}
@@ -27,6 +27,10 @@ func (iv *Ignore) Match(data interface{}, opt ...OptionFunc) bool {
 		return false
 	}
 
+	if t := explainOf(opt); t != nil {
+		return explainAny(v, data, opt, t)
+	}
+
 	for _, cnd := range v {
 		if cnd.Match(data, opt...) {
 			return true
@@ -0,0 +1,90 @@
+package cond
+
+import (
+	"github.com/vela-public/onekit/lua"
+	"github.com/vela-public/onekit/netkit"
+	"sync"
+)
+
+// IPSet 加锁的 netkit.IPMatch 脚本加载文件时可能正在匹配
+type IPSet struct {
+	name  string
+	mutex sync.RWMutex
+	data  *netkit.IPMatch
+}
+
+func (s *IPSet) String() string                         { return "ipset.filter." + s.name }
+func (s *IPSet) Type() lua.LValueType                   { return lua.LTObject }
+func (s *IPSet) AssertFloat64() (float64, bool)         { return 0, false }
+func (s *IPSet) AssertString() (string, bool)           { return "", false }
+func (s *IPSet) AssertFunction() (*lua.LFunction, bool) { return lua.NewFunction(s.MatchL), true }
+func (s *IPSet) Hijack(fsm *lua.CallFrameFSM) bool      { return false }
+
+func (s *IPSet) Match(v string) bool {
+	s.mutex.RLock()
+	defer s.mutex.RUnlock()
+	return s.data.Match(v)
+}
+
+func (s *IPSet) Add(v ...string) error {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	for _, item := range v {
+		if err := s.data.Add(item); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (s *IPSet) File(path string) error {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	return s.data.File(path)
+}
+
+func (s *IPSet) MatchL(L *lua.LState) int {
+	L.Push(lua.LBool(s.Match(L.CheckString(1))))
+	return 1
+}
+
+func (s *IPSet) fromL(L *lua.LState) int {
+	path := L.CheckFile(1)
+	if e := s.File(path); e != nil {
+		L.RaiseError("readline fail %s %v", path, e)
+		return 0
+	}
+	L.Push(s)
+	return 1
+}
+
+func (s *IPSet) registerL(L *lua.LState) int {
+	RegisterSetL(L, "ipset", s.name, s)
+	L.Push(s)
+	return 1
+}
+
+func (s *IPSet) Index(L *lua.LState, key string) lua.LValue {
+	switch key {
+	case "file":
+		return lua.NewFunction(s.fromL)
+	case "match":
+		return lua.NewFunction(s.MatchL)
+	case "register":
+		return lua.NewFunction(s.registerL)
+	}
+	return lua.LNil
+}
+
+func NewIPSet(name string) *IPSet {
+	return &IPSet{
+		name: name,
+		data: &netkit.IPMatch{Name: name},
+	}
+}
+
+// vela.cnd.ipset("blacklist").file("/path").register() 注册后可以使用 src_ip in @ipset:blacklist
+func NewIPSetL(L *lua.LState) int {
+	L.Push(NewIPSet(L.CheckString(1)))
+	return 1
+}
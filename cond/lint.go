@@ -0,0 +1,368 @@
+package cond
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"github.com/vela-public/onekit/cast"
+	"github.com/vela-public/onekit/grep"
+	"github.com/vela-public/onekit/lua"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+const (
+	LintError Severity = iota + 1
+	LintWarn
+)
+
+type Severity uint8
+
+func (s Severity) String() string {
+	switch s {
+	case LintError:
+		return "error"
+	case LintWarn:
+		return "warning"
+	default:
+		return "unknown"
+	}
+}
+
+func (s Severity) MarshalText() ([]byte, error) {
+	return []byte(s.String()), nil
+}
+
+// Diagnostic 检查结果 Index:第几个条件 Pos:条件内的偏移
+type Diagnostic struct {
+	Index    int      `json:"index"`
+	Pos      int      `json:"pos"`
+	Severity Severity `json:"severity"`
+	Code     string   `json:"code"`
+	Message  string   `json:"message"`
+}
+
+func (d Diagnostic) String() string {
+	return fmt.Sprintf("%d:%d %s [%s] %s", d.Index, d.Pos, d.Severity, d.Code, d.Message)
+}
+
+type Report struct {
+	Diagnostics []Diagnostic `json:"diagnostics"`
+}
+
+func (r *Report) add(index, pos int, severity Severity, code string, format string, v ...any) {
+	r.Diagnostics = append(r.Diagnostics, Diagnostic{
+		Index:    index,
+		Pos:      pos,
+		Severity: severity,
+		Code:     code,
+		Message:  fmt.Sprintf(format, v...),
+	})
+}
+
+func (r *Report) count(severity Severity) int {
+	n := 0
+	for _, d := range r.Diagnostics {
+		if d.Severity == severity {
+			n++
+		}
+	}
+	return n
+}
+
+func (r *Report) Errors() int {
+	return r.count(LintError)
+}
+
+func (r *Report) Warnings() int {
+	return r.count(LintWarn)
+}
+
+func (r *Report) Ok() bool {
+	return r.Errors() == 0
+}
+
+func (r *Report) Json() []byte {
+	text, _ := json.Marshal(r)
+	return text
+}
+
+func (r *Report) String() string {
+	var buf bytes.Buffer
+	for i, d := range r.Diagnostics {
+		if i != 0 {
+			buf.WriteByte('\n')
+		}
+		buf.WriteString(d.String())
+	}
+	return buf.String()
+}
+
+func (r *Report) Type() lua.LValueType                   { return lua.LTObject }
+func (r *Report) AssertFloat64() (float64, bool)         { return float64(len(r.Diagnostics)), true }
+func (r *Report) AssertString() (string, bool)           { return r.String(), true }
+func (r *Report) AssertFunction() (*lua.LFunction, bool) { return nil, false }
+func (r *Report) Hijack(*lua.CallFrameFSM) bool          { return false }
+
+func (r *Report) Index(L *lua.LState, key string) lua.LValue {
+	switch key {
+	case "ok":
+		return lua.LBool(r.Ok())
+	case "errors":
+		return lua.LInt(r.Errors())
+	case "warnings":
+		return lua.LInt(r.Warnings())
+	case "json":
+		return lua.S2L(cast.B2S(r.Json()))
+	}
+	return lua.LNil
+}
+
+// linter 检查一组条件 leaf 记录同一层级的条件用于检查矛盾和重复
+type linter struct {
+	report *Report
+	index  int
+}
+
+type leaf struct {
+	index int
+	pos   int
+	sec   *Section
+}
+
+// signature 不包含取反的条件签名
+func (s *Section) signature() string {
+	keys := append([]string(nil), s.keys...)
+	data := append([]string(nil), s.data...)
+	sort.Strings(keys)
+	sort.Strings(data)
+	return fmt.Sprintf("%s|%d|%v|%s", strings.Join(keys, ","), s.method, s.iCase, strings.Join(data, ","))
+}
+
+func (lt *linter) section(pos int, s *Section) {
+	if s.method == Pass || s.method == Fn {
+		return
+	}
+
+	if s.err != nil {
+		code := "syntax"
+		if s.method == Cidr {
+			code = "cidr"
+		}
+
+		var pe *PosError
+		if errors.As(s.err, &pe) {
+			lt.report.add(lt.index, pos+pe.Pos, LintError, code, "%v", pe.Err)
+			return
+		}
+		lt.report.add(lt.index, pos, LintError, code, "%s %v", s.raw, s.err)
+		return
+	}
+
+	if s.method == Oop {
+		word, _, _ := strings.Cut(s.raw[s.opAt:], " ")
+		lt.report.add(lt.index, pos+s.opAt, LintError, "operator", "unknown operator %q", word)
+		return
+	}
+
+	if s.method == Unary {
+		return
+	}
+
+	empty := 0
+	for _, item := range s.data {
+		if item == "" {
+			empty++
+		}
+	}
+
+	switch {
+	case len(s.data) == empty:
+		lt.report.add(lt.index, pos+s.valAt, LintError, "empty", "%s empty value list", s.raw)
+		return
+	case empty > 0:
+		lt.report.add(lt.index, pos+s.valAt, LintWarn, "empty", "%s contains %d empty value", s.raw, empty)
+	}
+
+	for _, item := range s.data {
+		at := pos + s.valAt
+		if idx := strings.Index(s.raw[s.valAt:], item); idx >= 0 {
+			at += idx
+		}
+
+		switch s.method {
+		case Lt, Le, Ge, Gt:
+			if _, err := strconv.ParseFloat(item, 64); err != nil {
+				lt.report.add(lt.index, at, LintError, "numeric", "%s compare with non-numeric %q", s.method, item)
+			}
+		case Re:
+			if item == "" || item[0] == '=' {
+				continue
+			}
+			pattern := item
+			if pattern[0] == '~' {
+				pattern = pattern[1:]
+			}
+			if _, err := grep.Compile(pattern, nil); err != nil {
+				lt.report.add(lt.index, at, LintError, "grep", "bad pattern %q %v", item, err)
+			}
+		}
+	}
+
+	if s.method == Call {
+		for _, ct := range s.calls {
+			if _, ok := LookupProvider(ct.name); !ok {
+				lt.report.add(lt.index, pos+s.valAt, LintWarn, "provider", "provider %s not registered", ct.name)
+			}
+		}
+	}
+}
+
+// group 检查同一层级的条件 and:矛盾 or:恒真
+func (lt *linter) group(leaves []leaf, and bool) {
+	seen := make(map[string]leaf, len(leaves))
+	for _, item := range leaves {
+		s := item.sec
+		if !s.Ok() || s.method == Oop || s.method == Fn || s.method == Pass || len(s.keys) == 0 {
+			continue
+		}
+
+		sig := s.signature()
+		prev, ok := seen[sig]
+		if !ok {
+			seen[sig] = item
+			continue
+		}
+
+		switch {
+		case prev.sec.not == s.not:
+			lt.report.add(item.index, item.pos, LintWarn, "duplicate", "%s duplicate of offset %d", s.raw, prev.pos)
+		case and:
+			lt.report.add(item.index, item.pos, LintWarn, "contradiction", "%s and %s is always false", prev.sec.raw, s.raw)
+		default:
+			lt.report.add(item.index, item.pos, LintWarn, "tautology", "%s or %s is always true", prev.sec.raw, s.raw)
+		}
+	}
+
+	if !and {
+		return
+	}
+
+	//同一个键 相等比较 单个不同的值
+	eq := make(map[string]leaf)
+	for _, item := range leaves {
+		s := item.sec
+		if !s.Ok() || s.method != Eq || s.not || s.iCase || len(s.keys) != 1 || len(s.data) != 1 {
+			continue
+		}
+
+		key := s.keys[0]
+		prev, ok := eq[key]
+		if !ok {
+			eq[key] = item
+			continue
+		}
+
+		if prev.sec.data[0] != s.data[0] {
+			lt.report.add(item.index, item.pos, LintWarn, "contradiction", "%s and %s is always false", prev.sec.raw, s.raw)
+		}
+	}
+}
+
+func (lt *linter) expr(e *Expr, base int) {
+	if e.kind == ExprSection {
+		lt.section(base+e.pos, e.sec)
+		return
+	}
+
+	var leaves []leaf
+	for _, node := range e.nodes {
+		lt.expr(node, base)
+		if node.kind == ExprSection {
+			leaves = append(leaves, leaf{index: lt.index, pos: base + node.pos, sec: node.sec})
+		}
+	}
+
+	switch e.kind {
+	case ExprAnd:
+		lt.group(leaves, true)
+	case ExprOr:
+		lt.group(leaves, false)
+	}
+}
+
+func (lt *linter) visit(s *Section, base int) {
+	if s.method == Tree && s.err == nil {
+		lt.expr(s.expr, base)
+		return
+	}
+
+	if s.method != Tree {
+		if at, word, ok := dangling(s.raw); ok {
+			lt.report.add(lt.index, base+at, LintError, "dangling", "%s without complete condition, %q is read as one condition", word, s.raw)
+		}
+	}
+	lt.section(base, s)
+}
+
+// Lint 检查条件表达式 返回带位置的诊断信息 多个条件之间为 and 关系
+func Lint(text ...string) *Report {
+	lt := &linter{report: &Report{}}
+	var leaves []leaf
+	for i, raw := range text {
+		lead := len(raw) - len(strings.TrimLeft(raw, " "))
+		lt.index = i
+		s := NewSectionText(raw)
+		lt.visit(s, lead)
+		if s.method != Tree {
+			leaves = append(leaves, leaf{index: i, pos: lead, sec: s})
+		}
+	}
+
+	lt.group(leaves, true)
+	return lt.report
+}
+
+func (cnd *Cond) Lint() *Report {
+	lt := &linter{report: &Report{}}
+	var leaves []leaf
+	for i, s := range cnd.data {
+		lt.index = i
+		lt.visit(s, 0)
+		if s.method != Tree {
+			leaves = append(leaves, leaf{index: i, pos: 0, sec: s})
+		}
+	}
+
+	lt.group(leaves, cnd.Logic() == AND)
+	return lt.report
+}
+
+// Lint 检查每个条件组 以及重复的条件组
+func (iv *Combine) Lint() *Report {
+	report := &Report{}
+	seen := make(map[string]int)
+	for i, cnd := range *iv {
+		sub := cnd.Lint()
+		for _, d := range sub.Diagnostics {
+			d.Index = i
+			report.Diagnostics = append(report.Diagnostics, d)
+		}
+
+		text := cnd.Canonical()
+		if prev, ok := seen[text]; ok {
+			report.add(i, 0, LintWarn, "duplicate", "%s duplicate of cond %d", text, prev)
+			continue
+		}
+		seen[text] = i
+	}
+	return report
+}
+
+func NewLintL(L *lua.LState) int {
+	text := lua.Unpack[string](L)
+	L.Push(Lint(text...))
+	return 1
+}
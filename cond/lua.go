@@ -10,5 +10,9 @@ func Preload(v lua.Preloader) {
 	tab.Set("OR", OR)
 	tab.Set("UNARY", UNARY)
 	tab.Set("CODE", CODE)
-	v.Set("cnd", lua.NewExport("lua.cnd.export", lua.WithFunc(NewCondL)))
+	tab.Set("provider", lua.NewFunction(NewProviderL))
+	tab.Set("lint", lua.NewFunction(NewLintL))
+	tab.Set("hashmap", lua.NewFunction(NewHashMapL))
+	tab.Set("ipset", lua.NewFunction(NewIPSetL))
+	v.Set("cnd", lua.NewExport("lua.cnd.export", lua.WithFunc(NewCondL), lua.WithTable(tab)))
 }
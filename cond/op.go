@@ -18,10 +18,15 @@ const (
 	Fn
 	Prefix
 	Suffix
+	Tree
+	Len
+	Before
+	After
+	Within
 )
 
 var (
-	opTab = []string{"equal", "grep", "contain", "include", "less", "less or equal", "greater or equal", "greater", "unary", "call", "oop", "pass", "regex"}
+	opTab = []string{"equal", "grep", "contain", "include", "less", "less or equal", "greater or equal", "greater", "unary", "call", "oop", "pass", "regex", "cidr", "fn", "prefix", "suffix", "tree", "length", "before", "after", "within"}
 )
 
 var (
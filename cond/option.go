@@ -20,6 +20,10 @@ type option struct {
 	co        *lua.LState
 	partition []int
 	payload   func(int, string)
+	trace     *Trace
+	explain   *[]*SectionTrace
+	section   *SectionTrace
+	key       *KeyTrace //当前键的记录 -> 运算匹配时记录查询过的目标
 }
 
 func Seek(seek int) OptionFunc {
@@ -59,6 +63,13 @@ func (opt *option) Pay(i int, v string) {
 	opt.payload(i, v)
 }
 
+func (opt *option) Try(key string, err error) {
+	if opt.errs == nil {
+		return
+	}
+	opt.errs.Try(key, err)
+}
+
 func (opt *option) NewPeek(v interface{}) bool {
 	switch item := v.(type) {
 	case Lookup:
@@ -8,6 +8,7 @@ import (
 	"net"
 	"regexp"
 	"strings"
+	"time"
 )
 
 type Section struct {
@@ -20,6 +21,14 @@ type Section struct {
 	data      []string
 	regex     []*regexp.Regexp
 	subnet    []*net.IPNet
+	opAt      int
+	valAt     int
+	calls     []*callTarget
+	sources   []*valueSource
+	lens      []func(int) bool
+	times     []func(time.Time, time.Time) bool
+	expr      *Expr
+	matcher   func(string) bool
 	partition int
 	invoke    func(any, ...OptionFunc) bool
 }
@@ -45,6 +54,7 @@ func (s *Section) Regex(v ...string) {
 
 func (s *Section) Method(v op) {
 	s.method = v
+	s.prepare()
 }
 
 func (s *Section) Keys(v ...string) {
@@ -52,6 +62,11 @@ func (s *Section) Keys(v ...string) {
 }
 
 func (s *Section) Value(v ...string) {
+	s.value(v...)
+	s.prepare()
+}
+
+func (s *Section) value(v ...string) {
 	s.data = append(s.data, v...)
 }
 
@@ -81,7 +96,7 @@ func (s *Section) withA(offset *int, n int) { //"name , key , text =  vela,123,4
 		switch ch {
 		case ',':
 			s.keys = append(s.keys, s.raw[sep:i])
-			sep = i
+			sep = i + 1
 
 		case ' ':
 			if sep != i {
@@ -94,6 +109,13 @@ func (s *Section) withA(offset *int, n int) { //"name , key , text =  vela,123,4
 
 }
 
+func (s *Section) peek(sep int, size int) string {
+	if sep+size > len(s.raw) {
+		return ""
+	}
+	return s.raw[sep : sep+size]
+}
+
 func (s *Section) withB(offset *int, n int) {
 	if !s.Ok() {
 		return
@@ -101,6 +123,7 @@ func (s *Section) withB(offset *int, n int) {
 
 	s.trim(offset, n)
 	sep := *offset
+	s.opAt = sep
 
 	if sep+3 > n {
 		s.invalid("not found method")
@@ -147,7 +170,31 @@ func (s *Section) withB(offset *int, n int) {
 		return
 	}
 
-	em := s.raw[sep : sep+2]
+	word, _, _ := strings.Cut(s.raw[sep:], " ")
+	switch word {
+	case "len":
+		s.method = Len
+		*offset = sep + len(word)
+		return
+	case "before":
+		s.method = Before
+		*offset = sep + len(word)
+		return
+	case "after":
+		s.method = After
+		*offset = sep + len(word)
+		return
+	case "within":
+		s.method = Within
+		*offset = sep + len(word)
+		return
+	case "cidr":
+		s.method = Cidr
+		*offset = sep + len(word)
+		return
+	}
+
+	em := s.peek(sep, 2)
 	switch em {
 	case "==":
 		s.method = Eq
@@ -192,7 +239,7 @@ func (s *Section) withB(offset *int, n int) {
 
 	}
 
-	em = s.raw[sep : sep+3]
+	em = s.peek(sep, 3)
 	switch em {
 	case "ieq":
 		s.method = Eq
@@ -216,7 +263,7 @@ func (s *Section) withB(offset *int, n int) {
 		return
 	}
 
-	em = s.raw[sep : sep+6] //prefix, suffix
+	em = s.peek(sep, 6) //prefix, suffix
 	switch em {
 	case "prefix":
 		s.method = Prefix
@@ -228,7 +275,7 @@ func (s *Section) withB(offset *int, n int) {
 		return
 	}
 
-	em = s.raw[sep : sep+7] //prefix, suffix
+	em = s.peek(sep, 7) //prefix, suffix
 	switch em {
 	case "iprefix":
 		s.method = Prefix
@@ -249,6 +296,7 @@ func (s *Section) withC(offset *int, n int) {
 	}
 
 	s.trim(offset, n)
+	s.valAt = *offset
 	sep := *offset
 	var item string
 	for i := *offset; i < n; i++ {
@@ -267,19 +315,19 @@ func (s *Section) withC(offset *int, n int) {
 			item = s.raw[sep:i]
 		}
 
-		s.Value(item)
+		s.value(item)
 		sep = i
 	}
 
 	//single value
 	if sep == *offset {
-		s.Value(s.raw[sep:])
+		s.value(s.raw[sep:])
 		return
 	}
 
 	//last value
 	if sep != n-1 {
-		s.Value(s.raw[sep+1:])
+		s.value(s.raw[sep+1:])
 	}
 }
 
@@ -300,11 +348,96 @@ func (s *Section) re2() {
 			return
 		}
 
-		s.data = append(s.data, item)
 		s.regex = append(s.regex, r)
 	}
 }
 
+func (s *Section) cidr() {
+	if s.method != Cidr {
+		return
+	}
+
+	if len(s.data) == 0 {
+		s.err = fmt.Errorf("not found cidr")
+		return
+	}
+
+	for _, item := range s.data {
+		if strings.IndexByte(item, '/') == -1 {
+			ip := net.ParseIP(item)
+			if ip == nil {
+				s.err = fmt.Errorf("invalid cidr %s", item)
+				return
+			}
+
+			bits := 128
+			if ip.To4() != nil {
+				ip = ip.To4()
+				bits = 32
+			}
+			s.subnet = append(s.subnet, &net.IPNet{IP: ip, Mask: net.CIDRMask(bits, bits)})
+			continue
+		}
+
+		_, sub, err := net.ParseCIDR(item)
+		if err != nil {
+			s.err = fmt.Errorf("invalid cidr %s", item)
+			return
+		}
+		s.subnet = append(s.subnet, sub)
+	}
+}
+
+func (s *Section) call() {
+	if s.method != Call {
+		return
+	}
+
+	if len(s.data) == 0 {
+		s.err = fmt.Errorf("not found call target")
+		return
+	}
+
+	for _, item := range s.data {
+		ct, err := newCallTarget(item)
+		if err != nil {
+			s.err = err
+			return
+		}
+		s.calls = append(s.calls, ct)
+	}
+}
+
+func (s *Section) Invoke(v string, ov *option) bool {
+	n := len(s.calls)
+	for i := 0; i < n; i++ {
+		ct := s.calls[i]
+		p, ok := LookupProvider(ct.name)
+		if !ok {
+			ov.Try(s.raw, fmt.Errorf("not found provider %s", ct.name))
+			continue
+		}
+
+		if ov.key != nil {
+			ov.key.Tried = append(ov.key.Tried, ct.raw)
+		}
+
+		answer, err := p.Lookup(v, ct.args)
+		if err != nil {
+			ov.Try(s.raw, err)
+			continue
+		}
+
+		if ct.Match(answer) {
+			if ov.key != nil {
+				ov.key.Hit = ct.raw
+			}
+			return true
+		}
+	}
+	return false
+}
+
 func (s *Section) compare(a string, b string) bool {
 
 	result := false
@@ -450,7 +583,13 @@ func (s *Section) Match(v string, ov *option) bool {
 	switch s.method {
 	case Cidr:
 		return s.ContainNet(v)
+	case Call:
+		return s.Invoke(v, ov)
 	default:
+		if s.matcher != nil {
+			return s.matcher(v)
+		}
+
 		n := len(s.data)
 		for i := 0; i < n; i++ {
 			item := s.data[i]
@@ -509,7 +648,18 @@ func (s *Section) pure(ov *option) (bool, error) {
 			continue
 		}
 
-		if !s.Match(ov.field(s.keys[i]), ov) {
+		key := s.keys[i]
+		v := ov.field(key)
+		if ov.section != nil {
+			ov.key = &KeyTrace{Key: key, Value: v}
+		}
+
+		ok := s.Match(v, ov)
+		if ov.section != nil {
+			s.traceKey(ok, ov)
+		}
+
+		if !ok {
 			continue
 		}
 
@@ -519,6 +669,13 @@ func (s *Section) pure(ov *option) (bool, error) {
 }
 
 func (s *Section) Call(ov *option) (bool, error) {
+	if ov.explain != nil {
+		return s.explain(ov)
+	}
+	return s.exec(ov)
+}
+
+func (s *Section) exec(ov *option) (bool, error) {
 	if ov.field == nil && ov.compare == nil {
 		return false, fmt.Errorf("invalid field function")
 	}
@@ -530,6 +687,8 @@ func (s *Section) Call(ov *option) (bool, error) {
 	switch {
 	case s.method == Pass:
 		return true, nil
+	case s.method == Tree:
+		return s.expr.Call(ov), nil
 	case s.method == Fn:
 		if s.invoke == nil {
 			return false, nil
@@ -687,10 +846,36 @@ func (s *Section) compile() {
 	s.withA(&offset, n)
 	s.withB(&offset, n)
 	s.withC(&offset, n)
+	s.build()
+}
+
+// build 根据 keys , method , data 编译匹配所需的数据
+func (s *Section) build() {
 	s.re2()
+	s.cidr()
+	s.call()
+	s.source()
+	s.length()
+	s.window()
+	s.prepare()
 }
 
 func NewSectionText(raw string) (section *Section) {
+	raw = strings.TrimSpace(raw)
+	if !isExpr(raw) {
+		return newSection(raw)
+	}
+
+	section = &Section{
+		raw:       raw,
+		method:    Tree,
+		partition: -1,
+	}
+	section.expr, section.err = ParseExpr(raw)
+	return
+}
+
+func newSection(raw string) (section *Section) {
 	section = &Section{
 		raw:       strings.TrimSpace(raw),
 		method:    Oop,
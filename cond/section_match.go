@@ -0,0 +1,217 @@
+package cond
+
+import (
+	"github.com/vela-public/onekit/cast"
+	"github.com/vela-public/onekit/grep"
+	"github.com/vela-public/onekit/libkit"
+	"github.com/vela-public/onekit/strkit"
+	"strings"
+)
+
+// 多值包含超过该数量时使用 Aho-Corasick
+const acThreshold = 8
+
+// prepare 预编译匹配函数 避免每次匹配时重复解析
+func (s *Section) prepare() {
+	s.matcher = nil
+	if len(s.data) == 0 {
+		return
+	}
+
+	switch s.method {
+	case Eq:
+		s.matcher = s.eqMatcher()
+	case In:
+		s.matcher = s.inMatcher()
+	case Cn:
+		s.matcher = s.cnMatcher()
+	case Re:
+		s.matcher = s.reMatcher()
+	case Lt, Le, Ge, Gt:
+		s.matcher = s.numMatcher()
+	case Prefix:
+		s.matcher = s.affixMatcher(strings.HasPrefix)
+	case Suffix:
+		s.matcher = s.affixMatcher(strings.HasSuffix)
+	case Len:
+		s.matcher = s.lenMatcher()
+	case Before, After, Within:
+		s.matcher = s.timeMatcher()
+	}
+
+	if len(s.sources) > 0 && s.matcher != nil {
+		literal := s.matcher
+		s.matcher = func(v string) bool {
+			if literal(v) {
+				return true
+			}
+
+			for _, vs := range s.sources {
+				if vs.Match(v) {
+					return true
+				}
+			}
+			return false
+		}
+	}
+}
+
+func (s *Section) hashset(fold bool) map[string]libkit.NULL {
+	set := make(map[string]libkit.NULL, len(s.data))
+	for _, item := range s.data {
+		if s.sourceOf(item) != nil {
+			continue
+		}
+
+		if fold {
+			item = strings.ToLower(item)
+		}
+		set[item] = libkit.NULL{}
+	}
+	return set
+}
+
+func (s *Section) eqMatcher() func(string) bool {
+	set := s.hashset(s.iCase)
+	_, null := set["nil"]
+
+	if s.iCase {
+		return func(v string) bool {
+			if v == "" && null {
+				return true
+			}
+			_, ok := set[strings.ToLower(v)]
+			return ok
+		}
+	}
+
+	return func(v string) bool {
+		if v == "" && null {
+			return true
+		}
+		_, ok := set[v]
+		return ok
+	}
+}
+
+func (s *Section) inMatcher() func(string) bool {
+	set := s.hashset(false)
+	return func(v string) bool {
+		_, ok := set[v]
+		return ok
+	}
+}
+
+func (s *Section) cnMatcher() func(string) bool {
+	data := make([]string, len(s.data))
+	for i, item := range s.data {
+		if item == "" {
+			return func(string) bool { return true }
+		}
+
+		if s.iCase {
+			item = strings.ToLower(item)
+		}
+		data[i] = item
+	}
+
+	contains := func(v string) bool {
+		if s.iCase {
+			v = strings.ToLower(v)
+		}
+
+		for _, item := range data {
+			if strings.Contains(v, item) {
+				return true
+			}
+		}
+		return false
+	}
+
+	if len(data) < acThreshold {
+		return contains
+	}
+
+	//Aho-Corasick 本身忽略大小写 once:命中一个即返回 区分大小写时命中后再逐个确认
+	ac := strkit.NewAc(data, true)
+	if s.iCase {
+		return func(v string) bool {
+			return len(ac.Match(v)) > 0
+		}
+	}
+
+	return func(v string) bool {
+		if len(ac.Match(v)) == 0 {
+			return false
+		}
+		return contains(v)
+	}
+}
+
+func (s *Section) reMatcher() func(string) bool {
+	fns := make([]func(string) bool, len(s.data))
+	for i, item := range s.data {
+		fns[i] = grep.New(item)
+	}
+
+	return func(v string) bool {
+		for _, fn := range fns {
+			if fn(v) {
+				return true
+			}
+		}
+		return false
+	}
+}
+
+func (s *Section) numMatcher() func(string) bool {
+	num := make([]float64, len(s.data))
+	for i, item := range s.data {
+		num[i] = cast.ToFloat64(item)
+	}
+
+	var cmp func(a, b float64) bool
+	switch s.method {
+	case Lt:
+		cmp = func(a, b float64) bool { return a < b }
+	case Le:
+		cmp = func(a, b float64) bool { return a <= b }
+	case Ge:
+		cmp = func(a, b float64) bool { return a >= b }
+	default:
+		cmp = func(a, b float64) bool { return a > b }
+	}
+
+	return func(v string) bool {
+		a := cast.ToFloat64(v)
+		for _, b := range num {
+			if cmp(a, b) {
+				return true
+			}
+		}
+		return false
+	}
+}
+
+func (s *Section) affixMatcher(fn func(string, string) bool) func(string) bool {
+	data := s.data
+	if s.iCase {
+		data = make([]string, len(s.data))
+		for i, item := range s.data {
+			data[i] = strings.ToLower(item)
+		}
+	}
+
+	return func(v string) bool {
+		if s.iCase {
+			v = strings.ToLower(v)
+		}
+
+		for _, item := range data {
+			if fn(v, item) {
+				return true
+			}
+		}
+		return false
+	}
+}
@@ -0,0 +1,221 @@
+package cond
+
+import (
+	"fmt"
+	"github.com/vela-public/onekit/cast"
+	"github.com/vela-public/onekit/lua"
+	"strconv"
+	"strings"
+	"time"
+	"unicode/utf8"
+)
+
+// length 编译长度条件 eg: name len 5,>10,<=3,8-16
+func (s *Section) length() {
+	if s.method != Len {
+		return
+	}
+
+	if len(s.data) == 0 {
+		s.err = fmt.Errorf("not found length")
+		return
+	}
+
+	for _, item := range s.data {
+		fn, err := newLength(item)
+		if err != nil {
+			s.err = err
+			return
+		}
+		s.lens = append(s.lens, fn)
+	}
+}
+
+func newLength(item string) (func(int) bool, error) {
+	atoi := func(v string) (int, error) {
+		n, err := strconv.Atoi(strings.TrimSpace(v))
+		if err != nil {
+			return 0, fmt.Errorf("invalid length %s", item)
+		}
+		return n, nil
+	}
+
+	prefix := []struct {
+		op  string
+		cmp func(a, b int) bool
+	}{
+		{">=", func(a, b int) bool { return a >= b }},
+		{"<=", func(a, b int) bool { return a <= b }},
+		{">", func(a, b int) bool { return a > b }},
+		{"<", func(a, b int) bool { return a < b }},
+	}
+
+	for _, p := range prefix {
+		if !strings.HasPrefix(item, p.op) {
+			continue
+		}
+
+		n, err := atoi(item[len(p.op):])
+		if err != nil {
+			return nil, err
+		}
+		cmp := p.cmp
+		return func(size int) bool { return cmp(size, n) }, nil
+	}
+
+	if lo, hi, ok := strings.Cut(item, "-"); ok {
+		a, err := atoi(lo)
+		if err != nil {
+			return nil, err
+		}
+		b, err := atoi(hi)
+		if err != nil {
+			return nil, err
+		}
+		return func(size int) bool { return size >= a && size <= b }, nil
+	}
+
+	n, err := atoi(item)
+	if err != nil {
+		return nil, err
+	}
+	return func(size int) bool { return size == n }, nil
+}
+
+func (s *Section) lenMatcher() func(string) bool {
+	return func(v string) bool {
+		size := utf8.RuneCountInString(v)
+		for _, fn := range s.lens {
+			if fn(size) {
+				return true
+			}
+		}
+		return false
+	}
+}
+
+// ParseTime 解析键值中的时间 支持 unix秒 , 毫秒 和常见的时间格式
+func ParseTime(v string) (time.Time, bool) {
+	if v == "" {
+		return time.Time{}, false
+	}
+
+	if n, err := strconv.ParseInt(v, 10, 64); err == nil {
+		if n > 1e12 {
+			return time.UnixMilli(n), true
+		}
+		return time.Unix(n, 0), true
+	}
+
+	t, err := cast.StringToDateInDefaultLocation(v, time.Local)
+	if err != nil {
+		return time.Time{}, false
+	}
+	return t, true
+}
+
+// ParseWindow 解析时间窗口 支持 time.ParseDuration 以及天 eg: 5m , 1h30m , 7d
+func ParseWindow(v string) (time.Duration, error) {
+	if strings.HasSuffix(v, "d") {
+		n, err := strconv.Atoi(strings.TrimSuffix(v, "d"))
+		if err != nil {
+			return 0, err
+		}
+		return time.Duration(n) * 24 * time.Hour, nil
+	}
+	return time.ParseDuration(v)
+}
+
+// window 编译时间条件
+// ts within 5m : 最近5分钟内
+// ts within 09:00-18:00,weekend : lua.RangeTimes 时间段
+// ts before 1h : 一小时之前 , ts before 2025-01-01 : 指定时间之前
+// ts after 1h : 一小时之内 , ts after 2025-01-01 : 指定时间之后
+func (s *Section) window() {
+	switch s.method {
+	case Before, After, Within:
+	default:
+		return
+	}
+
+	if len(s.data) == 0 {
+		s.err = fmt.Errorf("not found time window")
+		return
+	}
+
+	var ranges []string
+	for _, item := range s.data {
+		if d, err := ParseWindow(item); err == nil {
+			s.times = append(s.times, newRelative(s.method, d))
+			continue
+		}
+
+		if s.method == Within {
+			ranges = append(ranges, item)
+			continue
+		}
+
+		at, ok := ParseTime(item)
+		if !ok {
+			s.err = fmt.Errorf("invalid time %s", item)
+			return
+		}
+		s.times = append(s.times, newAbsolute(s.method, at))
+	}
+
+	if len(ranges) == 0 {
+		return
+	}
+
+	rt, err := lua.CompileRange(ranges)
+	if err != nil {
+		s.err = err
+		return
+	}
+
+	s.times = append(s.times, func(t time.Time, _ time.Time) bool {
+		return rt.Match(lua.Time(t))
+	})
+}
+
+func newRelative(method op, d time.Duration) func(time.Time, time.Time) bool {
+	switch method {
+	case Before:
+		return func(t time.Time, now time.Time) bool {
+			return t.Before(now.Add(-d))
+		}
+	default:
+		return func(t time.Time, now time.Time) bool {
+			return !t.Before(now.Add(-d)) && !t.After(now)
+		}
+	}
+}
+
+func newAbsolute(method op, at time.Time) func(time.Time, time.Time) bool {
+	if method == Before {
+		return func(t time.Time, _ time.Time) bool {
+			return t.Before(at)
+		}
+	}
+
+	return func(t time.Time, _ time.Time) bool {
+		return t.After(at)
+	}
+}
+
+func (s *Section) timeMatcher() func(string) bool {
+	return func(v string) bool {
+		t, ok := ParseTime(v)
+		if !ok {
+			return false
+		}
+
+		now := time.Now()
+		for _, fn := range s.times {
+			if fn(t, now) {
+				return true
+			}
+		}
+		return false
+	}
+}
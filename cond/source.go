@@ -0,0 +1,158 @@
+package cond
+
+import (
+	"context"
+	"fmt"
+	"github.com/vela-public/onekit/lua"
+	"github.com/vela-public/onekit/netkit"
+	"path/filepath"
+	"strings"
+	"sync"
+)
+
+// Set 外部值集合 eg: src_ip in @ipset:blacklist
+type Set interface {
+	Match(string) bool
+}
+
+var sets = struct {
+	mutex sync.RWMutex
+	data  map[string]Set
+}{data: make(map[string]Set)}
+
+// RegisterSet 注册外部集合 kind: hashmap , ipset 返回的函数只注销这次注册的集合
+func RegisterSet(kind string, name string, s Set) func() {
+	key := kind + ":" + name
+	sets.mutex.Lock()
+	sets.data[key] = s
+	sets.mutex.Unlock()
+
+	return func() {
+		sets.mutex.Lock()
+		if sets.data[key] == s {
+			delete(sets.data, key)
+		}
+		sets.mutex.Unlock()
+	}
+}
+
+// RegisterSetL 虚拟机的上下文结束时注销 服务被替换或者移除后不再匹配旧的集合
+func RegisterSetL(L *lua.LState, kind string, name string, s Set) {
+	cancel := RegisterSet(kind, name, s)
+	if ctx := L.Context(); ctx != nil {
+		context.AfterFunc(ctx, cancel)
+	}
+}
+
+func UnregisterSet(kind string, name string) {
+	sets.mutex.Lock()
+	delete(sets.data, kind+":"+name)
+	sets.mutex.Unlock()
+}
+
+func LookupSet(kind string, name string) (Set, bool) {
+	sets.mutex.RLock()
+	s, ok := sets.data[kind+":"+name]
+	sets.mutex.RUnlock()
+	return s, ok
+}
+
+// valueSource @file:path , @hashmap:name , @ipset:name , @ipset:path
+type valueSource struct {
+	raw  string
+	kind string
+	name string
+	set  Set
+}
+
+func (vs *valueSource) Match(v string) bool {
+	if vs.set != nil {
+		return vs.set.Match(v)
+	}
+
+	s, ok := LookupSet(vs.kind, vs.name)
+	if !ok {
+		return false
+	}
+	return s.Match(v)
+}
+
+func isPath(name string) bool {
+	return filepath.IsAbs(name) || strings.HasPrefix(name, ".")
+}
+
+func newValueSource(raw string) (*valueSource, bool, error) {
+	if len(raw) < 2 || raw[0] != '@' {
+		return nil, false, nil
+	}
+
+	kind, name, ok := strings.Cut(raw[1:], ":")
+	if !ok {
+		return nil, false, nil
+	}
+
+	vs := &valueSource{raw: raw, kind: kind, name: name}
+	switch kind {
+	case "file":
+		h := NewHashmap(name)
+		if err := h.File(filepath.Clean(name)); err != nil {
+			return nil, true, fmt.Errorf("%s read fail %v", raw, err)
+		}
+		vs.set = h
+
+	case "hashmap":
+		if name == "" {
+			return nil, true, fmt.Errorf("%s not found name", raw)
+		}
+
+	case "ipset":
+		if name == "" {
+			return nil, true, fmt.Errorf("%s not found name", raw)
+		}
+
+		if isPath(name) {
+			ipm := &netkit.IPMatch{Name: name}
+			if err := ipm.File(filepath.Clean(name)); err != nil {
+				return nil, true, fmt.Errorf("%s read fail %v", raw, err)
+			}
+			vs.set = ipm
+		}
+
+	default:
+		return nil, false, nil
+	}
+
+	return vs, true, nil
+}
+
+func (s *Section) source() {
+	for _, item := range s.data {
+		vs, ok, err := newValueSource(item)
+		if !ok {
+			continue
+		}
+
+		if err != nil {
+			s.err = err
+			return
+		}
+
+		switch s.method {
+		case Eq, In:
+		default:
+			s.err = fmt.Errorf("value source %s only support eq,in", item)
+			return
+		}
+
+		s.sources = append(s.sources, vs)
+	}
+}
+
+func (s *Section) sourceOf(item string) *valueSource {
+	for _, vs := range s.sources {
+		if vs.raw == item {
+			return vs
+		}
+	}
+	return nil
+}
@@ -53,11 +53,11 @@ func (fsm *StringFSM) Getter(key string) string {
 		return fsm.data
 	}
 
-	if key[sz-1] != ']' {
+	n := len(key)
+	if key[n-1] != ']' {
 		return fsm.data
 	}
 
-	n := len(key)
 	if n < 3 {
 		return fsm.data
 	}
@@ -7,6 +7,7 @@ const (
 	Stopped
 	Cleaned
 	Done
+	Archived
 )
 
 type ErrNo int8
@@ -56,3 +56,12 @@ func StateByInfo(fi os.FileInfo) (atime, mtime, ctime time.Time, size int64, err
 	ctime = time.Unix(int64(stat.Ctim.Sec), int64(stat.Ctim.Nsec))
 	return
 }
+
+// FileIdentity 文件所在设备和inode
+func FileIdentity(fi os.FileInfo) (dev, ino uint64) {
+	stat, ok := fi.Sys().(*syscall.Stat_t)
+	if !ok {
+		return 0, 0
+	}
+	return uint64(stat.Dev), uint64(stat.Ino)
+}
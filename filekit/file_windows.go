@@ -39,6 +39,11 @@ func StateByInfo(fi os.FileInfo) (atime, mtime, ctime time.Time, size int64, err
 	return
 }
 
+// FileIdentity windows 不支持 使用路径作为标识
+func FileIdentity(fi os.FileInfo) (dev, ino uint64) {
+	return 0, 0
+}
+
 func OpenFile(filename string) (*os.File, error) {
 	r, e := openWinFile(filename, os.O_RDONLY, 0)
 	if e != nil {
@@ -15,10 +15,13 @@ type LineKV struct {
 }
 
 type Line struct {
-	File string // file
-	Size int    // The size of the file
-	Text []byte // The contents of the file
-	Json *jsonkit.FastJSON
+	File   string            `json:"file"`   // file
+	Offset int64             `json:"offset"` // The offset of the first line in the file
+	Size   int               `json:"size"`   // The size of the file
+	Text   []byte            `json:"text"`   // The contents of the file
+	Json   *jsonkit.FastJSON `json:"-"`
+	Fields map[string]string `json:"fields,omitempty"` // parsed fields
+	acks   []func()
 }
 
 func (line *Line) Type() lua.LValueType                   { return lua.LTObject }
@@ -106,6 +109,7 @@ func (line *Line) Int(path string) int {
 func (line *Line) InfoL(L *lua.LState) int {
 	kv := lua.NewUserKV()
 	kv.Set("file", lua.LString(line.File))
+	kv.Set("offset", lua.LNumber(line.Offset))
 	kv.Set("size", lua.LInt(line.Size))
 	kv.Set("text", lua.LString(cast.B2S(line.Text)))
 	L.Push(kv)
@@ -113,6 +117,9 @@ func (line *Line) InfoL(L *lua.LState) int {
 }
 
 func (line *Line) Index(L *lua.LState, key string) lua.LValue {
+	if v, ok := line.Fields[key]; ok {
+		return lua.S2L(v)
+	}
 	return line.FastJSON().Index(L, key)
 }
 func (line *Line) NewIndex(L *lua.LState, key string, val lua.LValue) {
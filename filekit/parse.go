@@ -0,0 +1,152 @@
+package filekit
+
+import (
+	"errors"
+	"fmt"
+	"path/filepath"
+	"strings"
+	"sync/atomic"
+)
+
+// 内置的日志格式
+const (
+	FormatSyslog  = "syslog" // 自动识别 rfc3164 rfc5424
+	FormatRFC3164 = "rfc3164"
+	FormatRFC5424 = "rfc5424"
+	FormatNginx   = "nginx"  // combined
+	FormatApache  = "apache" // combined
+	FormatLogfmt  = "logfmt"
+	FormatCSV     = "csv"
+	FormatGrok    = "grok"
+	FormatAuditd  = "auditd"
+)
+
+// ErrSkip 不需要输出的行 如 csv 的表头
+var ErrSkip = errors.New("skip line")
+
+// Parser 将一行解析为字段
+type Parser interface {
+	Parse(line *Line) (map[string]string, error)
+}
+
+// Resetter 按文件缓存状态的解析器 文件轮转或者清理后丢弃该文件的状态
+type Resetter interface {
+	Reset(file string)
+}
+
+// ParserConfig 解析配置 target 为文件通配 为空时匹配所有文件 不含路径时匹配文件名
+// grok: pattern 为表达式 patterns 为自定义模式 "NAME regex"
+// csv: header 为空时使用文件第一行 comma 默认为 ,
+type ParserConfig struct {
+	Target   string   `lua:"target"`
+	Format   string   `lua:"format"`
+	Pattern  string   `lua:"pattern"`
+	Patterns []string `lua:"patterns"`
+	Header   []string `lua:"header"`
+	Comma    string   `lua:"comma"`
+}
+
+func (cfg *ParserConfig) Match(file string) bool {
+	if cfg.Target == "" || cfg.Target == "*" {
+		return true
+	}
+
+	name := file
+	if !strings.ContainsAny(cfg.Target, `/\`) {
+		name = filepath.Base(file)
+	}
+
+	ok, _ := filepath.Match(cfg.Target, name)
+	return ok
+}
+
+func NewParser(cfg *ParserConfig) (Parser, error) {
+	switch cfg.Format {
+	case FormatSyslog, FormatRFC3164, FormatRFC5424:
+		return Syslog(cfg.Format), nil
+	case FormatNginx, FormatApache:
+		return Combined{}, nil
+	case FormatLogfmt:
+		return Logfmt{}, nil
+	case FormatAuditd:
+		return Auditd{}, nil
+	case FormatCSV:
+		return NewCSV(cfg)
+	case FormatGrok:
+		return NewGrok(cfg.Pattern, cfg.Patterns...)
+	default:
+		return nil, fmt.Errorf("not support parser format %s", cfg.Format)
+	}
+}
+
+type parser struct {
+	cfg  *ParserConfig
+	p    Parser
+	ok   uint64
+	fail uint64
+}
+
+// ParseStat 解析统计
+type ParseStat struct {
+	Target string `json:"target"`
+	Format string `json:"format"`
+	Ok     uint64 `json:"ok"`
+	Fail   uint64 `json:"fail"`
+}
+
+// prepare 编译解析配置
+func (ft *FileTail) prepare() error {
+	ft.private.parsers = nil
+	for _, cfg := range ft.setting.Parser {
+		p, err := NewParser(cfg)
+		if err != nil {
+			return err
+		}
+		ft.private.parsers = append(ft.private.parsers, &parser{cfg: cfg, p: p})
+	}
+	return nil
+}
+
+// parse 按文件选择第一个匹配的解析器 返回 ErrSkip 时丢弃该行
+func (ft *FileTail) parse(line *Line) error {
+	for _, p := range ft.private.parsers {
+		if !p.cfg.Match(line.File) {
+			continue
+		}
+
+		fields, err := p.p.Parse(line)
+		switch {
+		case err == nil:
+			atomic.AddUint64(&p.ok, 1)
+			line.Fields = fields
+		case errors.Is(err, ErrSkip):
+		default:
+			atomic.AddUint64(&p.fail, 1)
+		}
+		return err
+	}
+	return nil
+}
+
+// reset 丢弃解析器中该文件的缓存
+func (ft *FileTail) reset(file string) {
+	for _, p := range ft.private.parsers {
+		if r, ok := p.p.(Resetter); ok {
+			r.Reset(file)
+		}
+	}
+}
+
+// Parsed 每个解析器成功和失败的次数
+func (ft *FileTail) Parsed() []ParseStat {
+	stats := make([]ParseStat, len(ft.private.parsers))
+	for i, p := range ft.private.parsers {
+		stats[i] = ParseStat{
+			Target: p.cfg.Target,
+			Format: p.cfg.Format,
+			Ok:     atomic.LoadUint64(&p.ok),
+			Fail:   atomic.LoadUint64(&p.fail),
+		}
+	}
+	return stats
+}
@@ -0,0 +1,483 @@
+package filekit
+
+import (
+	"bufio"
+	"encoding/csv"
+	"fmt"
+	"github.com/vela-public/onekit/cast"
+	"io"
+	"strconv"
+	"strings"
+	"sync"
+)
+
+// Syslog rfc3164 rfc5424 为 syslog 时自动识别
+type Syslog string
+
+func (s Syslog) Parse(line *Line) (map[string]string, error) {
+	text := cast.B2S(line.Text)
+	fields := make(map[string]string)
+	rest, err := priority(text, fields)
+	if err != nil {
+		return nil, err
+	}
+
+	switch string(s) {
+	case FormatRFC3164:
+		err = rfc3164(rest, fields)
+	case FormatRFC5424:
+		err = rfc5424(rest, fields)
+	default:
+		if rest != "" && rest[0] >= '1' && rest[0] <= '9' && fields["priority"] != "" {
+			err = rfc5424(rest, fields)
+		} else {
+			err = rfc3164(rest, fields)
+		}
+	}
+
+	if err != nil {
+		return nil, err
+	}
+	return fields, nil
+}
+
+// priority <PRI> 计算 facility severity rfc3164 中可以省略
+func priority(text string, fields map[string]string) (string, error) {
+	if text == "" || text[0] != '<' {
+		return text, nil
+	}
+
+	end := strings.IndexByte(text, '>')
+	if end < 2 || end > 4 {
+		return "", fmt.Errorf("invalid syslog priority")
+	}
+
+	pri, err := strconv.Atoi(text[1:end])
+	if err != nil || pri > 191 {
+		return "", fmt.Errorf("invalid syslog priority %s", text[1:end])
+	}
+
+	fields["priority"] = text[1:end]
+	fields["facility"] = strconv.Itoa(pri / 8)
+	fields["severity"] = strconv.Itoa(pri % 8)
+	return text[end+1:], nil
+}
+
+// token 按空格切分出第一个字段
+func token(text string) (string, string) {
+	text = strings.TrimLeft(text, " ")
+	idx := strings.IndexByte(text, ' ')
+	if idx < 0 {
+		return text, ""
+	}
+	return text[:idx], text[idx+1:]
+}
+
+// rfc3164 Mmm dd hh:mm:ss host tag[pid]: msg
+func rfc3164(text string, fields map[string]string) error {
+	switch {
+	case len(text) >= 16 && text[3] == ' ' && text[6] == ' ' && text[9] == ':' && text[12] == ':':
+		fields["timestamp"] = text[:15]
+		text = text[16:]
+	default:
+		// rsyslog 等使用 rfc3339 时间
+		ts, rest := token(text)
+		if len(ts) < 19 || ts[4] != '-' || ts[10] != 'T' {
+			return fmt.Errorf("invalid rfc3164 timestamp")
+		}
+		fields["timestamp"] = ts
+		text = rest
+	}
+
+	host, rest := token(text)
+	if host == "" {
+		return fmt.Errorf("invalid rfc3164 hostname")
+	}
+	fields["hostname"] = host
+
+	tag, msg, ok := strings.Cut(rest, ": ")
+	if !ok || strings.ContainsRune(tag, ' ') {
+		fields["message"] = rest
+		return nil
+	}
+
+	if i := strings.IndexByte(tag, '['); i > 0 && tag[len(tag)-1] == ']' {
+		fields["pid"] = tag[i+1 : len(tag)-1]
+		tag = tag[:i]
+	}
+
+	fields["app"] = tag
+	fields["message"] = msg
+	return nil
+}
+
+// rfc5424 VERSION TIMESTAMP HOSTNAME APP-NAME PROCID MSGID [SD] MSG
+func rfc5424(text string, fields map[string]string) error {
+	names := []string{"version", "timestamp", "hostname", "app", "pid", "msgid"}
+	for _, name := range names {
+		var item string
+		item, text = token(text)
+		if item == "" {
+			return fmt.Errorf("invalid rfc5424 %s", name)
+		}
+
+		if item != "-" {
+			fields[name] = item
+		}
+	}
+
+	text = strings.TrimLeft(text, " ")
+	switch {
+	case strings.HasPrefix(text, "-"):
+		text = text[1:]
+	case strings.HasPrefix(text, "["):
+		n, err := structured(text, fields)
+		if err != nil {
+			return err
+		}
+		fields["structured"] = text[:n]
+		text = text[n:]
+	default:
+		return fmt.Errorf("invalid rfc5424 structured data")
+	}
+
+	text = strings.TrimPrefix(strings.TrimLeft(text, " "), "\ufeff")
+	if text != "" {
+		fields["message"] = text
+	}
+	return nil
+}
+
+// structured [id key="val" ...][id ...] 参数保存为 id.key 返回结构化数据的长度
+func structured(text string, fields map[string]string) (int, error) {
+	i := 0
+	for i < len(text) && text[i] == '[' {
+		end := -1
+		quote := false
+		for j := i + 1; j < len(text); j++ {
+			switch {
+			case text[j] == '\\' && quote:
+				j++
+			case text[j] == '"':
+				quote = !quote
+			case text[j] == ']' && !quote:
+				end = j
+			}
+
+			if end > 0 {
+				break
+			}
+		}
+
+		if end < 0 {
+			return 0, fmt.Errorf("invalid rfc5424 structured data")
+		}
+
+		id, params := token(text[i+1 : end])
+		pairs(params, func(key, val string) {
+			fields[id+"."+key] = val
+		})
+		i = end + 1
+	}
+	return i, nil
+}
+
+// unquote 读取引号中的值 返回值和结束位置
+func unquote(text string, q byte) (string, int) {
+	var buf strings.Builder
+	for i := 1; i < len(text); i++ {
+		c := text[i]
+		switch {
+		case c == q:
+			return buf.String(), i + 1
+		case c == '\\' && i+1 < len(text):
+			i++
+			switch text[i] {
+			case 'n':
+				buf.WriteByte('\n')
+			case 't':
+				buf.WriteByte('\t')
+			case 'r':
+				buf.WriteByte('\r')
+			default:
+				buf.WriteByte(text[i])
+			}
+		default:
+			buf.WriteByte(c)
+		}
+	}
+	return buf.String(), len(text)
+}
+
+// pairs key=value 值可以使用单引号或者双引号 只有 key 时值为 true
+func pairs(text string, fn func(key, val string)) int {
+	n := 0
+	for {
+		text = strings.TrimLeft(text, " \t")
+		if text == "" {
+			return n
+		}
+
+		end := strings.IndexAny(text, "= \t")
+		if end < 0 {
+			fn(text, "true")
+			return n + 1
+		}
+
+		key := text[:end]
+		if text[end] != '=' {
+			if key != "" {
+				fn(key, "true")
+				n++
+			}
+			text = text[end:]
+			continue
+		}
+
+		text = text[end+1:]
+		var val string
+		switch {
+		case text == "":
+		case text[0] == '"' || text[0] == '\'':
+			var sz int
+			val, sz = unquote(text, text[0])
+			text = text[sz:]
+		default:
+			sz := strings.IndexAny(text, " \t")
+			if sz < 0 {
+				sz = len(text)
+			}
+			val, text = text[:sz], text[sz:]
+		}
+
+		if key != "" {
+			fn(key, val)
+			n++
+		}
+	}
+}
+
+// Combined nginx apache 的 combined 格式 common 格式缺少后两个字段
+type Combined struct{}
+
+var combined = []string{
+	"remote_addr", "ident", "remote_user", "time_local", "request",
+	"status", "body_bytes_sent", "http_referer", "http_user_agent",
+}
+
+func (Combined) Parse(line *Line) (map[string]string, error) {
+	text := cast.B2S(line.Text)
+	var items []string
+	for {
+		text = strings.TrimLeft(text, " ")
+		if text == "" {
+			break
+		}
+
+		switch text[0] {
+		case '"':
+			val, sz := unquote(text, '"')
+			items = append(items, val)
+			text = text[sz:]
+		case '[':
+			end := strings.IndexByte(text, ']')
+			if end < 0 {
+				return nil, fmt.Errorf("invalid combined time")
+			}
+			items = append(items, text[1:end])
+			text = text[end+1:]
+		default:
+			var item string
+			item, text = token(text)
+			items = append(items, item)
+		}
+	}
+
+	if len(items) < 7 {
+		return nil, fmt.Errorf("invalid combined fields %d", len(items))
+	}
+
+	if _, err := strconv.Atoi(items[5]); err != nil {
+		return nil, fmt.Errorf("invalid combined status %s", items[5])
+	}
+
+	fields := make(map[string]string, len(items)+3)
+	for i, item := range items {
+		if i < len(combined) {
+			fields[combined[i]] = item
+		} else {
+			fields["extra_"+strconv.Itoa(i-len(combined)+1)] = item
+		}
+	}
+
+	method, rest, _ := strings.Cut(fields["request"], " ")
+	uri, proto, _ := strings.Cut(rest, " ")
+	fields["method"] = method
+	fields["uri"] = uri
+	fields["protocol"] = proto
+	return fields, nil
+}
+
+// Logfmt key=value key="value with space"
+type Logfmt struct{}
+
+func (Logfmt) Parse(line *Line) (map[string]string, error) {
+	fields := make(map[string]string)
+	n := pairs(cast.B2S(line.Text), func(key, val string) {
+		fields[key] = val
+	})
+
+	if n == 0 {
+		return nil, fmt.Errorf("invalid logfmt")
+	}
+	return fields, nil
+}
+
+// Auditd type=SYSCALL msg=audit(1364481363.243:24287): arch=c000003e ... msg='op=login acct="root"'
+type Auditd struct{}
+
+func (Auditd) Parse(line *Line) (map[string]string, error) {
+	fields := make(map[string]string)
+	var fn func(key, val string)
+	fn = func(key, val string) {
+		if key != "msg" {
+			fields[key] = val
+			return
+		}
+
+		if strings.HasPrefix(val, "audit(") {
+			stamp := strings.TrimSuffix(strings.TrimSuffix(val[6:], ":"), ")")
+			ts, serial, _ := strings.Cut(stamp, ":")
+			fields["timestamp"] = ts
+			fields["serial"] = serial
+			return
+		}
+
+		//用户态消息 msg='op=... acct="root"'
+		fields[key] = val
+		pairs(val, fn)
+	}
+
+	pairs(cast.B2S(line.Text), fn)
+	if fields["type"] == "" || fields["serial"] == "" {
+		return nil, fmt.Errorf("invalid auditd record")
+	}
+	return fields, nil
+}
+
+// CSV 未配置表头时使用文件第一行
+type CSV struct {
+	header []string
+	comma  rune
+	mutex  sync.Mutex
+	files  map[string][]string
+}
+
+func (c *CSV) decode(text string) ([]string, error) {
+	r := csv.NewReader(strings.NewReader(text))
+	r.Comma = c.comma
+	r.FieldsPerRecord = -1
+	r.LazyQuotes = true
+	return r.Read()
+}
+
+// first 从文件读取表头 断点续读时第一行已经跳过
+func (c *CSV) first(file string) ([]string, error) {
+	f, err := OpenFile(file)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	var r io.Reader = f
+	if codec := Sniff(f); codec != "" {
+		rc, e := Decompress(f, codec)
+		if e != nil {
+			return nil, e
+		}
+		defer rc.Close()
+		r = rc
+	}
+
+	text, err := bufio.NewReader(r).ReadString('\n')
+	if err != nil && text == "" {
+		return nil, err
+	}
+	return c.decode(strings.TrimRight(text, "\r\n"))
+}
+
+func (c *CSV) columns(line *Line, row []string) ([]string, bool, error) {
+	if len(c.header) > 0 {
+		skip := line.Offset == 0 && strings.Join(row, ",") == strings.Join(c.header, ",")
+		return c.header, skip, nil
+	}
+
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+
+	//文件第一行总是表头 文件被截断或者替换后重新读取
+	if line.Offset == 0 {
+		c.files[line.File] = row
+		return row, true, nil
+	}
+
+	if header, ok := c.files[line.File]; ok {
+		return header, false, nil
+	}
+
+	header, err := c.first(line.File)
+	if err != nil {
+		return nil, false, err
+	}
+	c.files[line.File] = header
+	return header, false, nil
+}
+
+func (c *CSV) Reset(file string) {
+	c.mutex.Lock()
+	delete(c.files, file)
+	c.mutex.Unlock()
+}
+
+func (c *CSV) Parse(line *Line) (map[string]string, error) {
+	row, err := c.decode(cast.B2S(line.Text))
+	if err != nil {
+		return nil, err
+	}
+
+	header, skip, err := c.columns(line, row)
+	if err != nil {
+		return nil, err
+	}
+
+	if skip {
+		return nil, ErrSkip
+	}
+
+	fields := make(map[string]string, len(row))
+	for i, val := range row {
+		if i < len(header) {
+			fields[header[i]] = val
+		} else {
+			fields["col_"+strconv.Itoa(i+1)] = val
+		}
+	}
+	return fields, nil
+}
+
+func NewCSV(cfg *ParserConfig) (*CSV, error) {
+	c := &CSV{
+		header: cfg.Header,
+		comma:  ',',
+		files:  make(map[string][]string),
+	}
+
+	if cfg.Comma != "" {
+		r := []rune(cfg.Comma)
+		if len(r) != 1 {
+			return nil, fmt.Errorf("invalid csv comma %s", cfg.Comma)
+		}
+		c.comma = r[0]
+	}
+	return c, nil
+}
@@ -0,0 +1,136 @@
+package filekit
+
+import (
+	"fmt"
+	"github.com/vela-public/onekit/cast"
+	"regexp"
+	"strconv"
+	"strings"
+)
+
+// GrokPatterns 内置的 grok 模式 不包含捕获分组
+var GrokPatterns = map[string]string{
+	"USERNAME":          `[a-zA-Z0-9._-]+`,
+	"USER":              `%{USERNAME}`,
+	"INT":               `(?:[+-]?(?:[0-9]+))`,
+	"BASE10NUM":         `(?:[+-]?(?:[0-9]+(?:\.[0-9]+)?|\.[0-9]+))`,
+	"NUMBER":            `%{BASE10NUM}`,
+	"POSINT":            `\b(?:[1-9][0-9]*)\b`,
+	"NONNEGINT":         `\b(?:[0-9]+)\b`,
+	"WORD":              `\b\w+\b`,
+	"NOTSPACE":          `\S+`,
+	"SPACE":             `\s*`,
+	"DATA":              `.*?`,
+	"GREEDYDATA":        `.*`,
+	"QUOTEDSTRING":      `(?:"(?:[^"\\]|\\.)*"|'(?:[^'\\]|\\.)*')`,
+	"UUID":              `[A-Fa-f0-9]{8}-(?:[A-Fa-f0-9]{4}-){3}[A-Fa-f0-9]{12}`,
+	"IPV4":              `(?:(?:25[0-5]|2[0-4][0-9]|1?[0-9]?[0-9])\.){3}(?:25[0-5]|2[0-4][0-9]|1?[0-9]?[0-9])`,
+	"IPV6":              `(?:[0-9A-Fa-f]{0,4}:){2,7}[0-9A-Fa-f]{0,4}`,
+	"IP":                `(?:%{IPV6}|%{IPV4})`,
+	"HOSTNAME":          `\b(?:[0-9A-Za-z][0-9A-Za-z-]{0,62})(?:\.(?:[0-9A-Za-z][0-9A-Za-z-]{0,62}))*\.?`,
+	"IPORHOST":          `(?:%{IP}|%{HOSTNAME})`,
+	"HOSTPORT":          `%{IPORHOST}:%{POSINT}`,
+	"PATH":              `(?:/[^\s]*)+`,
+	"URIPATH":           `(?:/[A-Za-z0-9$.+!*'(){},~:;=@#%&_\-]*)+`,
+	"URIPARAM":          `\?[A-Za-z0-9$.+!*'|(){},~@#%&/=:;_?\-\[\]<>]*`,
+	"URIPATHPARAM":      `%{URIPATH}(?:%{URIPARAM})?`,
+	"MONTH":             `\b(?:Jan(?:uary)?|Feb(?:ruary)?|Mar(?:ch)?|Apr(?:il)?|May|Jun(?:e)?|Jul(?:y)?|Aug(?:ust)?|Sep(?:tember)?|Oct(?:ober)?|Nov(?:ember)?|Dec(?:ember)?)\b`,
+	"MONTHNUM":          `(?:0?[1-9]|1[0-2])`,
+	"MONTHDAY":          `(?:(?:0[1-9])|(?:[12][0-9])|(?:3[01])|[1-9])`,
+	"YEAR":              `(?:\d\d){1,2}`,
+	"HOUR":              `(?:2[0123]|[01]?[0-9])`,
+	"MINUTE":            `(?:[0-5][0-9])`,
+	"SECOND":            `(?:(?:[0-5]?[0-9]|60)(?:[:.,][0-9]+)?)`,
+	"TIME":              `%{HOUR}:%{MINUTE}(?::%{SECOND})?`,
+	"ISO8601_TIMEZONE":  `(?:Z|[+-]%{HOUR}(?::?%{MINUTE}))`,
+	"TIMESTAMP_ISO8601": `%{YEAR}-%{MONTHNUM}-%{MONTHDAY}[T ]%{HOUR}:?%{MINUTE}(?::?%{SECOND})?%{ISO8601_TIMEZONE}?`,
+	"HTTPDATE":          `%{MONTHDAY}/%{MONTH}/%{YEAR}:%{TIME} [+-]?\d{4}`,
+	"SYSLOGTIMESTAMP":   `%{MONTH} +%{MONTHDAY} %{TIME}`,
+	"LOGLEVEL":          `(?i:trace|debug|info|notice|warn(?:ing)?|err(?:or)?|crit(?:ical)?|fatal|severe|emerg(?:ency)?|alert)`,
+	"EMAILADDRESS":      `[a-zA-Z0-9_.+-]+@[a-zA-Z0-9-]+(?:\.[a-zA-Z0-9-]+)*`,
+}
+
+var grokRef = regexp.MustCompile(`%\{(\w+)(?::([\w.\-\[\]@]+))?(?::\w+)?}`)
+
+// Grok %{PATTERN:field} 表达式 命名的模式输出为字段
+type Grok struct {
+	re    *regexp.Regexp
+	names map[string]string
+}
+
+func (g *Grok) Parse(line *Line) (map[string]string, error) {
+	match := g.re.FindStringSubmatchIndex(cast.B2S(line.Text))
+	if match == nil {
+		return nil, fmt.Errorf("grok not match")
+	}
+
+	fields := make(map[string]string, len(g.names))
+	for i, sub := range g.re.SubexpNames() {
+		name, ok := g.names[sub]
+		if !ok || match[2*i] < 0 {
+			continue
+		}
+		fields[name] = string(line.Text[match[2*i]:match[2*i+1]])
+	}
+	return fields, nil
+}
+
+// NewGrok patterns 为自定义模式 格式为 "NAME regex"
+func NewGrok(pattern string, patterns ...string) (*Grok, error) {
+	if pattern == "" {
+		return nil, fmt.Errorf("grok not found pattern")
+	}
+
+	lib := make(map[string]string, len(GrokPatterns)+len(patterns))
+	for k, v := range GrokPatterns {
+		lib[k] = v
+	}
+
+	for _, item := range patterns {
+		name, expr, ok := strings.Cut(strings.TrimSpace(item), " ")
+		if !ok {
+			return nil, fmt.Errorf("invalid grok pattern %s", item)
+		}
+		lib[name] = strings.TrimSpace(expr)
+	}
+
+	g := &Grok{names: make(map[string]string)}
+	var err error
+	var expand func(string, int) string
+	expand = func(expr string, depth int) string {
+		if depth > 16 {
+			err = fmt.Errorf("grok pattern too deep %s", expr)
+			return expr
+		}
+
+		return grokRef.ReplaceAllStringFunc(expr, func(ref string) string {
+			sub := grokRef.FindStringSubmatch(ref)
+			body, ok := lib[sub[1]]
+			if !ok {
+				err = fmt.Errorf("grok not found pattern %s", sub[1])
+				return ref
+			}
+
+			body = expand(body, depth+1)
+			if sub[2] == "" {
+				return "(?:" + body + ")"
+			}
+
+			//字段名不一定符合正则分组名 使用序号代替
+			group := "g" + strconv.Itoa(len(g.names)+1)
+			g.names[group] = sub[2]
+			return "(?P<" + group + ">" + body + ")"
+		})
+	}
+
+	expr := expand(pattern, 0)
+	if err != nil {
+		return nil, err
+	}
+
+	g.re, err = regexp.Compile(expr)
+	if err != nil {
+		return nil, fmt.Errorf("grok compile fail %v", err)
+	}
+	return g, nil
+}
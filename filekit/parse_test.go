@@ -0,0 +1,189 @@
+package filekit
+
+import (
+	"context"
+	"errors"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestParseFormat(t *testing.T) {
+	cases := []struct {
+		name string
+		cfg  ParserConfig
+		text string
+		want map[string]string
+		fail bool
+	}{
+		{
+			name: "rfc3164",
+			cfg:  ParserConfig{Format: FormatSyslog},
+			text: "<34>Oct 11 22:14:15 mymachine su[230]: 'su root' failed",
+			want: map[string]string{"priority": "34", "facility": "4", "severity": "2", "timestamp": "Oct 11 22:14:15",
+				"hostname": "mymachine", "app": "su", "pid": "230", "message": "'su root' failed"},
+		},
+		{
+			name: "rfc5424",
+			cfg:  ParserConfig{Format: FormatSyslog},
+			text: `<165>1 2003-10-11T22:14:15.003Z host evntslog - ID47 [exampleSDID@32473 iut="3" eventID="1011"] An application event`,
+			want: map[string]string{"version": "1", "hostname": "host", "app": "evntslog", "msgid": "ID47",
+				"exampleSDID@32473.iut": "3", "exampleSDID@32473.eventID": "1011", "message": "An application event"},
+		},
+		{
+			name: "rfc5424 strict",
+			cfg:  ParserConfig{Format: FormatRFC5424},
+			text: "<34>Oct 11 22:14:15 mymachine su: failed",
+			fail: true,
+		},
+		{
+			name: "nginx",
+			cfg:  ParserConfig{Format: FormatNginx},
+			text: `127.0.0.1 - frank [10/Oct/2000:13:55:36 -0700] "GET /a.gif?x=1 HTTP/1.0" 200 2326 "http://example.com/" "Mozilla/4.08"`,
+			want: map[string]string{"remote_addr": "127.0.0.1", "remote_user": "frank", "time_local": "10/Oct/2000:13:55:36 -0700",
+				"method": "GET", "uri": "/a.gif?x=1", "protocol": "HTTP/1.0", "status": "200", "body_bytes_sent": "2326",
+				"http_referer": "http://example.com/", "http_user_agent": "Mozilla/4.08"},
+		},
+		{
+			name: "apache bad status",
+			cfg:  ParserConfig{Format: FormatApache},
+			text: `127.0.0.1 - - [10/Oct/2000:13:55:36 -0700] "GET / HTTP/1.0" ok 1`,
+			fail: true,
+		},
+		{
+			name: "logfmt",
+			cfg:  ParserConfig{Format: FormatLogfmt},
+			text: `level=info msg="hello world" path='/a b' debug`,
+			want: map[string]string{"level": "info", "msg": "hello world", "path": "/a b", "debug": "true"},
+		},
+		{
+			name: "csv header",
+			cfg:  ParserConfig{Format: FormatCSV, Header: []string{"a", "b"}, Comma: ";"},
+			text: `1;"x;y";3`,
+			want: map[string]string{"a": "1", "b": "x;y", "col_3": "3"},
+		},
+		{
+			name: "grok",
+			cfg:  ParserConfig{Format: FormatGrok, Pattern: `%{IP:client} %{WORD:method} %{URIPATHPARAM:request} %{CODE:code}`, Patterns: []string{"CODE [A-Z]{3}"}},
+			text: "55.3.244.1 GET /index.html?a=1 ABC",
+			want: map[string]string{"client": "55.3.244.1", "method": "GET", "request": "/index.html?a=1", "code": "ABC"},
+		},
+		{
+			name: "auditd",
+			cfg:  ParserConfig{Format: FormatAuditd},
+			text: `type=USER_LOGIN msg=audit(1364481363.243:24287): pid=1 uid=0 msg='op=login acct="root" res=success'`,
+			want: map[string]string{"type": "USER_LOGIN", "timestamp": "1364481363.243", "serial": "24287",
+				"pid": "1", "op": "login", "acct": "root", "res": "success"},
+		},
+		{
+			name: "auditd invalid",
+			cfg:  ParserConfig{Format: FormatAuditd},
+			text: `pid=1 uid=0`,
+			fail: true,
+		},
+	}
+
+	for _, c := range cases {
+		p, err := NewParser(&c.cfg)
+		if err != nil {
+			t.Fatalf("%s new parser %v", c.name, err)
+		}
+
+		fields, err := p.Parse(&Line{File: "/var/log/app.log", Offset: 10, Text: []byte(c.text)})
+		if c.fail {
+			if err == nil {
+				t.Fatalf("%s want error got %v", c.name, fields)
+			}
+			continue
+		}
+
+		if err != nil {
+			t.Fatalf("%s %v", c.name, err)
+		}
+
+		for k, v := range c.want {
+			if fields[k] != v {
+				t.Fatalf("%s field %s got %q want %q all %v", c.name, k, fields[k], v, fields)
+			}
+		}
+	}
+}
+
+// 未配置表头时使用文件第一行 第一行重新出现时更新表头
+func TestParseCSVHeader(t *testing.T) {
+	dir := t.TempDir()
+	path := filepath.Join(dir, "a.csv")
+	if err := os.WriteFile(path, []byte("a,b\n1,2\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	c, _ := NewCSV(&ParserConfig{})
+	parse := func(offset int64, text string) (map[string]string, error) {
+		return c.Parse(&Line{File: path, Offset: offset, Text: []byte(text)})
+	}
+
+	// 断点续读 从文件读取表头
+	if fields, err := parse(4, "1,2"); err != nil || fields["a"] != "1" || fields["b"] != "2" {
+		t.Fatalf("resume got %v %v", fields, err)
+	}
+
+	// 文件被替换 新的表头
+	if _, err := parse(0, "x,y"); !errors.Is(err, ErrSkip) {
+		t.Fatalf("header got %v", err)
+	}
+
+	if fields, _ := parse(4, "1,2"); fields["x"] != "1" || fields["y"] != "2" {
+		t.Fatalf("replaced got %v", fields)
+	}
+
+	// 轮转后丢弃缓存 重新从文件读取
+	c.Reset(path)
+	if fields, _ := parse(4, "1,2"); fields["a"] != "1" {
+		t.Fatalf("reset got %v", fields)
+	}
+}
+
+func TestParseTarget(t *testing.T) {
+	ft := NewTail("test")
+	ft.setting.Parser = []*ParserConfig{
+		{Target: "*.csv", Format: FormatCSV, Header: []string{"a"}},
+		{Target: "/var/log/*", Format: FormatLogfmt},
+	}
+
+	if err := ft.prepare(); err != nil {
+		t.Fatal(err)
+	}
+
+	line := &Line{File: "/tmp/x.csv", Offset: 0, Text: []byte("a")}
+	if err := ft.parse(line); !errors.Is(err, ErrSkip) {
+		t.Fatalf("csv header got %v", err)
+	}
+
+	line = &Line{File: "/var/log/app.log", Offset: 5, Text: []byte("k=v")}
+	if err := ft.parse(line); err != nil || line.Fields["k"] != "v" {
+		t.Fatalf("logfmt got %v %v", line.Fields, err)
+	}
+
+	line = &Line{File: "/opt/app.log", Offset: 5, Text: []byte("k=v")}
+	if err := ft.parse(line); err != nil || line.Fields != nil {
+		t.Fatalf("unmatched got %v %v", line.Fields, err)
+	}
+
+	stats := ft.Parsed()
+	if stats[0].Ok != 0 || stats[1].Ok != 1 {
+		t.Fatalf("got %+v", stats)
+	}
+}
+
+// 解析配置错误时启动失败
+func TestPrepareParserFail(t *testing.T) {
+	ft := NewTail("test")
+	ft.setting.Parser = []*ParserConfig{{Format: FormatGrok}}
+	if err := ft.Prepare(context.Background()); err == nil {
+		t.Fatal("want prepare error")
+	}
+
+	if err := ft.Background(context.Background()); err == nil {
+		t.Fatal("want start error")
+	}
+}
@@ -1,8 +1,10 @@
 package filekit
 
 import (
+	"encoding/json"
 	"github.com/vela-public/onekit/bucket"
 	"go.etcd.io/bbolt"
+	"sync"
 )
 
 type Seeker interface {
@@ -29,6 +31,75 @@ func (s *SeekDB) Find(file string) (int64, error) {
 	return seek, nil
 }
 
+// identity 按文件标识保存的读取记录
+func (s *SeekDB) identity() *bucket.Bucket[string] {
+	names := make([]string, 0, len(s.bucket)+1)
+	names = append(names, s.bucket...)
+	return bucket.Pack[string](s.db, append(names, "identity")...)
+}
+
+func (s *SeekDB) Store(rec *Record) error {
+	text, err := json.Marshal(rec)
+	if err != nil {
+		return err
+	}
+	return s.identity().SetText(rec.Key(), string(text))
+}
+
+func (s *SeekDB) Load(key string) (*Record, error) {
+	var err error
+	text := s.identity().GetText(key, func(e error) { err = e })
+	if err != nil || text == "" {
+		return nil, err
+	}
+
+	rec := &Record{}
+	if err = json.Unmarshal([]byte(text), rec); err != nil {
+		return nil, err
+	}
+	return rec, nil
+}
+
+func (s *SeekDB) Remove(key string) error {
+	return s.identity().Delete(key)
+}
+
+// Records 直接遍历 identity bucket 记录为json文本 不能使用 bucket.ForEach
+func (s *SeekDB) Records() ([]*Record, error) {
+	var records []*Record
+	err := s.db.View(func(tx *bbolt.Tx) error {
+		var bkt *bbolt.Bucket
+		for i, name := range append(append([]string{}, s.bucket...), "identity") {
+			if i == 0 {
+				bkt = tx.Bucket([]byte(name))
+			} else {
+				bkt = bkt.Bucket([]byte(name))
+			}
+
+			if bkt == nil {
+				return nil
+			}
+		}
+
+		return bkt.ForEach(func(k, v []byte) error {
+			if v == nil {
+				return nil
+			}
+
+			rec := &Record{}
+			if e := json.Unmarshal(v, rec); e == nil {
+				records = append(records, rec)
+			}
+			return nil
+		})
+	})
+	return records, err
+}
+
+func (s *SeekDB) Forget(file string) error {
+	return bucket.Pack[int64](s.db, s.bucket...).Delete(file)
+}
+
 func NewSeekDB(db *bbolt.DB, bucket ...string) *SeekDB {
 	return &SeekDB{
 		db:     db,
@@ -37,21 +108,69 @@ func NewSeekDB(db *bbolt.DB, bucket ...string) *SeekDB {
 }
 
 type SeekMem struct {
-	seek map[string]int64
+	mutex  sync.Mutex
+	seek   map[string]int64
+	record map[string]Record
 }
 
 func (s *SeekMem) Save(file string, offset int64) error {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
 	s.seek[file] = offset
 	return nil
 }
 
 func (s *SeekMem) Find(file string) (int64, error) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
 	v := s.seek[file]
 	return v, nil
 }
 
+func (s *SeekMem) Store(rec *Record) error {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	s.record[rec.Key()] = *rec
+	return nil
+}
+
+func (s *SeekMem) Load(key string) (*Record, error) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	rec, ok := s.record[key]
+	if !ok {
+		return nil, nil
+	}
+	return &rec, nil
+}
+
+func (s *SeekMem) Remove(key string) error {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	delete(s.record, key)
+	return nil
+}
+
+func (s *SeekMem) Records() ([]*Record, error) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	records := make([]*Record, 0, len(s.record))
+	for _, rec := range s.record {
+		records = append(records, &rec)
+	}
+	return records, nil
+}
+
+func (s *SeekMem) Forget(file string) error {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	delete(s.seek, file)
+	return nil
+}
+
 func NewSeekMem() *SeekMem {
 	return &SeekMem{
-		seek: make(map[string]int64),
+		seek:   make(map[string]int64),
+		record: make(map[string]Record),
 	}
 }
@@ -2,6 +2,7 @@ package filekit
 
 import (
 	"context"
+	"errors"
 	"fmt"
 	"github.com/vela-public/onekit/cast"
 	"github.com/vela-public/onekit/cond"
@@ -46,6 +47,13 @@ type FileTail struct {
 		Drop     *cond.Ignore
 		SkipFile []func(string) bool
 		Seeker   Seeker
+		events   chan Event
+		lost     int32 // 事件队列满时丢弃的标记
+		parsers  []*parser
+		inflight chan struct{}
+		spill    *gopool.Queue[[]byte]
+
+		collected time.Time
 	}
 }
 
@@ -80,7 +88,17 @@ func (ft *FileTail) Input(line *Line) {
 		ft.Decode(line)
 	}
 
+	if err := ft.parse(line); errors.Is(err, ErrSkip) {
+		line.Ack()
+		return
+	}
+
 	if ft.private.Drop.Match(line) {
+		line.Ack()
+		return
+	}
+
+	if !ft.acquire(line) {
 		return
 	}
 
@@ -147,12 +165,10 @@ func (ft *FileTail) WaitFor(callback func() (stop bool)) {
 	}
 }
 
-func (ft *FileTail) invoke(line *Line) {
-	ft.private.Chain.Invoke(line)
-	ft.private.Switch.Invoke(line)
-}
-
-func (ft *FileTail) Prepare(parent context.Context) {
+func (ft *FileTail) Prepare(parent context.Context) error {
+	if err := ft.prepare(); err != nil {
+		return fmt.Errorf("%s parser prepare fail %v", ft.Name(), err)
+	}
 
 	//初始化context
 	ft.private.context,
@@ -160,9 +176,16 @@ func (ft *FileTail) Prepare(parent context.Context) {
 
 	ft.private.limit = NewLimit(ft.private.context, ft.setting.Limit)
 	ft.private.history = make(map[string]*Section)
+	ft.private.events = make(chan Event, 1024)
 
-	queue := gopool.NewQueue[*Line](ft.private.context, gopool.Workers(ft.setting.Thread))
+	ft.private.inflight = make(chan struct{}, max(ft.setting.Cache, 1))
+	if ft.setting.Spill != "" {
+		ft.private.spill = ft.NewSpill()
+	}
+
+	queue := gopool.NewQueue[*Line](ft.private.context, gopool.Workers(ft.setting.Thread), gopool.Cache(ft.setting.Cache))
 	queue.HandlerFunc(func(pkt *gopool.Packet[*Line]) {
+		defer ft.release()
 		ft.invoke(pkt.Data)
 	})
 
@@ -171,18 +194,22 @@ func (ft *FileTail) Prepare(parent context.Context) {
 	})
 
 	ft.private.queue = queue
-
+	return nil
 }
 
 func (ft *FileTail) clean(data map[string]*Section) {
 	for filename, s := range data {
-		if s.flag == Running { // Prevent slow reading speed
+		if s.status() == Running { // Prevent slow reading speed
 			ft.private.history[filename] = s
 			continue
 		}
 
 		s.close()
-		s.flag = Cleaned
+		if s.multi != nil {
+			s.multi.Stop()
+		}
+		ft.reset(s.path)
+		s.mark(Cleaned)
 		ft.Errorf("clean %s", s.path)
 	}
 }
@@ -223,6 +250,7 @@ func (ft *FileTail) GlobFor() {
 
 	ft.clean(ft.private.history)
 	ft.private.history = history
+	ft.collect()
 }
 
 func (ft *FileTail) Detect(history map[string]*Section, file string) {
@@ -248,6 +276,10 @@ func (ft *FileTail) Detect(history map[string]*Section, file string) {
 			tail: ft,
 			path: filename,
 		}
+
+		if m := ft.setting.Multiline; m != nil {
+			s.multi = newMultiline(ft, m)
+		}
 		history[filename] = s
 	} else {
 		history[filename] = s
@@ -257,21 +289,22 @@ func (ft *FileTail) Detect(history map[string]*Section, file string) {
 }
 
 func (ft *FileTail) scanner() {
-	tk := time.NewTicker(time.Duration(ft.setting.Poll) * time.Second)
-	defer tk.Stop()
-
 	//首次打开 无需等待
 	ft.GlobFor()
 
-	for {
-		select {
-		case <-ft.Done():
-			ft.Errorf("%s watch exit", ft.Name())
-			return
-		case <-tk.C:
-			ft.GlobFor()
-		}
+	if !ft.setting.Inotify {
+		ft.poll()
+		return
+	}
+
+	w, err := newWatcher(ft)
+	if err != nil {
+		ft.Errorf("%s inotify fail %v fallback poll", ft.Name(), err)
+		ft.poll()
+		return
 	}
+
+	ft.notice(w)
 }
 
 func (ft *FileTail) Background(ctx context.Context) error {
@@ -279,7 +312,10 @@ func (ft *FileTail) Background(ctx context.Context) error {
 		return err
 	}
 
-	ft.Prepare(ctx)
+	if err := ft.Prepare(ctx); err != nil {
+		return err
+	}
+
 	go ft.scanner()
 	return nil
 }
@@ -289,7 +325,10 @@ func (ft *FileTail) Run(ctx context.Context) error {
 		return err
 	}
 
-	ft.Prepare(ctx)
+	if err := ft.Prepare(ctx); err != nil {
+		return err
+	}
+
 	ft.scanner()
 	return nil
 }
@@ -0,0 +1,179 @@
+package filekit
+
+import (
+	"encoding/json"
+	"github.com/vela-public/go-diskqueue"
+	"github.com/vela-public/onekit/gopool"
+	"path/filepath"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// tracker 单个文件的确认状态 所有handler处理完成后才提交该行的偏移
+// 行可能乱序完成 只提交连续确认的最大位置
+type tracker struct {
+	tail   *FileTail
+	rec    Record
+	mutex  sync.Mutex
+	seq    uint64
+	low    uint64
+	ends   map[uint64]int64
+	acked  map[uint64]bool
+	commit int64
+	count  int
+	stamp  time.Time
+	done   bool
+}
+
+func (t *tracker) snapshot() Record {
+	rec := t.rec
+	rec.Offset = t.commit
+	rec.Done = t.done && t.low == t.seq
+	return rec
+}
+
+// track 登记一行 end 为该行结束的位置 返回确认函数
+func (t *tracker) track(end int64) func() {
+	t.mutex.Lock()
+	seq := t.seq
+	t.seq++
+	t.ends[seq] = end
+	t.mutex.Unlock()
+
+	var once sync.Once
+	return func() {
+		once.Do(func() { t.ack(seq) })
+	}
+}
+
+func (t *tracker) ack(seq uint64) {
+	t.mutex.Lock()
+	t.acked[seq] = true
+	for t.acked[t.low] {
+		t.commit = t.ends[t.low]
+		delete(t.acked, t.low)
+		delete(t.ends, t.low)
+		t.low++
+	}
+
+	//全部确认 每200行 或者超过1s 保存一次
+	t.count++
+	flush := t.low == t.seq || t.count >= 200 || time.Since(t.stamp) > time.Second
+	if flush {
+		t.count = 0
+		t.stamp = time.Now()
+	}
+	rec := t.snapshot()
+	t.mutex.Unlock()
+
+	if flush {
+		t.tail.Store(&rec)
+	}
+}
+
+// finish 读取暂停 已读取的行全部确认时提交到 end
+func (t *tracker) finish(end int64, done bool) {
+	t.mutex.Lock()
+	t.done = done
+	if t.low == t.seq && end > t.commit {
+		t.commit = end
+	}
+	rec := t.snapshot()
+	t.mutex.Unlock()
+
+	t.tail.Store(&rec)
+}
+
+func newTracker(s *Section, offset int64) *tracker {
+	return &tracker{
+		tail:   s.tail,
+		rec:    *s.record(offset),
+		commit: offset,
+		stamp:  time.Now(),
+		ends:   make(map[uint64]int64),
+		acked:  make(map[uint64]bool),
+	}
+}
+
+// Ack 所有handler处理完成 确认该行
+func (line *Line) Ack() {
+	for _, fn := range line.acks {
+		fn()
+	}
+	line.acks = nil
+}
+
+// acquire 占用队列位置 队列已满时读取暂停 开启落盘时写入磁盘队列
+func (ft *FileTail) acquire(line *Line) bool {
+	select {
+	case ft.private.inflight <- struct{}{}:
+		return true
+	default:
+	}
+
+	if spill := ft.private.spill; spill != nil {
+		err := ft.spill(spill, line)
+		if err == nil {
+			//已经落盘 可以提交偏移
+			line.Ack()
+			return false
+		}
+		ft.Errorf("%s spill fail %v", line.File, err)
+	}
+
+	ft.Debugf("%s queue full pause", ft.Name())
+	select {
+	case ft.private.inflight <- struct{}{}:
+		return true
+	case <-ft.Done():
+		return false
+	}
+}
+
+// spill 直接写入磁盘队列 失败时不能确认该行
+func (ft *FileTail) spill(queue *gopool.Queue[[]byte], line *Line) error {
+	text, err := json.Marshal(line)
+	if err != nil {
+		return err
+	}
+	return queue.PushE(text)
+}
+
+func (ft *FileTail) release() {
+	<-ft.private.inflight
+}
+
+// NewSpill 内存队列满时写入磁盘 重启后继续处理
+func (ft *FileTail) NewSpill() *gopool.Queue[[]byte] {
+	logf := func(level diskqueue.LogLevel, format string, v ...any) {
+		if level >= diskqueue.ERROR {
+			ft.Errorf(format, v...)
+		}
+	}
+
+	queue := gopool.NewDiskQueue(ft.private.context, gopool.Workers(4),
+		gopool.DiskSpace(ft.Name(), filepath.Clean(ft.setting.Spill),
+			1<<30, 64<<20, 1, 16<<20, 1000, 2*time.Second, logf))
+
+	queue.HandlerFunc(func(pkt *gopool.Packet[[]byte]) {
+		line := &Line{}
+		if err := json.Unmarshal(pkt.Data, line); err != nil {
+			ft.Errorf("%s spill unmarshal fail %v", ft.Name(), err)
+			return
+		}
+		ft.invoke(line)
+	})
+
+	queue.SetErrHandler(func(err error) {
+		ft.Errorf("%v", err)
+	})
+	return queue
+}
+
+func (ft *FileTail) invoke(line *Line) {
+	ft.private.Chain.InvokeGo(line)
+	ft.private.Switch.Invoke(line)
+	line.Ack()
+	atomic.AddInt64(&ft.datalog.done, 1)
+}
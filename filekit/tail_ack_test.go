@@ -0,0 +1,182 @@
+package filekit
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func newAckSection(t *testing.T, ft *FileTail, path string) *Section {
+	t.Helper()
+	id := touch(t, path, "line-1\nline-2\nline-3\n")
+	file, err := os.Open(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { file.Close() })
+	return &Section{tail: ft, path: path, id: id, file: file}
+}
+
+func committed(tr *tracker) int64 {
+	tr.mutex.Lock()
+	defer tr.mutex.Unlock()
+	return tr.commit
+}
+
+// 行乱序完成 只提交连续确认的位置
+func TestTrackerOutOfOrder(t *testing.T) {
+	ft, _ := newTestTail(t)
+	seek := ft.private.Seeker.(*SeekMem)
+	s := newAckSection(t, ft, filepath.Join(t.TempDir(), "app.log"))
+	tr := newTracker(s, 0)
+
+	ack1 := tr.track(7)
+	ack2 := tr.track(14)
+	ack3 := tr.track(21)
+
+	steps := []struct {
+		ack  func()
+		want int64
+	}{
+		{ack3, 0},
+		{ack3, 0}, //重复确认
+		{ack1, 7},
+		{ack2, 21},
+	}
+
+	for i, step := range steps {
+		step.ack()
+		if got := committed(tr); got != step.want {
+			t.Fatalf("step %d commit %d want %d", i, got, step.want)
+		}
+	}
+
+	// 全部确认后保存
+	rec, _ := seek.Load(s.id.Key())
+	if rec == nil || rec.Offset != 21 {
+		t.Fatalf("stored %+v want offset 21", rec)
+	}
+
+	// 未全部确认时 finish 不越过未确认的行
+	ack4 := tr.track(28)
+	tr.finish(35, false)
+	if got := committed(tr); got != 21 {
+		t.Fatalf("finish commit %d want 21", got)
+	}
+
+	ack4()
+	tr.finish(35, false)
+	if got := committed(tr); got != 35 {
+		t.Fatalf("finish commit %d want 35", got)
+	}
+}
+
+// 合并后的多行记录处理完成时确认所有原始行
+func TestMultilineAck(t *testing.T) {
+	ft, c := newTestTail(t)
+	s := newAckSection(t, ft, filepath.Join(t.TempDir(), "app.log"))
+	tr := newTracker(s, 0)
+	m := newMultiline(ft, &Multiline{Regex: `^\S`})
+
+	input := []struct {
+		text string
+		end  int64
+	}{
+		{"error: boom", 12},
+		{"  at main.go:1", 27},
+		{"  at main.go:2", 42},
+		{"info: next", 53},
+	}
+
+	for _, in := range input {
+		m.Add(&Line{File: s.path, Text: []byte(in.text), acks: []func(){tr.track(in.end)}})
+	}
+
+	lines := c.wait(t, 1)
+	if lines[0] != "error: boom\n  at main.go:1\n  at main.go:2" {
+		t.Fatalf("got %q", lines[0])
+	}
+	waitCommit(t, tr, 42)
+
+	m.Flush()
+	c.wait(t, 2)
+	waitCommit(t, tr, 53)
+}
+
+func waitCommit(t *testing.T, tr *tracker, want int64) {
+	t.Helper()
+	deadline := time.Now().Add(2 * time.Second)
+	for time.Now().Before(deadline) {
+		if committed(tr) == want {
+			return
+		}
+		time.Sleep(5 * time.Millisecond)
+	}
+	t.Fatalf("commit %d want %d", committed(tr), want)
+}
+
+// 文件重新打开后使用新的 tracker 旧文件迟到的确认不影响新文件的记录
+func TestTrackerReopen(t *testing.T) {
+	ft, _ := newTestTail(t)
+	seek := ft.private.Seeker.(*SeekMem)
+	dir := t.TempDir()
+	path := filepath.Join(dir, "app.log")
+
+	s := newAckSection(t, ft, path)
+	old := s.id
+	prev := newTracker(s, 0)
+	late := prev.track(7)
+
+	if err := os.Rename(path, path+".1"); err != nil {
+		t.Fatal(err)
+	}
+	next := newAckSection(t, ft, path)
+	s.id, s.file = next.id, next.file
+	tr := newTracker(s, 0)
+	tr.track(5)()
+
+	late()
+
+	if rec, _ := seek.Load(old.Key()); rec == nil || rec.Offset != 7 {
+		t.Fatalf("old record %+v want offset 7", rec)
+	}
+
+	if rec, _ := seek.Load(next.id.Key()); rec == nil || rec.Offset != 5 {
+		t.Fatalf("new record %+v want offset 5", rec)
+	}
+}
+
+// 落盘失败时不确认该行 等待队列空出位置
+func TestSpillFail(t *testing.T) {
+	ft, _ := newTestTail(t)
+	ft.setting.Spill = t.TempDir()
+	ft.private.inflight = make(chan struct{}, 1)
+	ft.private.inflight <- struct{}{}
+
+	acked := 0
+	line := func() *Line {
+		return &Line{Text: []byte("line-1"), acks: []func(){func() { acked++ }}}
+	}
+
+	spill := ft.NewSpill()
+	ft.private.spill = spill
+	if ft.acquire(line()) || acked != 1 {
+		t.Fatalf("spill acked %d want 1", acked)
+	}
+
+	spill.Stop()
+	result := make(chan bool, 1)
+	go func() { result <- ft.acquire(line()) }()
+
+	select {
+	case <-result:
+		t.Fatal("acquire returned while queue full")
+	case <-time.After(50 * time.Millisecond):
+	}
+
+	ft.release()
+	if ok := <-result; !ok || acked != 1 {
+		t.Fatalf("acquire %v acked %d", ok, acked)
+	}
+}
@@ -0,0 +1,165 @@
+package filekit
+
+import (
+	"bytes"
+	"compress/bzip2"
+	"compress/gzip"
+	"fmt"
+	"github.com/klauspost/compress/zstd"
+	"io"
+	"os"
+	"time"
+)
+
+// 解压模式 auto 根据文件头自动识别 指定格式时只解压该格式的文件
+const (
+	CodecNone  = "none"
+	CodecAuto  = "auto"
+	CodecGzip  = "gzip"
+	CodecZstd  = "zstd"
+	CodecBzip2 = "bzip2"
+)
+
+// SeekDone Seeker 不支持 Recorder 时 压缩文件读取完成的标记
+const SeekDone int64 = -1
+
+var magics = []struct {
+	codec string
+	magic []byte
+}{
+	{CodecGzip, []byte{0x1f, 0x8b}},
+	{CodecZstd, []byte{0x28, 0xb5, 0x2f, 0xfd}},
+	{CodecBzip2, []byte("BZh")},
+}
+
+func CodecBad(mode string) error {
+	switch mode {
+	case "", CodecNone, CodecAuto, CodecGzip, CodecZstd, CodecBzip2:
+		return nil
+	default:
+		return fmt.Errorf("invalid decompress mode %s", mode)
+	}
+}
+
+// Sniff 根据文件头识别压缩格式 未压缩返回空
+func Sniff(r io.ReaderAt) string {
+	head := make([]byte, 4)
+	n, _ := r.ReadAt(head, 0)
+	for _, m := range magics {
+		if bytes.HasPrefix(head[:n], m.magic) {
+			return m.codec
+		}
+	}
+	return ""
+}
+
+// Decompress 按格式返回解压后的数据流
+func Decompress(r io.Reader, codec string) (io.ReadCloser, error) {
+	switch codec {
+	case CodecGzip:
+		return gzip.NewReader(r)
+	case CodecZstd:
+		dec, err := zstd.NewReader(r, zstd.WithDecoderConcurrency(1))
+		if err != nil {
+			return nil, err
+		}
+		return dec.IOReadCloser(), nil
+	case CodecBzip2:
+		return io.NopCloser(bzip2.NewReader(r)), nil
+	default:
+		return nil, fmt.Errorf("not support codec %s", codec)
+	}
+}
+
+// codec 当前文件需要使用的解压格式
+func (s *Section) codec(file *os.File) string {
+	mode := s.tail.setting.Decompress
+	if mode == "" || mode == CodecNone {
+		return ""
+	}
+
+	codec := Sniff(file)
+	if mode == CodecAuto || mode == codec {
+		return codec
+	}
+	return ""
+}
+
+// archive 压缩文件只读取一次 偏移为解压后的位置 读完后记录完成标记
+func (s *Section) archive(file *os.File, codec string) bool {
+	stat, err := file.Stat()
+	if err != nil {
+		file.Close()
+		s.mark(Paused)
+		s.info = err
+		s.tail.Errorf("%s stat fail %v", s.path, err)
+		return true
+	}
+
+	s.id = NewIdentity(s.path, stat)
+	var offset int64
+	if rec := s.tail.Load(s.id); rec != nil && s.same(file, rec) {
+		if rec.Done {
+			file.Close()
+			s.done = true
+			s.time = time.Now()
+			s.mark(Archived)
+			s.tail.Debugf("%s %s archive done", s.path, codec)
+			return true
+		}
+		offset = rec.Offset
+	}
+
+	r, err := Decompress(file, codec)
+	if err == nil && offset > 0 {
+		_, err = io.CopyN(io.Discard, r, offset)
+	}
+
+	if err != nil {
+		file.Close()
+		s.mark(Stopped)
+		s.info = err
+		s.tail.Errorf("%s %s decompress fail %v", s.path, codec, err)
+		return true
+	}
+
+	s.tail.Debugf("%s %s archive follow %d", s.path, codec, offset)
+	s.seek = offset
+	s.file = file
+	s.unzip = r
+	s.end = offset
+	s.track = newTracker(s, offset)
+	s.time = time.Now()
+	s.mark(Running)
+	go s.line()
+	return true
+}
+
+// rearchive 已读完的压缩文件被替换后重新读取
+func (s *Section) rearchive() {
+	stat, err := os.Stat(s.path)
+	if err != nil {
+		return
+	}
+
+	if NewIdentity(s.path, stat).Same(s.id) && !stat.ModTime().After(s.time) {
+		return
+	}
+
+	s.done = false
+	s.reload()
+}
+
+// same 压缩文件的头部指纹是否与记录一致
+func (s *Section) same(file *os.File, rec *Record) bool {
+	if rec.Head == 0 {
+		return true
+	}
+
+	hash, err := Fingerprint(file, rec.Head)
+	if err != nil || hash != rec.Hash {
+		s.tail.Debugf("%s archive replaced fingerprint %s != %s", s.path, hash, rec.Hash)
+		return false
+	}
+	return true
+}
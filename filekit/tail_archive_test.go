@@ -0,0 +1,151 @@
+package filekit
+
+import (
+	"bytes"
+	"compress/gzip"
+	"encoding/base64"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/klauspost/compress/zstd"
+)
+
+// bzip2 标准库只支持解压 python bz2 生成
+var bzip2Data = map[string]string{
+	"line-1\nline-2\nline-3\nline-4\nline-5\n": "QlpoOTFBWSZTWR72HJAAAAzZAAAQAAI+AAIlIAAhFQMj1CAaaaK1vlWlpEieSJ8XckU4UJAe9hyQ",
+	"next-1\nnext-2\n":                         "QlpoOTFBWSZTWdsGcpwAAARZgAAQAAIwAAIBBEAgADEMCBKGjIkzRnEIeLuSKcKEhtgzlOA=",
+}
+
+func compress(t *testing.T, codec string, text string) []byte {
+	t.Helper()
+	var buf bytes.Buffer
+	switch codec {
+	case CodecGzip:
+		w := gzip.NewWriter(&buf)
+		w.Write([]byte(text))
+		w.Close()
+	case CodecZstd:
+		w, err := zstd.NewWriter(&buf)
+		if err != nil {
+			t.Fatal(err)
+		}
+		w.Write([]byte(text))
+		w.Close()
+	case CodecBzip2:
+		data, err := base64.StdEncoding.DecodeString(bzip2Data[text])
+		if err != nil {
+			t.Fatal(err)
+		}
+		buf.Write(data)
+	}
+	return buf.Bytes()
+}
+
+// waitDone 等待压缩文件的完成标记
+func waitDone(t *testing.T, seek *SeekMem, path string) *Record {
+	t.Helper()
+	fi, err := os.Stat(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	key := NewIdentity(path, fi).Key()
+	deadline := time.Now().Add(2 * time.Second)
+	for time.Now().Before(deadline) {
+		if rec, _ := seek.Load(key); rec != nil && rec.Done {
+			return rec
+		}
+		time.Sleep(5 * time.Millisecond)
+	}
+	t.Fatalf("%s not done", path)
+	return nil
+}
+
+// 压缩文件从解压后的偏移继续读取 读完后不再重复读取 替换后重新读取
+func TestArchiveResume(t *testing.T) {
+	text := "line-1\nline-2\nline-3\nline-4\nline-5\n"
+	for _, codec := range []string{CodecGzip, CodecZstd, CodecBzip2} {
+		t.Run(codec, func(t *testing.T) {
+			dir := t.TempDir()
+			path := filepath.Join(dir, "app.log."+codec)
+			if err := os.WriteFile(path, compress(t, codec, text), 0644); err != nil {
+				t.Fatal(err)
+			}
+
+			ft, c := newTestTail(t, filepath.Join(dir, "*"))
+			ft.setting.Decompress = CodecAuto
+			seek := ft.private.Seeker.(*SeekMem)
+
+			fi, _ := os.Stat(path)
+			_ = seek.Store(&Record{Identity: NewIdentity(path, fi), Offset: int64(len("line-1\nline-2\n"))})
+
+			ft.GlobFor()
+			if lines := sorted(c.wait(t, 3)); strings.Join(lines, ",") != "line-3,line-4,line-5" {
+				t.Fatalf("got %q", lines)
+			}
+
+			rec := waitDone(t, seek, path)
+			if rec.Offset != int64(len(text)) {
+				t.Fatalf("done offset %d want %d", rec.Offset, len(text))
+			}
+
+			// 已读完 不重复读取
+			ft.GlobFor()
+			ft.GlobFor()
+			time.Sleep(20 * time.Millisecond)
+			if n := len(c.texts()); n != 3 {
+				t.Fatalf("reread archive got %d lines", n)
+			}
+
+			// rearchive 同一个文件被替换
+			if err := os.WriteFile(path, compress(t, codec, "next-1\nnext-2\n"), 0644); err != nil {
+				t.Fatal(err)
+			}
+			future := time.Now().Add(time.Second)
+			_ = os.Chtimes(path, future, future)
+
+			ft.GlobFor()
+			if lines := sorted(c.wait(t, 5)[3:]); strings.Join(lines, ",") != "next-1,next-2" {
+				t.Fatalf("rearchive got %q", lines)
+			}
+		})
+	}
+}
+
+// 默认不解压 指定格式时只解压该格式
+func TestArchiveCodec(t *testing.T) {
+	dir := t.TempDir()
+	path := filepath.Join(dir, "app.log.gz")
+	if err := os.WriteFile(path, compress(t, CodecGzip, "line-1\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	file, err := os.Open(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer file.Close()
+
+	cases := []struct {
+		mode string
+		want string
+	}{
+		{Default("").Decompress, ""},
+		{CodecNone, ""},
+		{CodecAuto, CodecGzip},
+		{CodecGzip, CodecGzip},
+		{CodecZstd, ""},
+	}
+
+	for _, c := range cases {
+		ft := NewTail("test")
+		ft.setting.Decompress = c.mode
+		s := &Section{tail: ft, path: path}
+		if got := s.codec(file); got != c.want {
+			t.Fatalf("mode %q got %q want %q", c.mode, got, c.want)
+		}
+	}
+}
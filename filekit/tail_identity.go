@@ -0,0 +1,342 @@
+package filekit
+
+import (
+	"encoding/hex"
+	"fmt"
+	"github.com/vela-public/onekit/todo"
+	"hash/fnv"
+	"io"
+	"os"
+	"path/filepath"
+	"time"
+)
+
+// HeadSize 文件头部指纹的最大字节数
+const HeadSize = 1024
+
+// Identity 文件标识 device+inode 不支持的平台使用路径
+type Identity struct {
+	Dev  uint64 `json:"dev"`
+	Ino  uint64 `json:"ino"`
+	Path string `json:"path"`
+}
+
+func (id Identity) Key() string {
+	if id.Dev == 0 && id.Ino == 0 {
+		return "path:" + id.Path
+	}
+	return fmt.Sprintf("inode:%d:%d", id.Dev, id.Ino)
+}
+
+func (id Identity) Same(v Identity) bool {
+	return id.Key() == v.Key()
+}
+
+func (id Identity) String() string {
+	return fmt.Sprintf("%s(%d:%d)", id.Path, id.Dev, id.Ino)
+}
+
+func NewIdentity(path string, fi os.FileInfo) Identity {
+	dev, ino := FileIdentity(fi)
+	return Identity{Dev: dev, Ino: ino, Path: path}
+}
+
+// Record 读取记录 Head: 参与指纹计算的头部字节数
+type Record struct {
+	Identity
+	Head   int    `json:"head"`
+	Hash   string `json:"hash"`
+	Offset int64  `json:"offset"`
+	Done   bool   `json:"done,omitempty"`
+}
+
+// RecordExpire 清理文件已经不存在的读取记录的间隔
+var RecordExpire = time.Hour
+
+// Recorder 按文件标识保存读取记录 Seeker 实现该接口时启用轮转检测
+// Forget: 删除旧版本按路径保存的偏移
+type Recorder interface {
+	Store(rec *Record) error
+	Load(key string) (*Record, error)
+	Remove(key string) error
+	Records() ([]*Record, error)
+	Forget(file string) error
+}
+
+// Fingerprint 文件头部 n 个字节的指纹
+func Fingerprint(r io.ReaderAt, n int) (string, error) {
+	if n <= 0 {
+		return "", nil
+	}
+
+	buf := make([]byte, n)
+	sz, err := r.ReadAt(buf, 0)
+	if sz != n {
+		if err == nil {
+			err = io.ErrUnexpectedEOF
+		}
+		return "", err
+	}
+
+	h := fnv.New64a()
+	h.Write(buf)
+	return hex.EncodeToString(h.Sum(nil)), nil
+}
+
+func (ft *FileTail) recorder() Recorder {
+	r, ok := ft.private.Seeker.(Recorder)
+	if !ok {
+		return nil
+	}
+	return r
+}
+
+// Store 保存读取记录 Seeker 不支持时按路径保存偏移
+func (ft *FileTail) Store(rec *Record) {
+	r := ft.recorder()
+	if r == nil {
+		ft.Tell(rec.Path, todo.IF(rec.Done, SeekDone, rec.Offset))
+		return
+	}
+
+	if err := r.Store(rec); err != nil {
+		ft.Errorf("%s tail save record fail %v", rec.Path, err)
+		return
+	}
+	ft.Debugf("%s tail save record:%s offset:%d", rec.Path, rec.Key(), rec.Offset)
+}
+
+// Load 查找文件的读取记录 没有标识记录时兼容旧版本以路径保存的偏移
+func (ft *FileTail) Load(id Identity) *Record {
+	r := ft.recorder()
+	if r == nil {
+		offset := ft.SeekTo(id.Path)
+		if offset == SeekDone {
+			return &Record{Identity: id, Done: true}
+		}
+		return &Record{Identity: id, Offset: offset}
+	}
+
+	rec, err := r.Load(id.Key())
+	if err != nil {
+		ft.Errorf("%s tail load record fail %v", id.Path, err)
+	}
+
+	if rec != nil {
+		return rec
+	}
+	return ft.migrate(r, id)
+}
+
+// migrate 路径没有任何标识记录时 使用一次旧版本按路径保存的偏移 然后删除
+// 已有其他标识的记录说明是轮转后的新文件 旧的偏移不再适用
+func (ft *FileTail) migrate(r Recorder, id Identity) *Record {
+	records, err := r.Records()
+	if err != nil {
+		ft.Errorf("%s tail load records fail %v", id.Path, err)
+		return nil
+	}
+
+	for _, rec := range records {
+		if rec.Path == id.Path {
+			return nil
+		}
+	}
+
+	offset := ft.SeekTo(id.Path)
+	if offset <= 0 {
+		return nil
+	}
+
+	rec := &Record{Identity: id, Offset: offset}
+	ft.Store(rec)
+	if err = r.Forget(id.Path); err != nil {
+		ft.Errorf("%s tail forget seek fail %v", id.Path, err)
+	}
+	return rec
+}
+
+// collect 删除文件已经不存在的读取记录 间隔 RecordExpire
+func (ft *FileTail) collect() {
+	r := ft.recorder()
+	if r == nil {
+		return
+	}
+
+	now := time.Now()
+	if now.Sub(ft.private.collected) < RecordExpire {
+		return
+	}
+	ft.private.collected = now
+
+	records, err := r.Records()
+	if err != nil {
+		ft.Errorf("%s tail load records fail %v", ft.Name(), err)
+		return
+	}
+
+	dirs := make(map[string]map[string]bool)
+	for _, rec := range records {
+		if exists(rec.Identity, dirs) {
+			continue
+		}
+
+		if err = r.Remove(rec.Key()); err != nil {
+			ft.Errorf("%s tail remove record fail %v", rec.Path, err)
+			continue
+		}
+		ft.Debugf("%s tail remove record:%s", rec.Path, rec.Key())
+	}
+}
+
+// exists 文件是否存在 轮转后的文件按标识在同一目录中查找 dirs 缓存目录中的标识
+func exists(id Identity, dirs map[string]map[string]bool) bool {
+	if id.Dev == 0 && id.Ino == 0 {
+		_, err := os.Stat(id.Path)
+		return err == nil
+	}
+
+	dir := filepath.Dir(id.Path)
+	keys, ok := dirs[dir]
+	if !ok {
+		keys = make(map[string]bool)
+		entries, err := os.ReadDir(dir)
+		if err != nil && !os.IsNotExist(err) {
+			//目录暂时无法读取 保留记录
+			return true
+		}
+
+		for _, entry := range entries {
+			if fi, e := entry.Info(); e == nil && !fi.IsDir() {
+				keys[NewIdentity(filepath.Join(dir, entry.Name()), fi).Key()] = true
+			}
+		}
+		dirs[dir] = keys
+	}
+	return keys[id.Key()]
+}
+
+// record 生成当前文件的读取记录
+func (s *Section) record(offset int64) *Record {
+	rec := &Record{Identity: s.id, Offset: offset, Done: s.done}
+	if s.file == nil {
+		return rec
+	}
+
+	stat, err := s.file.Stat()
+	if err != nil {
+		return rec
+	}
+
+	head := int(min(stat.Size(), HeadSize))
+	if hash, e := Fingerprint(s.file, head); e == nil {
+		rec.Head = head
+		rec.Hash = hash
+	}
+	return rec
+}
+
+// verify 根据记录判断文件是否被截断或者替换 返回可以继续读取的位置
+func (s *Section) verify(file *os.File, rec *Record, size int64) int64 {
+	if rec == nil {
+		return 0
+	}
+
+	if rec.Offset > size {
+		s.tail.Debugf("%s truncated offset:%d size:%d", s.path, rec.Offset, size)
+		return 0
+	}
+
+	if rec.Head == 0 {
+		return rec.Offset
+	}
+
+	if int64(rec.Head) > size {
+		s.tail.Debugf("%s truncated head:%d size:%d", s.path, rec.Head, size)
+		return 0
+	}
+
+	hash, err := Fingerprint(file, rec.Head)
+	if err != nil {
+		s.tail.Errorf("%s fingerprint fail %v", s.path, err)
+		return rec.Offset
+	}
+
+	if hash != rec.Hash {
+		s.tail.Debugf("%s truncated or replaced fingerprint %s != %s", s.path, hash, rec.Hash)
+		return 0
+	}
+	return rec.Offset
+}
+
+// rotated 在同一目录中查找被重命名的旧文件
+func (s *Section) rotated(old Identity) string {
+	dir := filepath.Dir(s.path)
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		return ""
+	}
+
+	for _, entry := range entries {
+		if entry.IsDir() {
+			continue
+		}
+
+		fi, e := entry.Info()
+		if e != nil {
+			continue
+		}
+
+		path := filepath.Join(dir, entry.Name())
+		if NewIdentity(path, fi).Same(old) {
+			return path
+		}
+	}
+	return ""
+}
+
+// drain 文件被重命名后 读取旧文件剩余内容再切换到新文件
+func (s *Section) drain(old Identity) {
+	path := s.rotated(old)
+	if path == "" {
+		s.tail.Debugf("%s rotated %s not found", s.path, old)
+		return
+	}
+
+	file, err := OpenFile(path)
+	if err != nil {
+		s.tail.Errorf("%s open rotated %s fail %v", s.path, path, err)
+		return
+	}
+	defer file.Close()
+
+	stat, err := file.Stat()
+	if err != nil {
+		return
+	}
+
+	rec := s.tail.Load(old)
+	offset := s.verify(file, rec, stat.Size())
+	if offset == stat.Size() {
+		return
+	}
+
+	if _, err = file.Seek(offset, io.SeekStart); err != nil {
+		s.tail.Errorf("%s seek rotated %s fail %v", s.path, path, err)
+		return
+	}
+
+	s.tail.Debugf("%s drain rotated %s from %d to %d", s.path, path, offset, stat.Size())
+	prev, track := s.file, s.track
+	s.file = file
+	s.id = old
+	s.end = offset
+	s.track = newTracker(s, offset)
+	s.read()
+	if s.multi != nil {
+		s.multi.Flush()
+	}
+	s.commit()
+	s.file, s.track = prev, track
+	s.tail.reset(path)
+}
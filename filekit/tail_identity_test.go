@@ -0,0 +1,163 @@
+package filekit
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"go.etcd.io/bbolt"
+)
+
+func touch(t *testing.T, path string, text string) Identity {
+	t.Helper()
+	if err := os.WriteFile(path, []byte(text), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	fi, err := os.Stat(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return NewIdentity(path, fi)
+}
+
+func newRecordTail(seek Seeker) *FileTail {
+	ft := NewTail("test")
+	ft.private.Seeker = seek
+	return ft
+}
+
+// 旧版本的偏移只在路径没有任何标识记录时使用一次
+func TestLoadLegacy(t *testing.T) {
+	dir := t.TempDir()
+	path := filepath.Join(dir, "app.log")
+	id := touch(t, path, "0123456789\n")
+
+	seek := NewSeekMem()
+	_ = seek.Save(path, 5)
+	ft := newRecordTail(seek)
+
+	rec := ft.Load(id)
+	if rec == nil || rec.Offset != 5 {
+		t.Fatalf("got %+v want offset 5", rec)
+	}
+
+	if offset, _ := seek.Find(path); offset != 0 {
+		t.Fatalf("legacy offset %d not removed", offset)
+	}
+
+	if rec, _ = seek.Load(id.Key()); rec == nil || rec.Offset != 5 {
+		t.Fatalf("migrated record got %+v", rec)
+	}
+
+	// 轮转后的新文件不使用旧的偏移
+	if err := os.Rename(path, path+".1"); err != nil {
+		t.Fatal(err)
+	}
+	next := touch(t, path, "new\n")
+	_ = seek.Save(path, 7)
+
+	if rec = ft.Load(next); rec != nil {
+		t.Fatalf("rotated file got %+v want nil", rec)
+	}
+
+	if rec = ft.Load(id); rec == nil || rec.Offset != 5 {
+		t.Fatalf("rotated record got %+v", rec)
+	}
+}
+
+func TestCollect(t *testing.T) {
+	dir := t.TempDir()
+	seek := NewSeekMem()
+	ft := newRecordTail(seek)
+
+	alive := touch(t, filepath.Join(dir, "alive.log"), "a")
+	rotated := touch(t, filepath.Join(dir, "rotated.log"), "b")
+	if err := os.Rename(rotated.Path, rotated.Path+".1"); err != nil {
+		t.Fatal(err)
+	}
+	deleted := touch(t, filepath.Join(dir, "deleted.log"), "c")
+	if err := os.Remove(deleted.Path); err != nil {
+		t.Fatal(err)
+	}
+
+	pathAlive := Identity{Path: alive.Path}
+	pathGone := Identity{Path: filepath.Join(dir, "gone.log")}
+	dirGone := Identity{Dev: alive.Dev, Ino: alive.Ino + 1<<40, Path: filepath.Join(dir, "missing", "x.log")}
+
+	for _, id := range []Identity{alive, rotated, deleted, pathAlive, pathGone, dirGone} {
+		_ = seek.Store(&Record{Identity: id, Offset: 1})
+	}
+
+	ft.collect()
+
+	cases := []struct {
+		id   Identity
+		keep bool
+	}{
+		{alive, true},
+		{rotated, true},
+		{deleted, false},
+		{pathAlive, true},
+		{pathGone, false},
+		{dirGone, false},
+	}
+
+	for _, c := range cases {
+		rec, _ := seek.Load(c.id.Key())
+		if (rec != nil) != c.keep {
+			t.Fatalf("%s got %+v want keep %v", c.id, rec, c.keep)
+		}
+	}
+
+	// 间隔内不再清理
+	_ = seek.Store(&Record{Identity: deleted})
+	ft.collect()
+	if rec, _ := seek.Load(deleted.Key()); rec == nil {
+		t.Fatal("collected within RecordExpire")
+	}
+}
+
+func TestSeekDBRecords(t *testing.T) {
+	db, err := bbolt.Open(filepath.Join(t.TempDir(), "seek.db"), 0600, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer db.Close()
+
+	seek := NewSeekDB(db, "tail", "test")
+	if records, e := seek.Records(); e != nil || len(records) != 0 {
+		t.Fatalf("empty got %v %v", records, e)
+	}
+
+	a := Identity{Dev: 1, Ino: 2, Path: "/a"}
+	b := Identity{Path: "/b"}
+	_ = seek.Store(&Record{Identity: a, Offset: 10})
+	_ = seek.Store(&Record{Identity: b, Offset: 20})
+	_ = seek.Save("/a", 30)
+
+	records, err := seek.Records()
+	if err != nil || len(records) != 2 {
+		t.Fatalf("got %v %v", records, err)
+	}
+
+	if err = seek.Remove(a.Key()); err != nil {
+		t.Fatal(err)
+	}
+
+	if rec, _ := seek.Load(a.Key()); rec != nil {
+		t.Fatalf("removed got %+v", rec)
+	}
+
+	if err = seek.Forget("/a"); err != nil {
+		t.Fatal(err)
+	}
+
+	if offset, _ := seek.Find("/a"); offset != 0 {
+		t.Fatalf("forget got %d", offset)
+	}
+
+	if records, _ = seek.Records(); len(records) != 1 || records[0].Offset != 20 {
+		t.Fatalf("got %v", records)
+	}
+}
@@ -77,6 +77,21 @@ func (l *LazyFileTail) Output(v any, options ...func(*pipe.HandleEnv)) *LazyFile
 	return l
 }
 
+func (l *LazyFileTail) Multiline(m Multiline) *LazyFileTail {
+	l.tail.setting.Multiline = &m
+	return l
+}
+
+func (l *LazyFileTail) Decompress(mode string) *LazyFileTail {
+	l.tail.setting.Decompress = mode
+	return l
+}
+
+func (l *LazyFileTail) Parser(cfg ...*ParserConfig) *LazyFileTail {
+	l.tail.setting.Parser = append(l.tail.setting.Parser, cfg...)
+	return l
+}
+
 func (l *LazyFileTail) Db(db *bbolt.DB) *LazyFileTail {
 	l.tail.private.Seeker = NewSeekDB(db, "SHM_FILE_RECORD")
 	return l
@@ -0,0 +1,166 @@
+package filekit
+
+import (
+	"fmt"
+	"github.com/vela-public/onekit/grep"
+	"regexp"
+	"sync"
+	"time"
+)
+
+const (
+	MultiStart    = "start"    // 匹配的行开始一条新记录 其余行追加到上一条
+	MultiContinue = "continue" // 匹配的行追加到上一条 其余行开始新记录
+)
+
+// Multiline 多行合并 如 java 堆栈 python traceback 格式化的json
+// grep 与 regex 二选一 negate 取反匹配结果
+// timeout 毫秒 最后一条记录超时未收到新行时输出 为0时读到文件末尾立即输出
+type Multiline struct {
+	Grep     string `lua:"grep"`
+	Regex    string `lua:"regex"`
+	Mode     string `lua:"mode"`
+	Negate   bool   `lua:"negate"`
+	MaxLines int    `lua:"max_lines"`
+	MaxBytes int    `lua:"max_bytes"`
+	Timeout  int    `lua:"timeout"`
+}
+
+func (m *Multiline) Bad() error {
+	switch m.Mode {
+	case "", MultiStart, MultiContinue:
+	default:
+		return fmt.Errorf("multiline invalid mode %s", m.Mode)
+	}
+
+	if m.Grep == "" && m.Regex == "" {
+		return fmt.Errorf("multiline not found grep or regex")
+	}
+
+	if m.Regex != "" {
+		if _, err := regexp.Compile(m.Regex); err != nil {
+			return fmt.Errorf("multiline regex %v", err)
+		}
+	}
+	return nil
+}
+
+func (m *Multiline) compile() func(string) bool {
+	if m.Regex != "" {
+		return regexp.MustCompile(m.Regex).MatchString
+	}
+	return grep.New(m.Grep)
+}
+
+// multiline 单个文件的多行合并状态
+type multiline struct {
+	cfg   *Multiline
+	tail  *FileTail
+	match func(string) bool
+
+	mutex sync.Mutex
+	line  *Line
+	lines int
+	timer *time.Timer
+}
+
+func (m *multiline) head(v *Line) bool {
+	hit := m.match(string(v.Text)) != m.cfg.Negate
+	if m.cfg.Mode == MultiContinue {
+		return !hit
+	}
+	return hit
+}
+
+func (m *multiline) full() bool {
+	if m.cfg.MaxLines > 0 && m.lines >= m.cfg.MaxLines {
+		return true
+	}
+
+	if m.cfg.MaxBytes > 0 && m.line.Size >= m.cfg.MaxBytes {
+		return true
+	}
+	return false
+}
+
+// take 取出当前记录
+func (m *multiline) take() *Line {
+	line := m.line
+	m.line = nil
+	m.lines = 0
+	return line
+}
+
+func (m *multiline) Add(v *Line) {
+	var out []*Line
+
+	m.mutex.Lock()
+	switch {
+	case m.line == nil:
+		m.line = v
+		m.lines = 1
+	case m.head(v):
+		out = append(out, m.take())
+		m.line = v
+		m.lines = 1
+	default:
+		m.line.Text = append(append(m.line.Text, '\n'), v.Text...)
+		m.line.Size = len(m.line.Text)
+		m.line.acks = append(m.line.acks, v.acks...)
+		m.lines++
+	}
+
+	if m.full() {
+		out = append(out, m.take())
+	}
+
+	if m.line != nil && m.cfg.Timeout > 0 {
+		d := time.Duration(m.cfg.Timeout) * time.Millisecond
+		if m.timer == nil {
+			m.timer = time.AfterFunc(d, m.Flush)
+		} else {
+			m.timer.Reset(d)
+		}
+	}
+	m.mutex.Unlock()
+
+	for _, line := range out {
+		m.tail.Input(line)
+	}
+}
+
+// Flush 输出未完成的记录
+func (m *multiline) Flush() {
+	m.mutex.Lock()
+	line := m.take()
+	m.mutex.Unlock()
+
+	if line != nil {
+		m.tail.Input(line)
+	}
+}
+
+// Idle 读到文件末尾 未设置超时立即输出
+func (m *multiline) Idle() {
+	if m.cfg.Timeout > 0 {
+		return
+	}
+	m.Flush()
+}
+
+func (m *multiline) Stop() {
+	m.mutex.Lock()
+	if m.timer != nil {
+		m.timer.Stop()
+	}
+	m.mutex.Unlock()
+	m.Flush()
+}
+
+func newMultiline(tail *FileTail, cfg *Multiline) *multiline {
+	return &multiline{
+		cfg:   cfg,
+		tail:  tail,
+		match: cfg.compile(),
+	}
+}
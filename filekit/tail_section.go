@@ -16,25 +16,60 @@ type SeekInfo struct {
 
 type Section struct {
 	again bool
-	flag  ErrNo
+	flag  int32
 	info  error
 	tail  *FileTail
 	path  string
+	id    Identity
 	seek  int64
 	file  *os.File
 	time  time.Time //start time
+	at    int64     //offset of current line
+	wake  int32     //读取过程中收到的写事件
+	multi *multiline
+	unzip io.ReadCloser //压缩文件解压后的数据流
+	done  bool          //压缩文件已读完
+	end   int64         //end of current line
+	track *tracker
 }
 
-func (s *Section) open() (stop bool) {
-	if !s.follow() {
-		s.flag = Paused
-		return true
-	}
+func (s *Section) status() ErrNo {
+	return ErrNo(atomic.LoadInt32(&s.flag))
+}
+
+func (s *Section) mark(flag ErrNo) {
+	atomic.StoreInt32(&s.flag, int32(flag))
+}
+
+// counter 记录已读取的字节数 用于计算行偏移
+type counter struct {
+	r io.Reader
+	n int64
+}
+
+func (c *counter) Read(p []byte) (int, error) {
+	n, err := c.r.Read(p)
+	c.n += int64(n)
+	return n, err
+}
 
+func (s *Section) open() (stop bool) {
 	file, err := OpenFile(s.path)
 	if err != nil {
+		s.mark(Paused)
 		s.info = err
-		return !os.IsNotExist(err)
+		s.tail.Errorf("%s open fail %v", s.path, err)
+		return true
+	}
+
+	if codec := s.codec(file); codec != "" {
+		return s.archive(file, codec)
+	}
+
+	if !s.follow(file) {
+		file.Close()
+		s.mark(Paused)
+		return true
 	}
 
 	var ret int64
@@ -53,25 +88,36 @@ func (s *Section) open() (stop bool) {
 	}
 
 	s.file = file
+	s.end = ret
+	s.track = newTracker(s, ret)
 	s.time = time.Now()
+	s.mark(Running)
 	go s.line()
-	s.flag = Running
 	return true
 }
 
-func (s *Section) follow() bool {
-	seek := s.tail.SeekTo(s.path)
-	stat, err := os.Stat(s.path)
+// follow 按文件标识查找读取位置 文件被轮转时先读完旧文件
+func (s *Section) follow(file *os.File) bool {
+	stat, err := file.Stat()
 	if err != nil {
-		s.flag = Paused
+		s.mark(Paused)
 		s.info = err
 		s.tail.Errorf("%s stat fail %v", s.path, err)
 		return false
 	}
 
+	id := NewIdentity(s.path, stat)
+	if s.id.Path != "" && !s.id.Same(id) {
+		s.tail.Debugf("%s rotated %s -> %s", s.path, s.id, id)
+		s.drain(s.id)
+		s.tail.reset(s.path)
+	}
+	s.id = id
+
 	size := stat.Size()
+	seek := s.verify(file, s.tail.Load(id), size)
 	if size == seek {
-		s.flag = Paused
+		s.mark(Paused)
 		s.info = io.EOF
 		s.seek = size
 		s.tail.Debugf("%s not change offset:%d size:%d", s.path, seek, size)
@@ -79,12 +125,7 @@ func (s *Section) follow() bool {
 	}
 
 	s.tail.Debugf("%s record offset:%d size:%d", s.path, seek, size)
-	if seek > size {
-		s.seek = 0
-	} else {
-		s.seek = seek
-	}
-
+	s.seek = seek
 	return true
 }
 
@@ -100,42 +141,71 @@ func (s *Section) Handle(raw string) {
 	}
 
 	v := &Line{
-		File: s.path,
-		Text: []byte(raw),
-		Size: sz,
+		File:   s.file.Name(),
+		Offset: s.at,
+		Text:   []byte(raw),
+		Size:   sz,
+	}
+
+	if s.track != nil {
+		v.acks = []func(){s.track.track(s.end)}
+	}
+
+	if s.multi != nil {
+		s.multi.Add(v)
+		return
 	}
 
 	s.tail.Input(v)
 }
 
 func (s *Section) SaveSeek() {
+	s.commit()
+}
+
+// commit 保存当前文件的读取位置和指纹
+func (s *Section) commit() bool {
 	if s.file == nil {
 		s.tail.Errorf("%s not file handle", s.path)
-		return
+		return false
 	}
 
-	seek, e := s.file.Seek(0, io.SeekCurrent)
+	if s.track != nil {
+		s.track.finish(s.end, s.done)
+		return true
+	}
+
+	seek, e := s.offset()
 	if e != nil {
 		s.tail.Errorf("%s current seek error %v", s.path, e)
-		return
+		return false
 	}
-	s.tail.Tell(s.path, seek)
+
+	s.tail.Store(s.record(seek))
+	return true
 }
 
-func (s *Section) close() {
+// offset 当前读取位置 压缩文件为解压后的位置
+func (s *Section) offset() (int64, error) {
+	if s.unzip != nil {
+		return s.at, nil
+	}
+	return s.file.Seek(0, io.SeekCurrent)
+}
 
-	if s.file == nil {
-		s.tail.Errorf("%s not file handle", s.path)
-		return
+func (s *Section) close() {
+	if s.multi != nil {
+		s.multi.Idle()
 	}
 
-	seek, e := s.file.Seek(0, io.SeekCurrent)
-	if e != nil {
-		s.tail.Errorf("%s current seek error %v", s.path, e)
+	if !s.commit() {
 		return
 	}
 
-	s.tail.Tell(s.path, seek)
+	if s.unzip != nil {
+		s.unzip.Close()
+		s.unzip = nil
+	}
 
 	err := s.file.Close()
 	if err != nil {
@@ -147,7 +217,7 @@ func (s *Section) close() {
 }
 
 func (s *Section) detect() {
-	switch s.flag {
+	switch s.status() {
 	case Nothing:
 		s.start()
 	case Paused:
@@ -158,6 +228,8 @@ func (s *Section) detect() {
 		s.tail.logger.Errorf("%s clean", s.path)
 	case Done:
 		s.tail.logger.Errorf("%s done", s.path)
+	case Archived:
+		s.rearchive()
 	case Running:
 		//todo
 	default:
@@ -180,28 +252,52 @@ func (s *Section) reload() {
 }
 
 func (s *Section) line() {
+	var flag ErrNo = Paused
 	defer func() {
 		if r := recover(); r != nil {
-			s.flag = Paused
+			flag = Paused
 			buff := make([]byte, 1024*32)
 			runtime.Stack(buff, false)
 			s.tail.Errorf("file:%s error:%v stack:\n%s", s.path, r, string(buff))
 		}
+		//关闭句柄后再更新状态 防止重新打开的句柄被关闭
 		s.close()
+		if s.done {
+			flag = Archived
+		}
+		s.mark(flag)
+		if atomic.SwapInt32(&s.wake, 0) == 1 {
+			s.tail.push(Event{Path: s.path, Op: EventWrite})
+		}
 	}()
 
-	reader := bufio.NewReader(s.file)
+	flag = s.read()
+}
+
+// read 读取到文件末尾 返回结束后的状态
+func (s *Section) read() ErrNo {
+	var src io.Reader = s.file
+	start, _ := s.file.Seek(0, io.SeekCurrent)
+	if s.unzip != nil {
+		src, start = s.unzip, s.seek
+	}
+
+	c := &counter{r: src}
+	reader := bufio.NewReader(c)
 	var cnt uint32
 
 	for {
 
 		select {
 		case <-s.tail.Done():
-			s.flag = Done
+			if s.multi != nil {
+				s.multi.Stop()
+			}
 			s.tail.Errorf("%s readline exit", s.path)
-			return
+			return Done
 
 		default:
+			s.at = start + c.n - int64(reader.Buffered())
 			fsm := LineFSM{
 				tail:    s.tail,
 				scanner: reader,
@@ -210,6 +306,7 @@ func (s *Section) line() {
 			}
 
 			text, err := fsm.Read()
+			s.end = start + c.n - int64(reader.Buffered())
 			if err == nil {
 				s.Handle(text)
 				continue
@@ -221,19 +318,17 @@ func (s *Section) line() {
 
 			switch err.Error() {
 			case io.EOF.Error():
-				s.flag = Paused
 				s.Handle(text)
-				return
+				s.done = s.unzip != nil
+				return Paused
 
 			case os.ErrClosed.Error():
-				s.flag = Paused
 				s.Handle(text)
-				return
+				return Paused
 			default:
-				s.flag = Paused
 				s.info = err
 				s.tail.Errorf("%s read line error %v", s.path, err)
-				return
+				return Paused
 			}
 		}
 	}
@@ -6,29 +6,38 @@ import (
 )
 
 type Setting struct {
-	Name     string   `lua:"name"`
-	Limit    int      `lua:"limit"`
-	Thread   int      `lua:"thread"`
-	Buffer   int      `lua:"buffer"`
-	Wait     int      `lua:"wait"`
-	Delim    byte     `lua:"delim"`
-	Follow   bool     `lua:"follow"`
-	Target   []string `lua:"target"`
-	FastJSON bool     `lua:"fastjson"`
-	Location SeekInfo `lua:"location"`
-	Poll     int      `lua:"poll"`
+	Name       string          `lua:"name"`
+	Limit      int             `lua:"limit"`
+	Thread     int             `lua:"thread"`
+	Buffer     int             `lua:"buffer"`
+	Wait       int             `lua:"wait"`
+	Delim      byte            `lua:"delim"`
+	Follow     bool            `lua:"follow"`
+	Target     []string        `lua:"target"`
+	FastJSON   bool            `lua:"fastjson"`
+	Location   SeekInfo        `lua:"location"`
+	Poll       int             `lua:"poll"`
+	Inotify    bool            `lua:"inotify"`
+	Decompress string          `lua:"decompress"`
+	Parser     []*ParserConfig `lua:"parser"`
+	Cache      int             `lua:"cache"` // 未确认的行数上限 超出后暂停读取
+	Spill      string          `lua:"spill"` // 落盘目录 队列满时写入磁盘
+	Multiline  *Multiline      `lua:"multiline"`
 }
 
 func Default(name string) *Setting {
 	return &Setting{
-		Name:   todo.IF(name == "", "filekit.tail", name),
-		Limit:  0,
-		Delim:  '\n',
-		Wait:   10, // 10s
-		Thread: 128,
-		Follow: true,
-		Poll:   3,
-		Buffer: 4096,
+		Name:       todo.IF(name == "", "filekit.tail", name),
+		Limit:      0,
+		Delim:      '\n',
+		Wait:       10, // 10s
+		Thread:     128,
+		Follow:     true,
+		Poll:       3,
+		Buffer:     4096,
+		Cache:      1024,
+		Inotify:    false,
+		Decompress: CodecNone,
 	}
 }
 
@@ -36,5 +45,19 @@ func (s *Setting) Bad() error {
 	if s.Name == "" {
 		return fmt.Errorf("not found name")
 	}
+
+	if err := CodecBad(s.Decompress); err != nil {
+		return err
+	}
+
+	for _, cfg := range s.Parser {
+		if _, err := NewParser(cfg); err != nil {
+			return err
+		}
+	}
+
+	if s.Multiline != nil {
+		return s.Multiline.Bad()
+	}
 	return nil
 }
@@ -0,0 +1,88 @@
+package filekit
+
+import (
+	"context"
+	"sort"
+	"sync"
+	"testing"
+	"time"
+)
+
+// collector 收集 Chain 收到的行
+type collector struct {
+	mutex sync.Mutex
+	lines []string
+}
+
+func (c *collector) add(v any) {
+	line, ok := v.(*Line)
+	if !ok {
+		return
+	}
+
+	c.mutex.Lock()
+	c.lines = append(c.lines, string(line.Text))
+	c.mutex.Unlock()
+}
+
+func (c *collector) texts() []string {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+	return append([]string{}, c.lines...)
+}
+
+// wait 等待收到 n 行
+func (c *collector) wait(t *testing.T, n int) []string {
+	t.Helper()
+	deadline := time.Now().Add(2 * time.Second)
+	for time.Now().Before(deadline) {
+		if lines := c.texts(); len(lines) >= n {
+			return lines
+		}
+		time.Sleep(5 * time.Millisecond)
+	}
+
+	t.Fatalf("got %q want %d lines", c.texts(), n)
+	return nil
+}
+
+type quiet struct{}
+
+func (quiet) Errorf(string, ...any) {}
+func (quiet) Warnf(string, ...any)  {}
+func (quiet) Debugf(string, ...any) {}
+func (quiet) Infof(string, ...any)  {}
+
+// sorted 多个worker 处理时行的顺序不固定
+func sorted(lines []string) []string {
+	sort.Strings(lines)
+	return lines
+}
+
+func newTestTail(t *testing.T, target ...string) (*FileTail, *collector) {
+	ft := NewTail("test")
+	ft.logger = quiet{}
+	ft.setting.Target = target
+	ft.setting.Wait = 0
+	ft.setting.Thread = 2
+	ft.private.Seeker = NewSeekMem()
+
+	c := &collector{}
+	ft.private.Chain.NewHandler(c.add)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	t.Cleanup(cancel)
+	ft.Prepare(ctx)
+	return ft, c
+}
+
+func TestDefault(t *testing.T) {
+	s := Default("")
+	if s.Inotify {
+		t.Fatal("inotify enabled by default")
+	}
+
+	if s.Decompress != CodecNone {
+		t.Fatalf("decompress %s by default", s.Decompress)
+	}
+}
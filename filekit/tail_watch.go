@@ -0,0 +1,164 @@
+package filekit
+
+import (
+	"path/filepath"
+	"strings"
+	"sync/atomic"
+	"time"
+)
+
+const (
+	EventWrite uint32 = 1 << iota
+	EventCreate
+	EventMoveIn
+	EventMoveOut
+	EventDelete
+)
+
+// Event 文件变化事件 Dir 表示变化的是目录
+type Event struct {
+	Path string
+	Op   uint32
+	Dir  bool
+}
+
+// push 投递事件 队列满时丢弃并标记 定时器触发时重新匹配
+func (ft *FileTail) push(ev Event) {
+	select {
+	case ft.private.events <- ev:
+	default:
+		atomic.StoreInt32(&ft.private.lost, 1)
+	}
+}
+
+// rescan 降级或者有事件丢失时重新匹配 返回是否执行
+func (ft *FileTail) rescan(w *watcher) bool {
+	lost := atomic.SwapInt32(&ft.private.lost, 0) == 1
+	if !lost && !w.Degraded() {
+		return false
+	}
+
+	if lost {
+		ft.Debugf("%s events lost rescan", ft.Name())
+	}
+	ft.GlobFor()
+	return true
+}
+
+// dirs 需要监听的目录 包含通配符的目录同时监听其不含通配符的上级目录
+func (ft *FileTail) dirs() []string {
+	seen := make(map[string]bool)
+	var dirs []string
+	add := func(dir string) {
+		if abs, err := filepath.Abs(dir); err == nil && !seen[abs] {
+			seen[abs] = true
+			dirs = append(dirs, abs)
+		}
+	}
+
+	for _, pattern := range ft.setting.Target {
+		dir := filepath.Dir(pattern)
+		root := dir
+		for strings.ContainsAny(root, "*?[") {
+			root = filepath.Dir(root)
+		}
+
+		if root != dir {
+			add(root)
+		}
+
+		matches, err := filepath.Glob(dir)
+		if err != nil {
+			continue
+		}
+
+		for _, match := range matches {
+			add(match)
+		}
+	}
+	return dirs
+}
+
+// matched 新建的文件是否符合 Target
+func (ft *FileTail) matched(path string) bool {
+	for _, pattern := range ft.setting.Target {
+		abs, err := filepath.Abs(pattern)
+		if err != nil {
+			continue
+		}
+
+		if ok, _ := filepath.Match(abs, path); ok {
+			return true
+		}
+	}
+	return false
+}
+
+// wake 唤醒文件对应的 Section 正在读取时等读取结束后再次投递
+func (ft *FileTail) wake(path string) {
+	s, ok := ft.private.history[path]
+	if !ok {
+		return
+	}
+
+	if s.status() == Running {
+		atomic.StoreInt32(&s.wake, 1)
+		return
+	}
+	s.detect()
+}
+
+func (ft *FileTail) notify(w *watcher, ev Event) {
+	switch {
+	case ev.Op&(EventCreate|EventMoveIn) != 0:
+		if !ev.Dir && !ft.matched(ev.Path) {
+			return
+		}
+
+		ft.Debugf("%s event %d reglob", ev.Path, ev.Op)
+		ft.GlobFor()
+		if ev.Dir {
+			w.Sync()
+		}
+
+	default:
+		//移走的文件继续保留 等新文件创建后读完剩余内容
+		ft.wake(ev.Path)
+	}
+}
+
+// poll 定时重新匹配文件
+func (ft *FileTail) poll() {
+	tk := time.NewTicker(time.Duration(ft.setting.Poll) * time.Second)
+	defer tk.Stop()
+
+	for {
+		select {
+		case <-ft.Done():
+			ft.Errorf("%s watch exit", ft.Name())
+			return
+		case <-tk.C:
+			ft.GlobFor()
+		}
+	}
+}
+
+// notice 监听文件事件 inotify 数量不足或者事件丢失时由定时器兜底
+func (ft *FileTail) notice(w *watcher) {
+	defer w.Close()
+
+	tk := time.NewTicker(time.Duration(ft.setting.Poll) * time.Second)
+	defer tk.Stop()
+
+	for {
+		select {
+		case <-ft.Done():
+			ft.Errorf("%s watch exit", ft.Name())
+			return
+		case ev := <-ft.private.events:
+			ft.notify(w, ev)
+		case <-tk.C:
+			ft.rescan(w)
+		}
+	}
+}
@@ -0,0 +1,164 @@
+//go:build linux
+// +build linux
+
+package filekit
+
+import (
+	"bytes"
+	"errors"
+	"golang.org/x/sys/unix"
+	"os"
+	"path/filepath"
+	"sync"
+	"unsafe"
+)
+
+const inotifyMask = unix.IN_MODIFY | unix.IN_CREATE | unix.IN_MOVED_TO | unix.IN_MOVED_FROM | unix.IN_DELETE
+
+// watcher 基于 inotify 监听 Target 所在目录
+type watcher struct {
+	tail     *FileTail
+	fd       int
+	file     *os.File
+	mutex    sync.Mutex
+	wd       map[int]string
+	dir      map[string]int
+	degraded bool
+}
+
+// Sync 按 Target 重新添加目录监听 inotify 数量不足时进入降级
+func (w *watcher) Sync() error {
+	w.mutex.Lock()
+	defer w.mutex.Unlock()
+
+	for _, dir := range w.tail.dirs() {
+		if _, ok := w.dir[dir]; ok {
+			continue
+		}
+
+		wd, err := unix.InotifyAddWatch(w.fd, dir, inotifyMask)
+		if err == nil {
+			w.wd[wd] = dir
+			w.dir[dir] = wd
+			continue
+		}
+
+		if errors.Is(err, unix.ENOSPC) || errors.Is(err, unix.EMFILE) {
+			w.degraded = true
+			w.tail.Errorf("%s inotify watch %s fail %v fallback poll", w.tail.Name(), dir, err)
+			return err
+		}
+		w.tail.Debugf("%s inotify watch %s fail %v", w.tail.Name(), dir, err)
+	}
+	return nil
+}
+
+func (w *watcher) Degraded() bool {
+	w.mutex.Lock()
+	defer w.mutex.Unlock()
+	return w.degraded
+}
+
+func (w *watcher) Close() error {
+	return w.file.Close()
+}
+
+func (w *watcher) path(wd int) (string, bool) {
+	w.mutex.Lock()
+	defer w.mutex.Unlock()
+	dir, ok := w.wd[wd]
+	return dir, ok
+}
+
+func (w *watcher) remove(wd int) {
+	w.mutex.Lock()
+	defer w.mutex.Unlock()
+	delete(w.dir, w.wd[wd])
+	delete(w.wd, wd)
+}
+
+func (w *watcher) decode(raw *unix.InotifyEvent, name string) (Event, bool) {
+	if raw.Mask&unix.IN_Q_OVERFLOW != 0 {
+		//事件丢失 重新匹配
+		return Event{Op: EventCreate, Dir: true}, true
+	}
+
+	if raw.Mask&unix.IN_IGNORED != 0 {
+		w.remove(int(raw.Wd))
+		return Event{}, false
+	}
+
+	dir, ok := w.path(int(raw.Wd))
+	if !ok {
+		return Event{}, false
+	}
+
+	ev := Event{
+		Path: filepath.Join(dir, name),
+		Dir:  raw.Mask&unix.IN_ISDIR != 0,
+	}
+
+	switch {
+	case raw.Mask&unix.IN_MODIFY != 0:
+		ev.Op = EventWrite
+	case raw.Mask&unix.IN_CREATE != 0:
+		ev.Op = EventCreate
+	case raw.Mask&unix.IN_MOVED_TO != 0:
+		ev.Op = EventMoveIn
+	case raw.Mask&unix.IN_MOVED_FROM != 0:
+		ev.Op = EventMoveOut
+	case raw.Mask&unix.IN_DELETE != 0:
+		ev.Op = EventDelete
+	default:
+		return Event{}, false
+	}
+	return ev, true
+}
+
+func (w *watcher) loop() {
+	buf := make([]byte, (unix.SizeofInotifyEvent+unix.NAME_MAX+1)*64)
+	for {
+		n, err := w.file.Read(buf)
+		if err != nil {
+			if !errors.Is(err, os.ErrClosed) {
+				w.tail.Errorf("%s inotify read fail %v", w.tail.Name(), err)
+			}
+			return
+		}
+
+		var offset int
+		for offset+unix.SizeofInotifyEvent <= n {
+			raw := (*unix.InotifyEvent)(unsafe.Pointer(&buf[offset]))
+			start := offset + unix.SizeofInotifyEvent
+			offset = start + int(raw.Len)
+			name := string(bytes.TrimRight(buf[start:offset], "\x00"))
+
+			if ev, ok := w.decode(raw, name); ok {
+				w.tail.push(ev)
+			}
+		}
+	}
+}
+
+func newWatcher(ft *FileTail) (*watcher, error) {
+	fd, err := unix.InotifyInit1(unix.IN_CLOEXEC | unix.IN_NONBLOCK)
+	if err != nil {
+		return nil, err
+	}
+
+	w := &watcher{
+		tail: ft,
+		fd:   fd,
+		file: os.NewFile(uintptr(fd), "inotify"),
+		wd:   make(map[int]string),
+		dir:  make(map[string]int),
+	}
+
+	if err = w.Sync(); err != nil {
+		w.Close()
+		return nil, err
+	}
+
+	go w.loop()
+	return w, nil
+}
@@ -0,0 +1,94 @@
+//go:build linux
+// +build linux
+
+package filekit
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+// 事件队列满时丢弃的事件由定时器重新匹配
+func TestWatchLost(t *testing.T) {
+	dir := t.TempDir()
+	ft, c := newTestTail(t, filepath.Join(dir, "*.log"))
+	if err := os.WriteFile(filepath.Join(dir, "a.log"), []byte("line1\nline2\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	w := &watcher{}
+	if ft.rescan(w) {
+		t.Fatal("rescan without lost events")
+	}
+
+	for i := 0; i <= cap(ft.private.events); i++ {
+		ft.push(Event{Path: filepath.Join(dir, "a.log"), Op: EventWrite})
+	}
+
+	if !ft.rescan(w) {
+		t.Fatal("lost events not rescanned")
+	}
+
+	if lines := c.wait(t, 2); lines[0] != "line1" || lines[1] != "line2" {
+		t.Fatalf("got %q", lines)
+	}
+
+	if ft.rescan(w) {
+		t.Fatal("lost flag not reset")
+	}
+}
+
+// inotify 事件转换
+func TestWatchEvents(t *testing.T) {
+	dir := t.TempDir()
+	ft, _ := newTestTail(t, filepath.Join(dir, "*.log"))
+
+	w, err := newWatcher(ft)
+	if err != nil {
+		t.Skipf("inotify unavailable %v", err)
+	}
+	defer w.Close()
+
+	expect := func(op uint32, path string, isDir bool) {
+		t.Helper()
+		timeout := time.After(2 * time.Second)
+		for {
+			select {
+			case ev := <-ft.private.events:
+				if ev.Op == op && ev.Path == path && ev.Dir == isDir {
+					return
+				}
+			case <-timeout:
+				t.Fatalf("not found event %d %s", op, path)
+			}
+		}
+	}
+
+	a := filepath.Join(dir, "a.log")
+	b := filepath.Join(dir, "b.log")
+	sub := filepath.Join(dir, "sub")
+
+	steps := []struct {
+		name string
+		run  func() error
+		op   uint32
+		path string
+		dir  bool
+	}{
+		{"create", func() error { return os.WriteFile(a, nil, 0644) }, EventCreate, a, false},
+		{"write", func() error { return os.WriteFile(a, []byte("x\n"), 0644) }, EventWrite, a, false},
+		{"move out", func() error { return os.Rename(a, b) }, EventMoveOut, a, false},
+		{"move in", func() error { return nil }, EventMoveIn, b, false},
+		{"delete", func() error { return os.Remove(b) }, EventDelete, b, false},
+		{"mkdir", func() error { return os.Mkdir(sub, 0755) }, EventCreate, sub, true},
+	}
+
+	for _, step := range steps {
+		if err = step.run(); err != nil {
+			t.Fatalf("%s %v", step.name, err)
+		}
+		expect(step.op, step.path, step.dir)
+	}
+}
@@ -0,0 +1,17 @@
+//go:build !linux
+// +build !linux
+
+package filekit
+
+import "errors"
+
+// watcher 非 linux 平台不支持 使用轮询
+type watcher struct{}
+
+func (w *watcher) Sync() error    { return nil }
+func (w *watcher) Degraded() bool { return true }
+func (w *watcher) Close() error   { return nil }
+
+func newWatcher(ft *FileTail) (*watcher, error) {
+	return nil, errors.New("inotify not supported")
+}
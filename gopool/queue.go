@@ -229,6 +229,16 @@ func (q *Queue[T]) Push(data T) {
 	}
 }
 
+// PushE 写入队列 返回写入失败的原因
+func (q *Queue[T]) PushE(data T) error {
+	select {
+	case <-q.Context().Done():
+		return q.Context().Err()
+	default:
+		return q.queue.Push(data)
+	}
+}
+
 func (q *Queue[T]) HandlerFunc(fn func(packet *Packet[T])) {
 	q.private.Handler = func(packet *Packet[T]) error {
 		fn(packet)
@@ -10,6 +10,10 @@ var setting = struct {
 	Env  Environment
 }{}
 
+func Ready() bool {
+	return setting.Env != nil
+}
+
 func LazyEnv() Environment {
 	if setting.Env == nil {
 		panic("Environment is not Configured")
@@ -42,6 +42,10 @@ func newApiErrorE(code ApiErrorType, err error) *ApiError {
 	return &ApiError{code, LString(err.Error()), "", err}
 }
 
+func (e *ApiError) Unwrap() error {
+	return e.Cause
+}
+
 func (e *ApiError) Error() string {
 	if len(e.StackTrace) > 0 {
 		return fmt.Sprintf("%s\n%s", e.Object.String(), e.StackTrace)
@@ -105,6 +109,12 @@ type Options struct {
 	// If `MinimizeStackMemory` is set, the call stack will be automatically grown or shrank up to a limit of
 	// `CallStackSize` in order to minimize memory usage. This does incur a slight performance penalty.
 	MinimizeStackMemory bool
+	//private data object
+	Exdata any
+	//
+	ErrHandle func(error)
+	//资源限制
+	Quota Quota
 }
 
 /* }}} */
@@ -204,6 +214,26 @@ func (cs *fixedCallFrameStack) Pop() *callFrame {
 	return &cs.array[cs.sp]
 }
 
+func (cs *fixedCallFrameStack) reset() {
+	sz := len(cs.array)
+	for i := 0; i < sz; i++ {
+		cf := &cs.array[i]
+		cf.Parent = nil
+		cf.Fn = nil
+		cf.Idx = 0
+		cf.Pc = 0
+		cf.Base = 0
+		cf.LocalBase = 0
+		cf.ReturnBase = 0
+		cf.NArgs = 0
+		cf.NRet = 0
+		cf.TailCall = 0
+		cf.NRet = 0
+		cf.Idx = 0
+	}
+	cs.sp = 0
+}
+
 func (cs *fixedCallFrameStack) FreeAll() {
 	// nothing to do for fixed callframestack
 }
@@ -367,12 +397,13 @@ type registry struct {
 	top     int
 	growBy  int
 	maxSize int
+	need    int //扩容失败时需要的大小
 	alloc   *allocator
 	handler registryHandler
 }
 
 func newRegistry(handler registryHandler, initialSize int, growBy int, maxSize int, alloc *allocator) *registry {
-	return &registry{make([]LValue, initialSize), 0, growBy, maxSize, alloc, handler}
+	return &registry{make([]LValue, initialSize), 0, growBy, maxSize, 0, alloc, handler}
 }
 
 func (rg *registry) checkSize(requiredSize int) { // +inline-start
@@ -387,6 +418,7 @@ func (rg *registry) resize(requiredSize int) { // +inline-start
 		newSize = rg.maxSize
 	}
 	if newSize < requiredSize {
+		rg.need = requiredSize
 		rg.handler.registryOverflow()
 		return
 	}
@@ -576,6 +608,7 @@ func newLState(options Options) *LState {
 		uvcache:      nil,
 		hasErrorFunc: false,
 		mainLoop:     mainLoop,
+		meter:        newMeter(options.Quota),
 		ctx:          nil,
 	}
 	if options.MinimizeStackMemory {
@@ -685,7 +718,8 @@ func (ls *LState) where(level int, skipg bool) string {
 		return ls.where(level+1, skipg)
 	}
 	line := ""
-	if proto != nil {
+	//调用帧初始化时 Pc 为 0 寄存器溢出时还没有执行任何指令
+	if proto != nil && cf.Pc > 0 {
 		line = fmt.Sprintf("%v:", proto.DbgSourcePositions[cf.Pc-1])
 	}
 	return fmt.Sprintf("%v:%v", sourcename, line)
@@ -824,7 +858,9 @@ func (ls *LState) rkString(idx int) string {
 	if (idx & opBitRk) != 0 {
 		return ls.currentFrame.Fn.Proto.stringConstants[idx & ^opBitRk]
 	}
-	return string(ls.reg.array[ls.currentFrame.LocalBase+idx].(LString))
+
+	val := ls.reg.array[ls.currentFrame.LocalBase+idx]
+	return string(val.(LString))
 }
 
 func (ls *LState) closeUpvalues(idx int) { // +inline-start
@@ -1021,7 +1057,7 @@ func (ls *LState) pushCallFrame(cf callFrame, fn LValue, meta bool) { // +inline
 		ls.RaiseError("attempt to call a non-function object")
 	}
 	if ls.stack.IsFull() {
-		ls.RaiseError("stack overflow")
+		ls.stackOverflow()
 	}
 	ls.stack.Push(cf)
 	newcf := ls.stack.Last()
@@ -1036,6 +1072,9 @@ func (ls *LState) callR(nargs, nret, rbase int) {
 	}
 	lv := ls.reg.Get(base)
 	fn, meta := ls.metaCall(lv)
+	if ls.meter != nil && ls.stack.Sp() == 0 {
+		ls.meter.reset()
+	}
 	ls.pushCallFrame(callFrame{
 		Fn:         fn,
 		Pc:         0,
@@ -1508,6 +1547,11 @@ func (ls *LState) ToThread(n int) *LState {
 /* error & debug operations {{{ */
 
 func (ls *LState) registryOverflow() {
+	if ls.meter != nil {
+		sz := intMax(ls.reg.maxSize, len(ls.reg.array))
+		ls.raiseQuota(&QuotaError{Kind: QuotaRegistry, Limit: int64(sz), Used: int64(ls.reg.need)})
+		return
+	}
 	ls.RaiseError("registry overflow")
 }
 
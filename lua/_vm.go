@@ -9,6 +9,7 @@ import (
 func mainLoop(L *LState, baseframe *callFrame) {
 	var inst uint32
 	var cf *callFrame
+	var op int
 
 	if L.stack.IsEmpty() {
 		return
@@ -24,7 +25,16 @@ func mainLoop(L *LState, baseframe *callFrame) {
 		cf = L.currentFrame
 		inst = cf.Fn.Proto.Code[cf.Pc]
 		cf.Pc++
-		if jumpTable[int(inst>>26)](L, inst, baseframe) == 1 {
+		if L.meter != nil {
+			L.step()
+		}
+		op = int(inst >> 26)
+
+		if HijackTable(&CallFrameFSM{co: L, op: op, inst: inst, base: baseframe}) {
+			continue
+		}
+
+		if jumpTable[op](L, inst, baseframe) == 1 {
 			return
 		}
 	}
@@ -33,6 +43,7 @@ func mainLoop(L *LState, baseframe *callFrame) {
 func mainLoopWithContext(L *LState, baseframe *callFrame) {
 	var inst uint32
 	var cf *callFrame
+	var op int
 
 	if L.stack.IsEmpty() {
 		return
@@ -44,16 +55,26 @@ func mainLoopWithContext(L *LState, baseframe *callFrame) {
 		return
 	}
 
+	term := L.terminate()
+
 	for {
 		cf = L.currentFrame
 		inst = cf.Fn.Proto.Code[cf.Pc]
 		cf.Pc++
+		if L.meter != nil {
+			L.step()
+		}
 		select {
+		case <-term:
+			return
 		case <-L.ctx.Done():
-			L.RaiseError(L.ctx.Err().Error())
 			return
 		default:
-			if jumpTable[int(inst>>26)](L, inst, baseframe) == 1 {
+			op = int(inst >> 26)
+			if HijackTable(&CallFrameFSM{co: L, op: op, inst: inst, base: baseframe}) {
+				continue
+			}
+			if jumpTable[op](L, inst, baseframe) == 1 {
 				return
 			}
 		}
@@ -69,11 +90,11 @@ func mainLoopWithContext(L *LState, baseframe *callFrame) {
 // When this function returns the top of the registry will be set to regv+n.
 func copyReturnValues(L *LState, regv, start, n, b int) { // +inline-start
 	if b == 1 {
-		// +inline-call U.reg.FillNil  regv n
+		// +inline-call L.reg.FillNil  regv n
 	} else {
-		// +inline-call U.reg.CopyRange regv start -1 n
+		// +inline-call L.reg.CopyRange regv start -1 n
 		if b > 1 && n > (b-1) {
-			// +inline-call U.reg.FillNil  regv+b-1 n-(b-1)
+			// +inline-call L.reg.FillNil  regv+b-1 n-(b-1)
 		}
 	}
 } // +inline-end
@@ -124,7 +145,7 @@ func callGFunction(L *LState, tailcall bool) bool {
 		return true
 	}
 
-	// +inline-call U.reg.CopyRange frame.ReturnBase U.reg.Top()-gfnret -1 wantret
+	// +inline-call L.reg.CopyRange frame.ReturnBase L.reg.Top()-gfnret -1 wantret
 	L.stack.Pop()
 	L.currentFrame = L.stack.Last()
 	return false
@@ -308,7 +329,10 @@ func init() {
 			RA := lbase + A
 			B := int(inst & 0x1ff)    //GETB
 			C := int(inst>>9) & 0x1ff //GETC
-			L.setField(reg.Get(RA), L.rkValue(B), L.rkValue(C))
+			tb := reg.Get(RA)
+			n := L.measure(tb)
+			L.setField(tb, L.rkValue(B), L.rkValue(C))
+			L.grown(tb, n)
 			return 0
 		},
 		func(L *LState, inst uint32, baseframe *callFrame) int { //OP_SETTABLEKS
@@ -319,7 +343,10 @@ func init() {
 			RA := lbase + A
 			B := int(inst & 0x1ff)    //GETB
 			C := int(inst>>9) & 0x1ff //GETC
-			L.setFieldString(reg.Get(RA), L.rkString(B), L.rkValue(C))
+			tb := reg.Get(RA)
+			n := L.measure(tb)
+			L.setFieldString(tb, L.rkString(B), L.rkValue(C))
+			L.grown(tb, n)
 			return 0
 		},
 		func(L *LState, inst uint32, baseframe *callFrame) int { //OP_NEWTABLE
@@ -330,6 +357,9 @@ func init() {
 			RA := lbase + A
 			B := int(inst & 0x1ff)    //GETB
 			C := int(inst>>9) & 0x1ff //GETC
+			if L.meter != nil {
+				L.account(quotaTableSize + int64(B+C)*quotaSlotSize)
+			}
 			reg.Set(RA, newLTable(B, C))
 			return 0
 		},
@@ -560,13 +590,13 @@ func init() {
 			nret := C - 1
 			var callable *LFunction
 			var meta bool
-			if fn, ok := lv.assertFunction(); ok {
+			if fn, ok := lv.AssertFunction(); ok {
 				callable = fn
 				meta = false
 			} else {
 				callable, meta = L.metaCall(lv)
 			}
-			// +inline-call U.pushCallFrame callFrame{Fn:callable,Pc:0,Base:RA,LocalBase:RA+1,ReturnBase:RA,NArgs:nargs,NRet:nret,Parent:cf,TailCall:0} lv meta
+			// +inline-call L.pushCallFrame callFrame{Fn:callable,Pc:0,Base:RA,LocalBase:RA+1,ReturnBase:RA,NArgs:nargs,NRet:nret,Parent:cf,TailCall:0} lv meta
 			if callable.IsG && callGFunction(L, false) {
 				return 1
 			}
@@ -586,7 +616,7 @@ func init() {
 			lv := reg.Get(RA)
 			var callable *LFunction
 			var meta bool
-			if fn, ok := lv.assertFunction(); ok {
+			if fn, ok := lv.AssertFunction(); ok {
 				callable = fn
 				meta = false
 			} else {
@@ -595,7 +625,7 @@ func init() {
 			if callable == nil {
 				L.RaiseError("attempt to call a non-function object")
 			}
-			// +inline-call U.closeUpvalues lbase
+			// +inline-call L.closeUpvalues lbase
 			if callable.IsG {
 				luaframe := cf
 				L.pushCallFrame(callFrame{
@@ -630,8 +660,8 @@ func init() {
 					cf.NArgs++
 					L.reg.Insert(lv, cf.LocalBase)
 				}
-				// +inline-call U.initCallFrame cf
-				// +inline-call U.reg.CopyRange base RA -1 reg.Top()-RA-1
+				// +inline-call L.initCallFrame cf
+				// +inline-call L.reg.CopyRange base RA -1 reg.Top()-RA-1
 				cf.Base = base
 				cf.LocalBase = base + (cf.LocalBase - lbase + 1)
 			}
@@ -644,7 +674,7 @@ func init() {
 			A := int(inst>>18) & 0xff //GETA
 			RA := lbase + A
 			B := int(inst & 0x1ff) //GETB
-			// +inline-call U.closeUpvalues lbase
+			// +inline-call L.closeUpvalues lbase
 			nret := B - 1
 			if B == 0 {
 				nret = reg.Top() - RA
@@ -655,12 +685,12 @@ func init() {
 			}
 
 			if L.Parent != nil && L.stack.Sp() == 1 {
-				// +inline-call copyReturnValues U reg.Top() RA n B
+				// +inline-call copyReturnValues L reg.Top() RA n B
 				switchToParentThread(L, n, false, true)
 				return 1
 			}
 			islast := baseframe == L.stack.Pop() || L.stack.IsEmpty()
-			// +inline-call copyReturnValues U cf.ReturnBase RA n B
+			// +inline-call copyReturnValues L cf.ReturnBase RA n B
 			L.currentFrame = L.stack.Last()
 			if islast || L.currentFrame == nil || L.currentFrame.Fn.IsG {
 				return 1
@@ -754,9 +784,11 @@ func init() {
 			if B == 0 {
 				nelem = reg.Top() - RA - 1
 			}
+			n := L.measure(table)
 			for i := 1; i <= nelem; i++ {
 				table.RawSetInt(offset+i, reg.Get(RA+i))
 			}
+			L.grown(table, n)
 			return 0
 		},
 		func(L *LState, inst uint32, baseframe *callFrame) int { //OP_CLOSE
@@ -764,7 +796,7 @@ func init() {
 			lbase := cf.LocalBase
 			A := int(inst>>18) & 0xff //GETA
 			RA := lbase + A
-			// +inline-call U.closeUpvalues RA
+			// +inline-call L.closeUpvalues RA
 			return 0
 		},
 		func(L *LState, inst uint32, baseframe *callFrame) int { //OP_CLOSURE
@@ -943,6 +975,13 @@ func stringConcat(L *LState, total, last int) LValue {
 				i--
 				total--
 			}
+			if L.meter != nil {
+				size := 0
+				for _, v := range buf {
+					size += len(v)
+				}
+				L.account(int64(size))
+			}
 			rhs = LString(strings.Join(buf, ""))
 		}
 	}
@@ -972,15 +1011,26 @@ func lessThan(L *LState, lhs, rhs LValue) bool {
 }
 
 func equals(L *LState, lhs, rhs LValue, raw bool) bool {
-	if lhs.Type() != rhs.Type() {
+	lt := lhs.Type()
+	rt := rhs.Type()
+
+	if lt == rt {
+		goto EQ
+	}
+
+	switch lt {
+	case LTInt, LTInt64, LTUint, LTUint64, LTNumber:
+		goto EQ
+	default:
 		return false
 	}
 
+EQ:
 	ret := false
-	switch lhs.Type() {
+	switch lt {
 	case LTNil:
 		ret = true
-	case LTNumber:
+	case LTNumber, LTInt, LTInt64, LTUint, LTUint64:
 		v1, _ := lhs.AssertFloat64()
 		v2, _ := rhs.AssertFloat64()
 		ret = v1 == v2
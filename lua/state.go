@@ -46,6 +46,10 @@ func newApiErrorE(code ApiErrorType, err error) *ApiError {
 	return &ApiError{code, LString(err.Error()), "", err}
 }
 
+func (e *ApiError) Unwrap() error {
+	return e.Cause
+}
+
 func (e *ApiError) Error() string {
 	if len(e.StackTrace) > 0 {
 		return fmt.Sprintf("%s\n%s", e.Object.String(), e.StackTrace)
@@ -113,6 +117,8 @@ type Options struct {
 	Exdata any
 	//
 	ErrHandle func(error)
+	//资源限制
+	Quota Quota
 }
 
 /* }}} */
@@ -395,12 +401,13 @@ type registry struct {
 	top     int
 	growBy  int
 	maxSize int
+	need    int //扩容失败时需要的大小
 	alloc   *allocator
 	handler registryHandler
 }
 
 func newRegistry(handler registryHandler, initialSize int, growBy int, maxSize int, alloc *allocator) *registry {
-	return &registry{make([]LValue, initialSize), 0, growBy, maxSize, alloc, handler}
+	return &registry{make([]LValue, initialSize), 0, growBy, maxSize, 0, alloc, handler}
 }
 
 func (rg *registry) checkSize(requiredSize int) { // +inline-start
@@ -415,6 +422,7 @@ func (rg *registry) resize(requiredSize int) { // +inline-start
 		newSize = rg.maxSize
 	}
 	if newSize < requiredSize {
+		rg.need = requiredSize
 		rg.handler.registryOverflow()
 		return
 	}
@@ -646,6 +654,7 @@ func newLState(options Options) *LState {
 		uvcache:      nil,
 		hasErrorFunc: false,
 		mainLoop:     mainLoop,
+		meter:        newMeter(options.Quota),
 		ctx:          nil,
 	}
 	if options.MinimizeStackMemory {
@@ -755,7 +764,8 @@ func (ls *LState) where(level int, skipg bool) string {
 		return ls.where(level+1, skipg)
 	}
 	line := ""
-	if proto != nil {
+	//调用帧初始化时 Pc 为 0 寄存器溢出时还没有执行任何指令
+	if proto != nil && cf.Pc > 0 {
 		line = fmt.Sprintf("%v:", proto.DbgSourcePositions[cf.Pc-1])
 	}
 	return fmt.Sprintf("%v:%v", sourcename, line)
@@ -1109,12 +1119,12 @@ func (ls *LState) pushCallFrame(cf callFrame, fn LValue, meta bool) { // +inline
 		ls.RaiseError("attempt to call a non-function object")
 	}
 	if ls.stack.IsFull() {
-		ls.RaiseError("stack overflow")
+		ls.stackOverflow()
 	}
 	ls.stack.Push(cf)
 	newcf := ls.stack.Last()
 	// this section is inlined by go-inline
-	// source function is 'func (ls *Main) initCallFrame(cf *callFrame) ' in '_state.go'
+	// source function is 'func (ls *LState) initCallFrame(cf *callFrame) ' in '_state.go'
 	{
 		cf := newcf
 		if cf.Fn.IsG {
@@ -1221,6 +1231,9 @@ func (ls *LState) callR(nargs, nret, rbase int) {
 	}
 	lv := ls.reg.Get(base)
 	fn, meta := ls.metaCall(lv)
+	if ls.meter != nil && ls.stack.Sp() == 0 {
+		ls.meter.reset()
+	}
 	ls.pushCallFrame(callFrame{
 		Fn:         fn,
 		Pc:         0,
@@ -1693,6 +1706,11 @@ func (ls *LState) ToThread(n int) *LState {
 /* error & debug operations {{{ */
 
 func (ls *LState) registryOverflow() {
+	if ls.meter != nil {
+		sz := intMax(ls.reg.maxSize, len(ls.reg.array))
+		ls.raiseQuota(&QuotaError{Kind: QuotaRegistry, Limit: int64(sz), Used: int64(ls.reg.need)})
+		return
+	}
 	ls.RaiseError("registry overflow")
 }
 
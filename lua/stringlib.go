@@ -398,6 +398,7 @@ func strRep(L *LState) int {
 	if n < 0 {
 		L.Push(emptyLString)
 	} else {
+		L.account(int64(len(str)) * int64(n))
 		L.Push(LString(strings.Repeat(str, n)))
 	}
 	return 1
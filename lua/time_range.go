@@ -81,3 +81,11 @@ func NewRange(times []string) *RangeTimes {
 	}
 	return r
 }
+
+func CompileRange(times []string) (*RangeTimes, error) {
+	r := NewRange(times)
+	if err := r.compile(); err != nil {
+		return nil, err
+	}
+	return r, nil
+}
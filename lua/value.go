@@ -241,6 +241,7 @@ type LState struct {
 	uvcache      *Upvalue
 	hasErrorFunc bool
 	mainLoop     func(*LState, *callFrame)
+	meter        *meter
 	ctx          context.Context
 	ctxCancelFn  context.CancelFunc
 	private      struct {
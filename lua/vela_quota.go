@@ -0,0 +1,144 @@
+package lua
+
+import "fmt"
+
+const (
+	QuotaInstruction = "instruction"
+	QuotaHeap        = "heap"
+	QuotaRegistry    = "registry"
+	QuotaCallStack   = "callstack"
+)
+
+// 近似的内存估算 只累计分配 不计算回收
+const (
+	quotaTableSize = 64
+	quotaSlotSize  = 16
+)
+
+// Quota 虚拟机的资源限制 0 表示不限制
+// Instructions 和 Heap 为每次顶层调用的预算 协程各自计算
+// Heap 只统计 lua 代码中的 table 构造 赋值 table.insert 字符串拼接和 string.rep
+// Go 扩展中的 RawSet* 和 NewTable 不经过虚拟机 不计入
+type Quota struct {
+	Instructions int64 `json:"instructions"` //指令数
+	Heap         int64 `json:"heap"`         //table 和 string 分配的字节数
+	Registry     int   `json:"registry"`     //寄存器最大值
+	CallStack    int   `json:"callstack"`    //调用栈深度
+}
+
+func (q Quota) enable() bool {
+	return q.Instructions > 0 || q.Heap > 0 || q.Registry > 0 || q.CallStack > 0
+}
+
+// QuotaError 超出限制时中断虚拟机 通过 ApiError.Cause 返回
+type QuotaError struct {
+	Kind  string `json:"kind"`
+	Limit int64  `json:"limit"`
+	Used  int64  `json:"used"`
+}
+
+func (e *QuotaError) Error() string {
+	return fmt.Sprintf("%s quota exceeded used %d limit %d", e.Kind, e.Used, e.Limit)
+}
+
+type meter struct {
+	quota Quota
+	steps int64
+	heap  int64
+	err   *QuotaError //超出后一直报错 lua 中的 pcall 无法恢复
+}
+
+func (m *meter) reset() {
+	m.steps = 0
+	m.heap = 0
+	m.err = nil
+}
+
+func newMeter(q Quota) *meter {
+	if !q.enable() {
+		return nil
+	}
+	return &meter{quota: q}
+}
+
+func (ls *LState) Quota() Quota {
+	return ls.Options.Quota
+}
+
+func (ls *LState) raiseQuota(e *QuotaError) {
+	if ls.meter != nil {
+		ls.meter.err = e
+	}
+
+	if !ls.hasErrorFunc {
+		ls.closeAllUpvalues()
+	}
+
+	panic(&ApiError{
+		Type:       ApiErrorRun,
+		Object:     LString(fmt.Sprintf("%v %v", ls.where(0, true), e.Error())),
+		StackTrace: ls.stackTrace(0),
+		Cause:      e,
+	})
+}
+
+// step 每条指令执行前检查
+func (ls *LState) step() {
+	m := ls.meter
+	if m.err != nil {
+		ls.raiseQuota(m.err)
+	}
+
+	if m.quota.Instructions <= 0 {
+		return
+	}
+
+	m.steps++
+	if m.steps > m.quota.Instructions {
+		ls.raiseQuota(&QuotaError{Kind: QuotaInstruction, Limit: m.quota.Instructions, Used: m.steps})
+	}
+}
+
+func (ls *LState) account(n int64) {
+	m := ls.meter
+	if m == nil || m.quota.Heap <= 0 || n <= 0 {
+		return
+	}
+
+	m.heap += n
+	if m.heap > m.quota.Heap {
+		ls.raiseQuota(&QuotaError{Kind: QuotaHeap, Limit: m.quota.Heap, Used: m.heap})
+	}
+}
+
+// measure 写入 table 前的大小 配合 grown 统计 table 扩容
+func (ls *LState) measure(lv LValue) int {
+	if ls.meter == nil {
+		return -1
+	}
+
+	tb, ok := lv.(*LTable)
+	if !ok {
+		return -1
+	}
+	return len(tb.array) + len(tb.dict) + len(tb.strdict)
+}
+
+func (ls *LState) grown(lv LValue, n int) {
+	if n < 0 {
+		return
+	}
+
+	if sz := ls.measure(lv); sz > n {
+		ls.account(int64(sz-n) * quotaSlotSize)
+	}
+}
+
+func (ls *LState) stackOverflow() {
+	if ls.meter == nil {
+		ls.RaiseError("stack overflow")
+		return
+	}
+	sz := int64(ls.Options.CallStackSize)
+	ls.raiseQuota(&QuotaError{Kind: QuotaCallStack, Limit: sz, Used: sz + 1})
+}
@@ -0,0 +1,76 @@
+package lua
+
+import (
+	"errors"
+	"testing"
+)
+
+func TestQuota(t *testing.T) {
+	cases := []struct {
+		name  string
+		quota Quota
+		code  string
+		kind  string
+	}{
+		{"instruction", Quota{Instructions: 10000}, `while true do end`, QuotaInstruction},
+		{"pcall", Quota{Instructions: 10000}, `pcall(function() while true do end end) while true do end`, QuotaInstruction},
+		{"heap table", Quota{Heap: 64 << 10}, `local t = {} for i = 1, 1e6 do t[i] = i end`, QuotaHeap},
+		{"heap insert", Quota{Heap: 64 << 10}, `local t = {} for i = 1, 1e6 do table.insert(t, i) end`, QuotaHeap},
+		{"heap new", Quota{Heap: 64 << 10}, `for i = 1, 1e6 do local t = {} end`, QuotaHeap},
+		{"heap string", Quota{Heap: 64 << 10}, `local s = "" for i = 1, 1e6 do s = s .. "xxxxxxxx" end`, QuotaHeap},
+		{"heap rep", Quota{Heap: 64 << 10}, `local s = string.rep("x", 1e6)`, QuotaHeap},
+		{"callstack", Quota{CallStack: 64}, `local function f(n) return 1 + f(n + 1) end f(1)`, QuotaCallStack},
+		{"registry", Quota{Registry: 1024}, `local function f(...) return f(1, ...) end f()`, QuotaRegistry},
+		{"under", Quota{Instructions: 10000, Heap: 64 << 10}, `local t = {} for i = 1, 100 do t[i] = i end`, ""},
+	}
+
+	for _, c := range cases {
+		L := NewStateEx(c.name, func(o *Options) {
+			o.Quota = c.quota
+			o.RegistrySize = 256
+			o.RegistryMaxSize = 1 << 16
+			o.RegistryGrowStep = 32
+		})
+
+		err := L.DoString(c.code)
+		L.Close()
+
+		if c.kind == "" {
+			if err != nil {
+				t.Fatalf("%s %v", c.name, err)
+			}
+			continue
+		}
+
+		var qe *QuotaError
+		if !errors.As(err, &qe) || qe.Kind != c.kind {
+			t.Fatalf("%s got %v want %s quota", c.name, err, c.kind)
+		}
+
+		if qe.Used <= qe.Limit {
+			t.Fatalf("%s used %d limit %d", c.name, qe.Used, qe.Limit)
+		}
+	}
+}
+
+// 预算按每次顶层调用计算
+func TestQuotaReset(t *testing.T) {
+	L := NewStateEx("reset", func(o *Options) {
+		o.Quota = Quota{Instructions: 5000}
+	})
+	defer L.Close()
+
+	for i := 0; i < 5; i++ {
+		if err := L.DoString(`for i = 1, 500 do end`); err != nil {
+			t.Fatalf("run %d %v", i, err)
+		}
+	}
+
+	if err := L.DoString(`for i = 1, 5000 do end`); err == nil {
+		t.Fatal("want instruction quota")
+	}
+
+	if err := L.DoString(`local a = 1`); err != nil {
+		t.Fatalf("after quota %v", err)
+	}
+}
@@ -148,6 +148,7 @@ func (ls *LState) NewThreadEx() *LState {
 		uvcache:      nil,
 		hasErrorFunc: false,
 		mainLoop:     ls.mainLoop,
+		meter:        newMeter(options.Quota),
 		ctx:          nil,
 	}
 
@@ -251,6 +252,17 @@ func NewStateEx(name string, fns ...func(*Options)) *LState {
 		opt.RegistrySize = 128
 	}
 
+	if q := opt.Quota; q.CallStack > 0 {
+		opt.CallStackSize = q.CallStack
+	}
+
+	if q := opt.Quota; q.Registry > 0 {
+		opt.RegistryMaxSize = q.Registry
+		if opt.RegistrySize > q.Registry {
+			opt.RegistrySize = q.Registry
+		}
+	}
+
 	if opt.RegistryMaxSize < opt.RegistrySize {
 		opt.RegistryMaxSize = 0 // disable growth if max size is smaller than initial size
 	} else {
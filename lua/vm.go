@@ -29,6 +29,9 @@ func mainLoop(L *LState, baseframe *callFrame) {
 		cf = L.currentFrame
 		inst = cf.Fn.Proto.Code[cf.Pc]
 		cf.Pc++
+		if L.meter != nil {
+			L.step()
+		}
 		op = int(inst >> 26)
 
 		if HijackTable(&CallFrameFSM{co: L, op: op, inst: inst, base: baseframe}) {
@@ -62,6 +65,9 @@ func mainLoopWithContext(L *LState, baseframe *callFrame) {
 		cf = L.currentFrame
 		inst = cf.Fn.Proto.Code[cf.Pc]
 		cf.Pc++
+		if L.meter != nil {
+			L.step()
+		}
 		select {
 		case <-term:
 			return
@@ -457,7 +463,10 @@ func init() {
 			RA := lbase + A
 			B := int(inst & 0x1ff)    //GETB
 			C := int(inst>>9) & 0x1ff //GETC
-			L.setField(reg.Get(RA), L.rkValue(B), L.rkValue(C))
+			tb := reg.Get(RA)
+			n := L.measure(tb)
+			L.setField(tb, L.rkValue(B), L.rkValue(C))
+			L.grown(tb, n)
 			return 0
 		},
 		func(L *LState, inst uint32, baseframe *callFrame) int { //OP_SETTABLEKS
@@ -468,7 +477,10 @@ func init() {
 			RA := lbase + A
 			B := int(inst & 0x1ff)    //GETB
 			C := int(inst>>9) & 0x1ff //GETC
-			L.setFieldString(reg.Get(RA), L.rkString(B), L.rkValue(C))
+			tb := reg.Get(RA)
+			n := L.measure(tb)
+			L.setFieldString(tb, L.rkString(B), L.rkValue(C))
+			L.grown(tb, n)
 			return 0
 		},
 		func(L *LState, inst uint32, baseframe *callFrame) int { //OP_NEWTABLE
@@ -479,6 +491,9 @@ func init() {
 			RA := lbase + A
 			B := int(inst & 0x1ff)    //GETB
 			C := int(inst>>9) & 0x1ff //GETC
+			if L.meter != nil {
+				L.account(quotaTableSize + int64(B+C)*quotaSlotSize)
+			}
 			reg.Set(RA, newLTable(B, C))
 			return 0
 		},
@@ -716,7 +731,7 @@ func init() {
 				callable, meta = L.metaCall(lv)
 			}
 			// this section is inlined by go-inline
-			// source function is 'func (ls *Main) pushCallFrame(cf callFrame, fn LValue, meta bool) ' in '_state.go'
+			// source function is 'func (ls *LState) pushCallFrame(cf callFrame, fn LValue, meta bool) ' in '_state.go'
 			{
 				ls := L
 				cf := callFrame{Fn: callable, Pc: 0, Base: RA, LocalBase: RA + 1, ReturnBase: RA, NArgs: nargs, NRet: nret, Parent: cf, TailCall: 0}
@@ -729,12 +744,12 @@ func init() {
 					ls.RaiseError("attempt to call a non-function object")
 				}
 				if ls.stack.IsFull() {
-					ls.RaiseError("stack overflow")
+					ls.stackOverflow()
 				}
 				ls.stack.Push(cf)
 				newcf := ls.stack.Last()
 				// this section is inlined by go-inline
-				// source function is 'func (ls *Main) initCallFrame(cf *callFrame) ' in '_state.go'
+				// source function is 'func (ls *LState) initCallFrame(cf *callFrame) ' in '_state.go'
 				{
 					cf := newcf
 					if cf.Fn.IsG {
@@ -862,7 +877,7 @@ func init() {
 				L.RaiseError("attempt to call a non-function object")
 			}
 			// this section is inlined by go-inline
-			// source function is 'func (ls *Main) closeUpvalues(idx int) ' in '_state.go'
+			// source function is 'func (ls *LState) closeUpvalues(idx int) ' in '_state.go'
 			{
 				ls := L
 				idx := lbase
@@ -916,7 +931,7 @@ func init() {
 					L.reg.Insert(lv, cf.LocalBase)
 				}
 				// this section is inlined by go-inline
-				// source function is 'func (ls *Main) initCallFrame(cf *callFrame) ' in '_state.go'
+				// source function is 'func (ls *LState) initCallFrame(cf *callFrame) ' in '_state.go'
 				{
 					ls := L
 					if cf.Fn.IsG {
@@ -1066,7 +1081,7 @@ func init() {
 			RA := lbase + A
 			B := int(inst & 0x1ff) //GETB
 			// this section is inlined by go-inline
-			// source function is 'func (ls *Main) closeUpvalues(idx int) ' in '_state.go'
+			// source function is 'func (ls *LState) closeUpvalues(idx int) ' in '_state.go'
 			{
 				ls := L
 				idx := lbase
@@ -1096,7 +1111,7 @@ func init() {
 
 			if L.Parent != nil && L.stack.Sp() == 1 {
 				// this section is inlined by go-inline
-				// source function is 'func copyReturnValues(U *Main, regv, start, n, b int) ' in '_vm.go'
+				// source function is 'func copyReturnValues(L *LState, regv, start, n, b int) ' in '_vm.go'
 				{
 					regv := reg.Top()
 					start := RA
@@ -1206,7 +1221,7 @@ func init() {
 			}
 			islast := baseframe == L.stack.Pop() || L.stack.IsEmpty()
 			// this section is inlined by go-inline
-			// source function is 'func copyReturnValues(U *Main, regv, start, n, b int) ' in '_vm.go'
+			// source function is 'func copyReturnValues(L *LState, regv, start, n, b int) ' in '_vm.go'
 			{
 				regv := cf.ReturnBase
 				start := RA
@@ -1404,9 +1419,11 @@ func init() {
 			if B == 0 {
 				nelem = reg.Top() - RA - 1
 			}
+			n := L.measure(table)
 			for i := 1; i <= nelem; i++ {
 				table.RawSetInt(offset+i, reg.Get(RA+i))
 			}
+			L.grown(table, n)
 			return 0
 		},
 		func(L *LState, inst uint32, baseframe *callFrame) int { //OP_CLOSE
@@ -1415,7 +1432,7 @@ func init() {
 			A := int(inst>>18) & 0xff //GETA
 			RA := lbase + A
 			// this section is inlined by go-inline
-			// source function is 'func (ls *Main) closeUpvalues(idx int) ' in '_state.go'
+			// source function is 'func (ls *LState) closeUpvalues(idx int) ' in '_state.go'
 			{
 				ls := L
 				idx := RA
@@ -1651,6 +1668,13 @@ func stringConcat(L *LState, total, last int) LValue {
 				i--
 				total--
 			}
+			if L.meter != nil {
+				size := 0
+				for _, v := range buf {
+					size += len(v)
+				}
+				L.account(int64(size))
+			}
 			rhs = LString(strings.Join(buf, ""))
 		}
 	}
@@ -17,8 +17,14 @@ type IPMatch struct {
 }
 
 func (ipm *IPMatch) File(path string) error {
+	defer ipm.compact()
 	return libkit.ReadlineFunc(path, func(text string) (stop bool, e error) {
-		err := ipm.Add(text)
+		text = strings.TrimSpace(text)
+		if text == "" || text[0] == '#' {
+			return false, nil
+		}
+
+		err := ipm.add(text)
 		if err != nil {
 			return true, err
 		}
@@ -52,40 +58,82 @@ func (ipm *IPMatch) MatchIPv4(ip net.IP) bool {
 		return false
 	}
 
+	//区间有序且不重叠 找到最后一个 Start <= ip 的区间
 	ipNum := IP4ToUint32(ip)
 	i := sort.Search(n, func(i int) bool {
-		ip4 := ipm.IP4[i]
-		return ip4.Start <= ipNum && ipNum <= ip4.End
+		return ipm.IP4[i].Start > ipNum
 	})
 
-	if i < n && ipm.IP4[i].Start <= ipNum && ipNum <= ipm.IP4[i].End {
+	if i > 0 && ipNum <= ipm.IP4[i-1].End {
 		return true
 	}
 
 	return false
 }
 
-func (ipm *IPMatch) InsertIPv4(s, e net.IP) error {
+func (ipm *IPMatch) insert(s, e net.IP) error {
 	si, ei := IP4ToUint32(s), IP4ToUint32(e)
 	if si > ei {
 		return fmt.Errorf("ipv4 range start greater")
 	}
 
 	ipm.IP4 = append(ipm.IP4, IP4Range{si, ei})
+	return nil
+}
+
+// compact 排序并合并重叠的区间
+func (ipm *IPMatch) compact() {
+	n := len(ipm.IP4)
+	if n < 2 {
+		return
+	}
+
 	sort.Slice(ipm.IP4, func(i, j int) bool {
 		return ipm.IP4[i].Start < ipm.IP4[j].Start
 	})
+
+	ret := ipm.IP4[:1]
+	for _, item := range ipm.IP4[1:] {
+		last := &ret[len(ret)-1]
+		if item.Start <= last.End || (last.End != ^uint32(0) && item.Start == last.End+1) {
+			if item.End > last.End {
+				last.End = item.End
+			}
+			continue
+		}
+		ret = append(ret, item)
+	}
+	ipm.IP4 = ret
+}
+
+func (ipm *IPMatch) InsertIPv4(s, e net.IP) error {
+	if err := ipm.insert(s, e); err != nil {
+		return err
+	}
+	ipm.compact()
 	return nil
 }
 
 func (ipm *IPMatch) Add(v string) error {
+	if err := ipm.add(v); err != nil {
+		return err
+	}
+	ipm.compact()
+	return nil
+}
+
+func (ipm *IPMatch) add(v string) error {
+	if ipm.IP6 == nil {
+		ipm.IP6 = &IP6Range{}
+	}
+
 	if s := strings.Index(v, "-"); s != -1 {
 		sip := net.ParseIP(v[:s])
 		eip := net.ParseIP(v[s+1:])
 		sp4 := sip.To4()
 		ep4 := eip.To4()
 		if sp4 != nil && ep4 != nil {
-			return ipm.InsertIPv4(sp4, ep4)
+			return ipm.insert(sp4, ep4)
 		}
 
 		return fmt.Errorf("not ipv4 range %v", v)
@@ -93,7 +141,7 @@ func (ipm *IPMatch) Add(v string) error {
 
 	ip := net.ParseIP(v) // single ip
 	if ip4 := ip.To4(); ip4 != nil {
-		return ipm.InsertIPv4(ip4, ip4)
+		return ipm.insert(ip4, ip4)
 	}
 
 	if ip6 := ip.To16(); ip6 != nil {
@@ -101,13 +149,17 @@ func (ipm *IPMatch) Add(v string) error {
 		return nil
 	}
 
-	ip, _, err := net.ParseCIDR(v) // cidr ip range
+	ip, sub, err := net.ParseCIDR(v) // cidr ip range
 	if err != nil {
 		return err
 	}
 
-	if ip4 := ip.To4(); ip4 != nil {
-		return ipm.InsertIPv4(ip4, ip4)
+	if ip4 := sub.IP.To4(); ip4 != nil {
+		end := make(net.IP, net.IPv4len)
+		for i := 0; i < net.IPv4len; i++ {
+			end[i] = ip4[i] | ^sub.Mask[len(sub.Mask)-net.IPv4len+i]
+		}
+		return ipm.insert(ip4, end)
 	}
 
 	if ip6 := ip.To16(); ip6 != nil {
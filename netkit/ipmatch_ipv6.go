@@ -12,9 +12,15 @@ type IP6Range struct {
 
 func (ip6 *IP6Range) MatchRaw(ip string) bool {
 	if ip6.Map != nil {
-		_, ok := ip6.Map[ip]
-		return ok
+		if _, ok := ip6.Map[ip]; ok {
+			return true
+		}
 	}
+
+	if ip6.Tab == nil {
+		return false
+	}
+
 	addr, _ := netip.ParseAddr(ip)
 	_, ok := ip6.Tab.Lookup(addr)
 	return ok
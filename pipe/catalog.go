@@ -30,6 +30,7 @@ type Catalog struct {
 	errs   *errkit.JoinError
 	hijack Hijack
 	meta   Metadata
+	wait   chan struct{}
 }
 
 func (c *Catalog) String() string {
@@ -54,6 +55,13 @@ func (c *Catalog) errorf(format string, v ...any) {
 	c.err(e)
 }
 
+// Wait 等待异步执行完成 同步执行时直接返回
+func (c *Catalog) Wait() {
+	if c.wait != nil {
+		<-c.wait
+	}
+}
+
 func (c *Catalog) UnwrapErr() error {
 	return c.errs.Wrap()
 }
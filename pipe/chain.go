@@ -4,10 +4,12 @@ import (
 	"fmt"
 	"github.com/vela-public/onekit/errkit"
 	"github.com/vela-public/onekit/todo"
+	"sync/atomic"
 )
 
 type Chain struct {
 	handle []*Handler
+	async  atomic.Pointer[Async]
 }
 
 func (c *Chain) append(v *Handler) {
@@ -56,6 +58,11 @@ func (c *Chain) Execute(ctx *Catalog) {
 		return
 	}
 
+	if a := c.async.Load(); a != nil {
+		c.executeAsync(a, ctx)
+		return
+	}
+
 	if fn := ctx.hijack.Before; fn != nil {
 		if fn(ctx); ctx.hijack.Break {
 			return
@@ -86,6 +93,7 @@ func (c *Chain) Do(options ...func(*Catalog)) *Catalog {
 	}
 	ctx.errs = errkit.Errors()
 	c.Execute(ctx)
+	ctx.Wait()
 	return ctx
 }
 
@@ -97,6 +105,18 @@ func (c *Chain) Invokes(v []any, more ...func(ctx *Catalog)) {
 
 	ctx := NewCatalog(v...)(more...)
 	c.Execute(ctx)
+	ctx.Wait()
+}
+
+// Go 异步模式下投递后直接返回 读取结果前需要 ctx.Wait() 同步模式与 Invoke 相同
+func (c *Chain) Go(v any, more ...func(ctx *Catalog)) *Catalog {
+	ca := NewCatalog(v)(more...)
+	if len(c.handle) == 0 {
+		return ca
+	}
+
+	c.Execute(ca)
+	return ca
 }
 
 func (c *Chain) InvokeGo(v ...any) *Catalog {
@@ -108,6 +128,7 @@ func (c *Chain) InvokeGo(v ...any) *Catalog {
 	}
 
 	c.Execute(ca)
+	ca.Wait()
 	return ca
 }
 
@@ -119,6 +140,7 @@ func (c *Chain) Invoke(v any, more ...func(ctx *Catalog)) {
 
 	ca := NewCatalog(v)(more...)
 	c.Execute(ca)
+	ca.Wait()
 }
 
 func (c *Chain) NewHandler(v any, options ...func(*HandleEnv)) (r todo.Result[*Handler, error]) {
@@ -0,0 +1,264 @@
+package pipe
+
+import (
+	"context"
+	"fmt"
+	"github.com/vela-public/onekit/libkit"
+	"sort"
+	"sync"
+	"sync/atomic"
+	"time"
+	"unsafe"
+)
+
+// Async 异步执行 handler 投递到固定数量的worker
+// Workers: 并发数 Cache: 队列缓存 Timeout: 单个handler超时
+// Ordered: 同一个Catalog的handler在同一个worker上按顺序执行 否则每个handler独立并发
+//
+// 没有使用 gopool.Queue: Stop 后worker直接退出 队列中的task被丢弃 并且关闭channel时并发的 Push 会 panic
+// 异步模式要求投递的每个task都执行完 否则 Catalog.Wait 永远不返回
+//
+// lua handler 按父LState 串行执行 虚拟机不是协程安全的 不同虚拟机的handler 之间并发
+type Async struct {
+	Workers int
+	Cache   int
+	Timeout time.Duration
+	Ordered bool
+
+	mutex sync.RWMutex
+	stop  bool
+	once  sync.Once
+	done  chan struct{}
+	queue chan *task
+
+	// 每个父LState 一把锁 *lua.LState -> *sync.Mutex
+	vms sync.Map
+}
+
+// task 一次投递 Ordered 模式下 idx 为 -1 表示执行全部handler
+type task struct {
+	idx   int
+	chain *Chain
+	ctx   *Catalog
+	state *pending
+}
+
+// pending 记录一次异步执行的结果 全部完成后按顺序回调
+type pending struct {
+	size int32
+	errs []error
+}
+
+func Workers(n int) func(*Async) {
+	return func(a *Async) {
+		a.Workers = n
+	}
+}
+
+func Cache(n int) func(*Async) {
+	return func(a *Async) {
+		a.Cache = n
+	}
+}
+
+func Timeout(d time.Duration) func(*Async) {
+	return func(a *Async) {
+		a.Timeout = d
+	}
+}
+
+func Ordered(b bool) func(*Async) {
+	return func(a *Async) {
+		a.Ordered = b
+	}
+}
+
+func NewAsync(options ...func(*Async)) *Async {
+	a := &Async{
+		Workers: 4,
+	}
+
+	for _, fn := range options {
+		fn(a)
+	}
+
+	if a.Workers <= 0 {
+		a.Workers = 1
+	}
+
+	if a.Cache < 0 {
+		a.Cache = 0
+	}
+
+	a.done = make(chan struct{})
+	a.queue = make(chan *task, a.Cache)
+	for i := 0; i < a.Workers; i++ {
+		go a.worker()
+	}
+	return a
+}
+
+// worker 关闭后继续执行队列中剩余的task 保证每个Catalog都能完成
+func (a *Async) worker() {
+	for t := range a.queue {
+		a.run(t)
+	}
+}
+
+func (a *Async) Close() {
+	a.once.Do(func() {
+		close(a.done) //唤醒阻塞在队列上的push
+
+		a.mutex.Lock()
+		a.stop = true
+		close(a.queue)
+		a.mutex.Unlock()
+	})
+}
+
+// lock 锁住handler 用到的全部虚拟机 按地址顺序加锁避免死锁
+func (a *Async) lock(h *Handler) func() {
+	vms := h.vms(nil)
+	if len(vms) == 0 {
+		return func() {}
+	}
+
+	sort.Slice(vms, func(i, j int) bool {
+		return uintptr(unsafe.Pointer(vms[i])) < uintptr(unsafe.Pointer(vms[j]))
+	})
+
+	mutexes := make([]*sync.Mutex, len(vms))
+	for i, vm := range vms {
+		v, _ := a.vms.LoadOrStore(vm, &sync.Mutex{})
+		mutexes[i] = v.(*sync.Mutex)
+		mutexes[i].Lock()
+	}
+
+	return func() {
+		for i := len(mutexes) - 1; i >= 0; i-- {
+			mutexes[i].Unlock()
+		}
+	}
+}
+
+// call 执行单个handler panic 转为错误
+// lua handler 超时后中断虚拟机 返回超时错误
+// go handler 无法中断 保留实际结果 超时记录在 Stats 的 overrun 并计入熔断
+func (a *Async) call(h *Handler, ctx *Catalog) (err error) {
+	defer func() {
+		if e := recover(); e != nil {
+			err = fmt.Errorf("panic:%v\n%s", e, libkit.StackTrace[string](1024, false))
+		}
+	}()
+
+	unlock := a.lock(h)
+	defer unlock()
+
+	if a.Timeout <= 0 {
+		return h.Invoke(ctx)
+	}
+
+	start := time.Now()
+	if h.lfunc == nil {
+		err = h.within(ctx, a.Timeout)
+	} else {
+		tc, cancel := context.WithTimeout(context.Background(), a.Timeout)
+		defer cancel()
+		err = h.guard(ctx, func(c *Catalog) error {
+			//中断后虚拟机不一定返回错误 以上下文为准
+			if e := h.LFuncContext(tc, h.lfunc, c); tc.Err() == nil {
+				return e
+			}
+			return fmt.Errorf("timeout %s", a.Timeout)
+		})
+	}
+
+	if time.Since(start) >= a.Timeout {
+		atomic.AddUint64(&h.metrics.overrun, 1)
+	}
+	return err
+}
+
+func (a *Async) run(t *task) {
+	if t.idx >= 0 {
+		t.state.errs[t.idx] = a.call(t.chain.handle[t.idx], t.ctx)
+	} else {
+		for i, h := range t.chain.handle {
+			t.state.errs[i] = a.call(h, t.ctx)
+		}
+	}
+
+	if atomic.AddInt32(&t.state.size, -1) == 0 {
+		t.chain.finish(t.ctx, t.state)
+	}
+}
+
+// push 队列关闭后在当前协程执行 保证pending 最终归零
+func (a *Async) push(t *task) {
+	a.mutex.RLock()
+	if a.stop {
+		a.mutex.RUnlock()
+		a.run(t)
+		return
+	}
+
+	select {
+	case a.queue <- t:
+		a.mutex.RUnlock()
+	case <-a.done:
+		a.mutex.RUnlock()
+		a.run(t)
+	}
+}
+
+// Async 开启异步执行 重复调用会关闭之前的队列 已投递的task继续执行
+func (c *Chain) Async(options ...func(*Async)) *Async {
+	a := NewAsync(options...)
+	if old := c.async.Swap(a); old != nil {
+		old.Close()
+	}
+	return a
+}
+
+func (c *Chain) Close() {
+	if a := c.async.Load(); a != nil {
+		a.Close()
+	}
+}
+
+// finish 全部handler完成后 按照handler顺序处理错误 然后回调 After
+func (c *Chain) finish(ctx *Catalog, state *pending) {
+	for i, err := range state.errs {
+		c.TryCatch(ctx, i, err)
+	}
+
+	if fn := ctx.hijack.After; fn != nil {
+		fn(ctx)
+	}
+
+	close(ctx.wait)
+}
+
+func (c *Chain) executeAsync(a *Async, ctx *Catalog) {
+	sz := len(c.handle)
+	ctx.wait = make(chan struct{})
+
+	if fn := ctx.hijack.Before; fn != nil {
+		if fn(ctx); ctx.hijack.Break {
+			close(ctx.wait)
+			return
+		}
+	}
+
+	state := &pending{errs: make([]error, sz)}
+	if a.Ordered {
+		state.size = 1
+		a.push(&task{idx: -1, chain: c, ctx: ctx, state: state})
+		return
+	}
+
+	state.size = int32(sz)
+	for i := 0; i < sz; i++ {
+		a.push(&task{idx: i, chain: c, ctx: ctx, state: state})
+	}
+}
@@ -0,0 +1,261 @@
+package pipe
+
+import (
+	"errors"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/vela-public/onekit/lua"
+)
+
+// go handler 超时保留实际结果 记录 overrun worker 数量限制并发
+func TestAsyncTimeout(t *testing.T) {
+	var running, peak, finished int32
+	c := NewChain()
+	c.NewHandler(func(v any) {
+		n := atomic.AddInt32(&running, 1)
+		for {
+			old := atomic.LoadInt32(&peak)
+			if n <= old || atomic.CompareAndSwapInt32(&peak, old, n) {
+				break
+			}
+		}
+		time.Sleep(30 * time.Millisecond)
+		atomic.AddInt32(&running, -1)
+		atomic.AddInt32(&finished, 1)
+	})
+
+	c.Async(Workers(1), Timeout(5*time.Millisecond))
+	defer c.Close()
+
+	var cas []*Catalog
+	for i := 0; i < 3; i++ {
+		ca := NewCatalog(i)()
+		c.Execute(ca)
+		cas = append(cas, ca)
+	}
+
+	for i, ca := range cas {
+		ca.Wait()
+		if err := ca.UnwrapErr(); err != nil {
+			t.Fatalf("catalog %d got %v want nil", i, err)
+		}
+	}
+
+	if st := c.Stats()[0]; st.Overrun != 3 || st.Errors != 0 {
+		t.Fatalf("got %+v want 3 overrun", st)
+	}
+
+	if n := atomic.LoadInt32(&finished); n != 3 {
+		t.Fatalf("finished %d want 3", n)
+	}
+
+	if n := atomic.LoadInt32(&peak); n != 1 {
+		t.Fatalf("peak %d want 1", n)
+	}
+}
+
+// 非顺序模式 错误按handler顺序记录
+func TestAsyncUnordered(t *testing.T) {
+	var count int32
+	c := NewChain()
+	for i := 0; i < 4; i++ {
+		fail := i%2 == 1
+		c.NewHandler(func(v any) error {
+			atomic.AddInt32(&count, 1)
+			if fail {
+				return errors.New("fail")
+			}
+			return nil
+		})
+	}
+
+	c.Async(Workers(4))
+	defer c.Close()
+
+	ca := c.InvokeGo("a")
+	if n := atomic.LoadInt32(&count); n != 4 {
+		t.Fatalf("count %d want 4", n)
+	}
+
+	err := ca.UnwrapErr()
+	if err == nil || !strings.Contains(err.Error(), "handle.1") || !strings.Contains(err.Error(), "handle.3") {
+		t.Fatalf("got %v", err)
+	}
+}
+
+// 关闭后投递 或者阻塞在队列上时关闭 都不能死锁
+func TestAsyncClose(t *testing.T) {
+	release := make(chan struct{})
+	c := NewChain()
+	c.NewHandler(func(v any) {
+		if v == "block" {
+			<-release
+		}
+	})
+
+	a := c.Async(Workers(1), Ordered(true))
+	first := NewCatalog("block")()
+	c.Execute(first)
+
+	done := make(chan struct{})
+	go func() {
+		// 唯一的worker 被阻塞 队列无缓存 push 阻塞到关闭
+		c.InvokeGo("next")
+		close(done)
+	}()
+
+	time.Sleep(10 * time.Millisecond)
+	a.Close()
+
+	select {
+	case <-done:
+	case <-time.After(time.Second):
+		t.Fatal("push blocked after close")
+	}
+
+	close(release)
+	first.Wait()
+
+	c.InvokeGo("after")
+	c.Async(Workers(2))
+	c.Close()
+	c.InvokeGo("closed")
+}
+
+// lua handler 超时中断虚拟机
+func TestAsyncLuaTimeout(t *testing.T) {
+	L := lua.NewState()
+	defer L.Close()
+
+	fn, err := L.LoadString("while true do end")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	c := NewChain()
+	c.NewHandler(fn, LState(L))
+	c.Async(Workers(2), Timeout(20*time.Millisecond))
+	defer c.Close()
+
+	done := make(chan *Catalog)
+	go func() {
+		done <- c.InvokeGo(1)
+	}()
+
+	select {
+	case ca := <-done:
+		if err := ca.UnwrapErr(); err == nil || !strings.Contains(err.Error(), "timeout") {
+			t.Fatalf("got %v want timeout", err)
+		}
+	case <-time.After(2 * time.Second):
+		t.Fatal("lua handler not interrupted")
+	}
+}
+
+// lua handler 共享父LState 异步执行时串行
+func TestAsyncLuaSerial(t *testing.T) {
+	L := lua.NewState()
+	defer L.Close()
+
+	if err := L.DoString("count = 0"); err != nil {
+		t.Fatal(err)
+	}
+
+	fn, err := L.LoadString("count = count + 1")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	c := NewChain()
+	for i := 0; i < 4; i++ {
+		c.NewHandler(fn, LState(L))
+	}
+	c.Async(Workers(4))
+	defer c.Close()
+
+	for i := 0; i < 50; i++ {
+		c.InvokeGo(i)
+	}
+
+	if n := lua.LVAsNumber(L.GetGlobal("count")); n != 200 {
+		t.Fatalf("count %v want 200", n)
+	}
+}
+
+// 不同虚拟机的lua handler 并发执行
+func TestAsyncLuaParallel(t *testing.T) {
+	var arrived int32
+	both := make(chan struct{})
+	barrier := func(L *lua.LState) int {
+		if atomic.AddInt32(&arrived, 1) == 2 {
+			close(both)
+		}
+
+		select {
+		case <-both:
+			L.Push(lua.LTrue)
+		case <-time.After(time.Second):
+			L.Push(lua.LFalse)
+		}
+		return 1
+	}
+
+	c := NewChain()
+	for i := 0; i < 2; i++ {
+		L := lua.NewState()
+		defer L.Close()
+		L.SetGlobal("barrier", L.NewFunction(barrier))
+		fn, err := L.LoadString(`if not barrier() then error("serialized") end`)
+		if err != nil {
+			t.Fatal(err)
+		}
+		c.NewHandler(fn, LState(L))
+	}
+
+	c.Async(Workers(2))
+	defer c.Close()
+
+	if err := c.InvokeGo(1).UnwrapErr(); err != nil {
+		t.Fatal(err)
+	}
+}
+
+// Do Invoke 等待全部handler Go 直接返回
+func TestAsyncWait(t *testing.T) {
+	release := make(chan struct{})
+	var finished int32
+	c := NewChain()
+	c.NewHandler(func(v any) error {
+		if v == "block" {
+			<-release
+		}
+		atomic.AddInt32(&finished, 1)
+		return errors.New("fail")
+	})
+
+	c.Async(Workers(2))
+	defer c.Close()
+
+	ca := c.Go("block")
+	if n := atomic.LoadInt32(&finished); n != 0 {
+		t.Fatalf("finished %d before release", n)
+	}
+	close(release)
+	ca.Wait()
+	if ca.UnwrapErr() == nil {
+		t.Fatal("want error after wait")
+	}
+
+	c.Invoke("a")
+	if n := atomic.LoadInt32(&finished); n != 2 {
+		t.Fatalf("invoke returned before handler finished %d", n)
+	}
+
+	ca = c.Do(Param("b"))
+	if n := atomic.LoadInt32(&finished); n != 3 || ca.UnwrapErr() == nil {
+		t.Fatalf("do returned before handler finished %d %v", n, ca.UnwrapErr())
+	}
+}
@@ -1,6 +1,9 @@
 package pipe
 
-import "github.com/vela-public/onekit/lua"
+import (
+	"github.com/vela-public/onekit/lua"
+	"time"
+)
 
 func (c *Chain) String() string                         { return "pipe.chain" }
 func (c *Chain) Type() lua.LValueType                   { return lua.LTObject }
@@ -20,12 +23,48 @@ func (c *Chain) InvokeL(L *lua.LState) int {
 	return 0
 }
 
+// AsyncL chain.async(workers , timeout_ms , ordered)
+func (c *Chain) AsyncL(L *lua.LState) int {
+	c.Async(
+		Workers(L.IsInt(1)),
+		Timeout(time.Duration(L.IsInt(2))*time.Millisecond),
+		Ordered(L.IsTrue(3)),
+	)
+	L.Push(c)
+	return 1
+}
+
+// BreakerL chain.breaker(threshold , cooldown_sec)
+func (c *Chain) BreakerL(L *lua.LState) int {
+	c.Breaker(L.IsInt(1), time.Duration(L.IsInt(2))*time.Second)
+	L.Push(c)
+	return 1
+}
+
+func (c *Chain) StatsL(L *lua.LState) int {
+	L.Push(c.Stats())
+	return 1
+}
+
+func (c *Chain) CloseL(L *lua.LState) int {
+	c.Close()
+	return 0
+}
+
 func (c *Chain) Index(L *lua.LState, key string) lua.LValue {
 	switch key {
 	case "len":
 		return lua.LInt(c.Len())
 	case "do":
 		return lua.NewFunction(c.InvokeL)
+	case "async":
+		return lua.NewFunction(c.AsyncL)
+	case "breaker":
+		return lua.NewFunction(c.BreakerL)
+	case "stats":
+		return lua.NewFunction(c.StatsL)
+	case "close":
+		return lua.NewFunction(c.CloseL)
 	}
 	return lua.LNil
 }
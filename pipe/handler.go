@@ -1,19 +1,26 @@
 package pipe
 
 import (
+	"context"
+	"errors"
 	"fmt"
 	"github.com/vela-public/onekit/errkit"
 	"github.com/vela-public/onekit/lua"
 	"io"
 	"runtime"
 	"strconv"
+	"sync/atomic"
+	"time"
 )
 
 type Handler struct {
-	env    *HandleEnv
-	data   any
-	info   error
-	invoke func(*Catalog) error
+	env     *HandleEnv
+	data    any
+	info    error
+	invoke  func(*Catalog) error
+	lfunc   *lua.LFunction
+	metrics metrics
+	breaker atomic.Pointer[Breaker]
 }
 
 func (h *Handler) Data() any {
@@ -65,16 +72,23 @@ func (h *Handler) Call(fn func(v any) error, ctx *Catalog) error {
 	return errs.Wrap()
 }
 
+// recovered Protect 恢复的panic 已经通过 ctx.errorf 通知 只用于计入熔断 Invoke 返回前去掉
+type recovered struct {
+	error
+}
+
 func (h *Handler) SafeCall(fn func(c *Catalog) error) func(ctx *Catalog) error {
 	if h.env == nil || !h.env.Protect {
 		return fn
 	}
-	return func(ctx *Catalog) error {
+	return func(ctx *Catalog) (err error) {
 		defer func() {
 			if e := recover(); e != nil {
+				atomic.AddUint64(&h.metrics.panics, 1)
 				buff := make([]byte, 4096)
 				n := runtime.Stack(buff, false)
 				ctx.errorf("panic:%v\n%s", e, string(buff[:n]))
+				err = &recovered{fmt.Errorf("panic:%v", e)}
 			}
 		}()
 		return fn(ctx)
@@ -89,11 +103,109 @@ func (h *Handler) LFunc(fn *lua.LFunction, ctx *Catalog) error {
 	return h.env.PCall(fn, ctx)
 }
 
+// LFuncContext 虚拟机在 cx 结束后中断执行
+func (h *Handler) LFuncContext(cx context.Context, fn *lua.LFunction, ctx *Catalog) error {
+	if h.env == nil {
+		return fmt.Errorf("pipe pcall env is nil")
+	}
+
+	return h.env.PCallContext(cx, fn, ctx)
+}
+
+// vms handler 调用的lua虚拟机 异步执行时同一个虚拟机不能并发
+func (h *Handler) vms(dst []*lua.LState) []*lua.LState {
+	if h.lfunc != nil && h.env != nil && h.env.Parent != nil {
+		for _, vm := range dst {
+			if vm == h.env.Parent {
+				return dst
+			}
+		}
+		return append(dst, h.env.Parent)
+	}
+
+	switch vt := h.data.(type) {
+	case *Handler:
+		return vt.vms(dst)
+	case *Chain:
+		for _, sub := range vt.handle {
+			dst = sub.vms(dst)
+		}
+	}
+	return dst
+}
+
 func (h *Handler) Invoke(a *Catalog) error {
+	return h.within(a, 0)
+}
+
+// within timeout 大于0时 超时返回的调用计入熔断失败 返回实际结果
+func (h *Handler) within(a *Catalog, timeout time.Duration) error {
 	if h.invoke == nil {
 		return h.info
 	}
-	return h.invoke(a)
+
+	err := h.guardWithin(a, timeout, h.invoke)
+	var rec *recovered
+	if errors.As(err, &rec) {
+		return nil
+	}
+	return err
+}
+
+// guard 熔断和统计 invoke 为实际执行的函数
+func (h *Handler) guard(a *Catalog, invoke func(*Catalog) error) error {
+	return h.guardWithin(a, 0, invoke)
+}
+
+func (h *Handler) guardWithin(a *Catalog, timeout time.Duration, invoke func(*Catalog) error) error {
+	breaker := h.breaker.Load()
+	if breaker == nil {
+		return h.observe(a, invoke)
+	}
+
+	ok, state, changed := breaker.allow()
+	if changed {
+		a.errorf("handle %s breaker %s", h.Name(), state)
+	}
+
+	if !ok {
+		atomic.AddUint64(&h.metrics.skip, 1)
+		return nil
+	}
+
+	defer func() {
+		if e := recover(); e != nil {
+			breaker.done(fmt.Errorf("panic:%v", e))
+			panic(e)
+		}
+	}()
+
+	start := time.Now()
+	err := h.observe(a, invoke)
+	fail := err
+	if fail == nil && timeout > 0 && time.Since(start) >= timeout {
+		fail = fmt.Errorf("timeout %s", timeout)
+	}
+
+	if state, changed = breaker.done(fail); changed {
+		a.errorf("handle %s breaker %s", h.Name(), state)
+	}
+	return err
+}
+
+// observe 记录调用次数 耗时 panic 后继续向上抛出
+func (h *Handler) observe(a *Catalog, invoke func(*Catalog) error) (err error) {
+	start := time.Now()
+	defer func() {
+		if e := recover(); e != nil {
+			atomic.AddUint64(&h.metrics.panics, 1)
+			h.metrics.observe(time.Since(start), fmt.Errorf("panic:%v", e))
+			panic(e)
+		}
+		h.metrics.observe(time.Since(start), err)
+	}()
+
+	return invoke(a)
 }
 
 func NewInvokerFunc(h *Handler, v any) {
@@ -125,6 +237,7 @@ func NewInvokerFunc(h *Handler, v any) {
 		})
 
 	case *lua.LFunction:
+		h.lfunc = vt
 		h.invoke = func(c *Catalog) error {
 			return h.LFunc(vt, c)
 		}
@@ -166,5 +279,9 @@ func NewInvokerFunc(h *Handler, v any) {
 
 func (h *Handler) prepare(v any) {
 	h.data = v
+	h.metrics.buckets = make([]uint64, len(Buckets)+1)
+	if h.env != nil && h.env.Threshold > 0 {
+		h.breaker.Store(NewBreaker(h.env.Threshold, h.env.Cooldown))
+	}
 	NewInvokerFunc(h, v)
 }
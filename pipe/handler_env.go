@@ -1,17 +1,26 @@
 package pipe
 
 import (
+	"context"
 	"github.com/vela-public/onekit/lua"
+	"time"
 )
 
 type HandleEnv struct {
-	Protect bool
-	Seek    int
-	Error   func(*Catalog, error)
-	Parent  *lua.LState
+	Protect   bool
+	Seek      int
+	Threshold int
+	Cooldown  time.Duration
+	Error     func(*Catalog, error)
+	Parent    *lua.LState
 }
 
 func (he *HandleEnv) PCall(fn *lua.LFunction, ctx *Catalog) error {
+	return he.PCallContext(nil, fn, ctx)
+}
+
+// PCallContext cx 不为空时 虚拟机在 cx 结束后中断执行
+func (he *HandleEnv) PCallContext(cx context.Context, fn *lua.LFunction, ctx *Catalog) error {
 	cp := lua.P{
 		Protect: he.Protect,
 		NRet:    0,
@@ -20,6 +29,10 @@ func (he *HandleEnv) PCall(fn *lua.LFunction, ctx *Catalog) error {
 
 	sz := len(ctx.data)
 	co := he.Parent.Coroutine() //pipe.Lua(L , pipe.LState(L) , pipe.Seek(1))
+	prev := co.Context()
+	if cx != nil {
+		co.SetContext(cx)
+	}
 
 	var err error
 	switch sz {
@@ -38,6 +51,15 @@ func (he *HandleEnv) PCall(fn *lua.LFunction, ctx *Catalog) error {
 		err = co.CallByParam(cp, param...)
 	}
 
+	//归还前恢复 避免复用的协程继承超时
+	if cx != nil {
+		if prev != nil {
+			co.SetContext(prev)
+		} else {
+			co.RemoveContext()
+		}
+	}
+
 	if err == nil {
 		he.Parent.Keepalive(co)
 	}
@@ -57,6 +79,16 @@ func Clone(e *HandleEnv) func(env *HandleEnv) {
 		env.Seek = e.Seek
 		env.Error = e.Error
 		env.Parent = e.Parent
+		env.Threshold = e.Threshold
+		env.Cooldown = e.Cooldown
+	}
+}
+
+// Threshold 连续错误 n 次后熔断 cooldown 后恢复探测
+func Threshold(n int, cooldown time.Duration) func(*HandleEnv) {
+	return func(e *HandleEnv) {
+		e.Threshold = n
+		e.Cooldown = cooldown
 	}
 }
 
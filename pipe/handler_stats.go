@@ -0,0 +1,250 @@
+package pipe
+
+import (
+	"encoding/json"
+	"fmt"
+	"github.com/vela-public/onekit/cast"
+	"github.com/vela-public/onekit/lua"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// 耗时分布 最后一个桶记录超过5s的调用
+var Buckets = []time.Duration{
+	time.Millisecond,
+	5 * time.Millisecond,
+	10 * time.Millisecond,
+	50 * time.Millisecond,
+	100 * time.Millisecond,
+	500 * time.Millisecond,
+	time.Second,
+	5 * time.Second,
+}
+
+type metrics struct {
+	invoke  uint64
+	errors  uint64
+	panics  uint64
+	skip    uint64
+	overrun uint64 // 异步执行超过 Timeout
+	elapsed int64
+	buckets []uint64
+}
+
+func (m *metrics) observe(d time.Duration, err error) {
+	if m.buckets == nil {
+		return
+	}
+
+	atomic.AddUint64(&m.invoke, 1)
+	atomic.AddInt64(&m.elapsed, int64(d))
+	if err != nil {
+		atomic.AddUint64(&m.errors, 1)
+	}
+
+	for i, b := range Buckets {
+		if d <= b {
+			atomic.AddUint64(&m.buckets[i], 1)
+			return
+		}
+	}
+	atomic.AddUint64(&m.buckets[len(Buckets)], 1)
+}
+
+const (
+	BreakerClosed BreakerState = iota
+	BreakerOpen
+	BreakerHalfOpen
+)
+
+type BreakerState uint8
+
+func (s BreakerState) String() string {
+	switch s {
+	case BreakerClosed:
+		return "closed"
+	case BreakerOpen:
+		return "open"
+	case BreakerHalfOpen:
+		return "half-open"
+	default:
+		return "unknown"
+	}
+}
+
+// Breaker 熔断 连续 Threshold 次错误后跳过该handler Cooldown 后放行一次探测
+// 探测超过 Cooldown 仍未返回 放行下一次探测
+type Breaker struct {
+	Threshold int
+	Cooldown  time.Duration
+
+	mutex sync.Mutex
+	state BreakerState
+	fails int
+	until time.Time
+}
+
+// allow 是否允许执行 返回状态变化
+func (b *Breaker) allow() (bool, BreakerState, bool) {
+	b.mutex.Lock()
+	defer b.mutex.Unlock()
+
+	switch b.state {
+	case BreakerOpen:
+		if time.Now().Before(b.until) {
+			return false, b.state, false
+		}
+		b.state = BreakerHalfOpen
+		b.until = time.Now().Add(b.Cooldown)
+		return true, b.state, true
+	case BreakerHalfOpen:
+		//探测中 其他调用跳过
+		if time.Now().Before(b.until) {
+			return false, b.state, false
+		}
+		b.until = time.Now().Add(b.Cooldown)
+		return true, b.state, false
+	default:
+		return true, b.state, false
+	}
+}
+
+// done 记录执行结果 返回状态变化
+func (b *Breaker) done(err error) (BreakerState, bool) {
+	b.mutex.Lock()
+	defer b.mutex.Unlock()
+
+	prev := b.state
+	if err == nil {
+		b.fails = 0
+		b.state = BreakerClosed
+		return b.state, prev != b.state
+	}
+
+	b.fails++
+	if b.state == BreakerHalfOpen || b.fails >= b.Threshold {
+		b.state = BreakerOpen
+		b.until = time.Now().Add(b.Cooldown)
+	}
+	return b.state, prev != b.state
+}
+
+func (b *Breaker) State() BreakerState {
+	b.mutex.Lock()
+	defer b.mutex.Unlock()
+	return b.state
+}
+
+func NewBreaker(threshold int, cooldown time.Duration) *Breaker {
+	if threshold <= 0 {
+		threshold = 5
+	}
+
+	if cooldown <= 0 {
+		cooldown = 30 * time.Second
+	}
+
+	return &Breaker{Threshold: threshold, Cooldown: cooldown}
+}
+
+// HandlerStats 单个handler的统计 Latency 对应 Buckets 最后一个为超出部分
+type HandlerStats struct {
+	Index   int      `json:"index"`
+	Name    string   `json:"name"`
+	Invoke  uint64   `json:"invoke"`
+	Errors  uint64   `json:"errors"`
+	Panics  uint64   `json:"panics"`
+	Skip    uint64   `json:"skip"`
+	Overrun uint64   `json:"overrun"`
+	Avg     string   `json:"avg"`
+	Latency []uint64 `json:"latency"`
+	Breaker string   `json:"breaker,omitempty"`
+}
+
+func (h *Handler) Name() string {
+	return fmt.Sprintf("%T", h.data)
+}
+
+func (h *Handler) Stats() HandlerStats {
+	m := &h.metrics
+	st := HandlerStats{
+		Name:    h.Name(),
+		Invoke:  atomic.LoadUint64(&m.invoke),
+		Errors:  atomic.LoadUint64(&m.errors),
+		Panics:  atomic.LoadUint64(&m.panics),
+		Skip:    atomic.LoadUint64(&m.skip),
+		Overrun: atomic.LoadUint64(&m.overrun),
+		Latency: make([]uint64, len(Buckets)+1),
+	}
+
+	for i := range st.Latency {
+		if i < len(m.buckets) {
+			st.Latency[i] = atomic.LoadUint64(&m.buckets[i])
+		}
+	}
+
+	var avg time.Duration
+	if st.Invoke > 0 {
+		avg = time.Duration(atomic.LoadInt64(&m.elapsed) / int64(st.Invoke))
+	}
+	st.Avg = avg.String()
+
+	if b := h.breaker.Load(); b != nil {
+		st.Breaker = b.State().String()
+	}
+	return st
+}
+
+type Stats []HandlerStats
+
+func (s Stats) Json() []byte {
+	text, _ := json.Marshal(s)
+	return text
+}
+
+func (s Stats) String() string                         { return cast.B2S(s.Json()) }
+func (s Stats) Type() lua.LValueType                   { return lua.LTObject }
+func (s Stats) AssertFloat64() (float64, bool)         { return float64(len(s)), true }
+func (s Stats) AssertString() (string, bool)           { return s.String(), true }
+func (s Stats) AssertFunction() (*lua.LFunction, bool) { return nil, false }
+func (s Stats) Hijack(*lua.CallFrameFSM) bool          { return false }
+
+func (s Stats) Index(L *lua.LState, key string) lua.LValue {
+	switch key {
+	case "size":
+		return lua.LInt(len(s))
+	case "json":
+		return lua.S2L(s.String())
+	case "errors":
+		var n uint64
+		for _, st := range s {
+			n += st.Errors
+		}
+		return lua.LNumber(n)
+	case "invoke":
+		var n uint64
+		for _, st := range s {
+			n += st.Invoke
+		}
+		return lua.LNumber(n)
+	}
+	return lua.LNil
+}
+
+// Stats 每个handler的调用次数 错误 panic 耗时分布
+func (c *Chain) Stats() Stats {
+	stats := make(Stats, len(c.handle))
+	for i, h := range c.handle {
+		stats[i] = h.Stats()
+		stats[i].Index = i
+	}
+	return stats
+}
+
+// Breaker 为所有handler开启熔断
+func (c *Chain) Breaker(threshold int, cooldown time.Duration) {
+	for _, h := range c.handle {
+		h.breaker.Store(NewBreaker(threshold, cooldown))
+	}
+}
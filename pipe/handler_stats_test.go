@@ -0,0 +1,120 @@
+package pipe
+
+import (
+	"errors"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+// Protect 恢复的panic 只通过 ctx.errorf 通知一次 计入熔断
+func TestBreakerPanic(t *testing.T) {
+	c := NewChain()
+	c.NewHandler(func(v any) {
+		panic("boom")
+	}, Threshold(2, time.Minute))
+
+	for i := 0; i < 3; i++ {
+		var panics, exceptions int
+		ca := NewCatalog(i)(Error(func(err error) {
+			if strings.HasPrefix(err.Error(), "panic:boom") {
+				panics++
+			}
+		}), Exception(func(_ *Catalog, err error) {
+			exceptions++
+		}))
+		c.Execute(ca)
+
+		if ca.UnwrapErr() != nil {
+			t.Fatalf("call %d recovered panic returned %v", i, ca.UnwrapErr())
+		}
+
+		if i < 2 && (panics != 1 || exceptions < 1) {
+			t.Fatalf("call %d panic notified %d exception %d", i, panics, exceptions)
+		}
+	}
+
+	st := c.Stats()[0]
+	if st.Panics != 2 || st.Skip != 1 || st.Breaker != "open" {
+		t.Fatalf("got %+v", st)
+	}
+}
+
+func TestBreakerState(t *testing.T) {
+	fail := errors.New("fail")
+	b := NewBreaker(2, 20*time.Millisecond)
+
+	steps := []struct {
+		name  string
+		run   func() bool
+		state BreakerState
+	}{
+		{"fail 1", func() bool { b.done(fail); return true }, BreakerClosed},
+		{"fail 2", func() bool { b.done(fail); return true }, BreakerOpen},
+		{"open skip", func() bool { ok, _, _ := b.allow(); return !ok }, BreakerOpen},
+		{"cooldown probe", func() bool { time.Sleep(25 * time.Millisecond); ok, _, _ := b.allow(); return ok }, BreakerHalfOpen},
+		{"probing skip", func() bool { ok, _, _ := b.allow(); return !ok }, BreakerHalfOpen},
+		{"probe timeout", func() bool { time.Sleep(25 * time.Millisecond); ok, _, _ := b.allow(); return ok }, BreakerHalfOpen},
+		{"probe fail", func() bool { b.done(fail); return true }, BreakerOpen},
+		{"probe ok", func() bool { time.Sleep(25 * time.Millisecond); ok, _, _ := b.allow(); b.done(nil); return ok }, BreakerClosed},
+	}
+
+	for _, step := range steps {
+		if !step.run() {
+			t.Fatalf("%s unexpected allow", step.name)
+		}
+
+		if s := b.State(); s != step.state {
+			t.Fatalf("%s got %s want %s", step.name, s, step.state)
+		}
+	}
+}
+
+// 运行中开启熔断
+func TestBreakerConcurrent(t *testing.T) {
+	c := NewChain()
+	c.NewHandler(func(v any) error { return nil })
+
+	var wg sync.WaitGroup
+	for i := 0; i < 4; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for j := 0; j < 100; j++ {
+				c.Invoke(j)
+			}
+		}()
+	}
+
+	for i := 0; i < 10; i++ {
+		c.Breaker(3, time.Second)
+	}
+	wg.Wait()
+
+	if st := c.Stats()[0]; st.Invoke != 400 || st.Breaker != "closed" {
+		t.Fatalf("got %+v", st)
+	}
+}
+
+// 异步超时的go handler 保留结果 计入熔断
+func TestBreakerOverrun(t *testing.T) {
+	c := NewChain()
+	c.NewHandler(func(v any) {
+		time.Sleep(10 * time.Millisecond)
+	}, Threshold(2, time.Minute))
+
+	c.Async(Workers(1), Timeout(time.Millisecond))
+	defer c.Close()
+
+	for i := 0; i < 3; i++ {
+		if err := c.InvokeGo(i).UnwrapErr(); err != nil {
+			t.Fatalf("call %d got %v", i, err)
+		}
+	}
+
+	st := c.Stats()[0]
+	if st.Overrun != 2 || st.Skip != 1 || st.Breaker != "open" {
+		t.Fatalf("got %+v", st)
+	}
+}
@@ -0,0 +1,288 @@
+package ruleset
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"fmt"
+	"github.com/vela-public/onekit/cast"
+	"github.com/vela-public/onekit/cond"
+	"github.com/vela-public/onekit/lua"
+	"github.com/vela-public/onekit/luakit"
+	"github.com/vela-public/onekit/pipe"
+	"github.com/vela-public/onekit/treekit"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// 规则目录 文件名(不含后缀)为规则名
+// *.lua : 返回处理函数 或者 {handler = fn , priority = 10 , tags = {"a"} , enable = true}
+// *.cnd : 每行一个条件 同时满足时命中 # priority: 10 , # tags: a,b , # enable: false 设置属性
+const (
+	ExtLua  = ".lua"
+	ExtCond = ".cnd"
+)
+
+// Dir 从目录加载规则 interval 检查变化的间隔
+func (rs *RuleSet) Dir(path string, interval time.Duration) {
+	if interval <= 0 {
+		interval = 5 * time.Second
+	}
+
+	rs.dir = path
+	rs.interval = interval
+}
+
+// fingerprint 目录中规则文件的名称 大小 修改时间
+func (rs *RuleSet) fingerprint() ([]string, string, error) {
+	entries, err := os.ReadDir(rs.dir)
+	if err != nil {
+		return nil, "", err
+	}
+
+	var files []string
+	var buf bytes.Buffer
+	for _, entry := range entries {
+		if entry.IsDir() {
+			continue
+		}
+
+		switch filepath.Ext(entry.Name()) {
+		case ExtLua, ExtCond:
+		default:
+			continue
+		}
+
+		info, e := entry.Info()
+		if e != nil {
+			continue
+		}
+
+		files = append(files, filepath.Join(rs.dir, entry.Name()))
+		fmt.Fprintf(&buf, "%s:%d:%d;", entry.Name(), info.Size(), info.ModTime().UnixNano())
+	}
+
+	sort.Strings(files)
+	return files, buf.String(), nil
+}
+
+// Reload 重新加载目录 任意文件失败时保留原有规则
+func (rs *RuleSet) Reload() error {
+	_, err := rs.reload(true)
+	return err
+}
+
+// reload 目录没有变化且 force 为 false 时跳过 返回是否重新加载
+// 失败时同样记录指纹 文件再次变化前不重复报错
+func (rs *RuleSet) reload(force bool) (bool, error) {
+	rs.loading.Lock()
+	defer rs.loading.Unlock()
+
+	files, stamp, err := rs.fingerprint()
+	if err != nil {
+		return false, err
+	}
+
+	if !force && stamp == rs.stamp {
+		return false, nil
+	}
+	rs.stamp = stamp
+
+	rules, vm, err := rs.loadAll(files)
+	if err != nil {
+		return true, err
+	}
+
+	if prev := rs.swap(rules, vm); prev != nil {
+		prev.retire()
+	}
+	return true, nil
+}
+
+// state 加载文件规则的虚拟机 规则替换后等执行中的规则结束再关闭
+type state struct {
+	co      *lua.LState
+	refs    int64
+	retired int32
+	once    sync.Once
+}
+
+// hold 调用方持有 RuleSet 的读锁 此时虚拟机还没有退役
+func (s *state) hold() {
+	atomic.AddInt64(&s.refs, 1)
+}
+
+func (s *state) leave() {
+	if atomic.AddInt64(&s.refs, -1) == 0 && atomic.LoadInt32(&s.retired) == 1 {
+		s.close()
+	}
+}
+
+func (s *state) retire() {
+	atomic.StoreInt32(&s.retired, 1)
+	if atomic.LoadInt64(&s.refs) == 0 {
+		s.close()
+	}
+}
+
+func (s *state) close() {
+	s.once.Do(s.co.Close)
+}
+
+// loadAll lua规则在独立的虚拟机中加载 不在后台协程中使用服务的LState
+func (rs *RuleSet) loadAll(files []string) ([]*Rule, *state, error) {
+	co := rs.newState()
+
+	seen := make(map[string]string, len(files))
+	rules := make([]*Rule, 0, len(files))
+	for _, file := range files {
+		r, e := rs.load(co, file)
+		if e != nil {
+			co.Close()
+			return nil, nil, fmt.Errorf("ruleset %s load %s fail %v", rs.name, file, e)
+		}
+
+		if prev, ok := seen[r.Key]; ok {
+			co.Close()
+			return nil, nil, fmt.Errorf("ruleset %s rule %s duplicate in %s and %s", rs.name, r.Key, prev, file)
+		}
+		seen[r.Key] = file
+		rules = append(rules, r)
+	}
+
+	return rules, &state{co: co}, nil
+}
+
+// newState 加载规则的独立虚拟机 服务中与服务的LState 相同注入
+func (rs *RuleSet) newState() *lua.LState {
+	if ms, ok := rs.L.Exdata().(*treekit.MicroService); ok {
+		return ms.NewState()
+	}
+	return lua.NewStateEx(rs.L.Name())
+}
+
+func (rs *RuleSet) load(co *lua.LState, file string) (*Rule, error) {
+	name := strings.TrimSuffix(filepath.Base(file), filepath.Ext(file))
+	if filepath.Ext(file) == ExtCond {
+		return rs.loadCond(name, file)
+	}
+	return rs.loadLua(co, name, file)
+}
+
+func (rs *RuleSet) loadLua(co *lua.LState, name string, file string) (*Rule, error) {
+	fn, err := co.LoadFile(file)
+	if err != nil {
+		return nil, err
+	}
+
+	err = co.CallByParam(lua.P{Fn: fn, NRet: 1, Protect: true})
+	if err != nil {
+		return nil, err
+	}
+
+	ret := co.Get(-1)
+	co.Pop(1)
+
+	m := RuleMeta{Enable: true}
+	handler := ret
+	if tab, ok := ret.(*lua.LTable); ok {
+		handler = tab.RawGetString("handler")
+		if e := luakit.TableTo(co, tab, &m); e != nil {
+			return nil, e
+		}
+	}
+
+	if handler == lua.LNil {
+		return nil, fmt.Errorf("not found handler")
+	}
+
+	r := &Rule{
+		Key:    name,
+		Chain:  pipe.LValue(handler, pipe.LState(co)),
+		Source: file,
+	}
+	r.With(m)
+	return r, nil
+}
+
+func (rs *RuleSet) loadCond(name string, file string) (*Rule, error) {
+	text, err := os.ReadFile(file)
+	if err != nil {
+		return nil, err
+	}
+
+	m := RuleMeta{Enable: true}
+	var lines []string
+	scanner := bufio.NewScanner(bytes.NewReader(text))
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" {
+			continue
+		}
+
+		if line[0] != '#' {
+			lines = append(lines, line)
+			continue
+		}
+
+		key, val, ok := strings.Cut(strings.TrimSpace(line[1:]), ":")
+		if !ok {
+			continue
+		}
+
+		val = strings.TrimSpace(val)
+		switch strings.TrimSpace(key) {
+		case "priority":
+			m.Priority = cast.ToInt(val)
+		case "tags":
+			m.Tags = nil
+			for _, tag := range strings.Split(val, ",") {
+				if tag = strings.TrimSpace(tag); tag != "" {
+					m.Tags = append(m.Tags, tag)
+				}
+			}
+		case "enable":
+			m.Enable = cast.ToBool(val)
+		}
+	}
+
+	if len(lines) == 0 {
+		return nil, fmt.Errorf("not found condition")
+	}
+
+	cnd := cond.NewText(lines...)
+	if report := cnd.Lint(); !report.Ok() {
+		return nil, fmt.Errorf("%s", report.String())
+	}
+
+	r := &Rule{
+		Key:    name,
+		Chain:  pipe.NewChain(),
+		Source: file,
+		cnd:    cnd,
+	}
+	r.With(m)
+	return r, nil
+}
+
+// watch 定时检查目录 文件变化后重新加载并整体替换
+func (rs *RuleSet) watch(ctx context.Context, env *treekit.Env) {
+	tk := time.NewTicker(rs.interval)
+	defer tk.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-tk.C:
+			if _, err := rs.reload(false); err != nil {
+				env.Errorf("ruleset %s watch %s fail %v", rs.name, rs.dir, err)
+			}
+		}
+	}
+}
@@ -0,0 +1,276 @@
+package ruleset
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"sync"
+	"sync/atomic"
+	"testing"
+
+	"github.com/vela-public/onekit/lua"
+	"github.com/vela-public/onekit/pipe"
+)
+
+const luaRule = `
+loaded = true
+return {
+	priority = %d,
+	tags = {"lua"},
+	handler = function(v)
+		if v == "bad" then error("bad") end
+	end,
+}
+`
+
+func write(t *testing.T, dir, name, text string) {
+	t.Helper()
+	if err := os.WriteFile(filepath.Join(dir, name), []byte(text), 0644); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func keys(rs *RuleSet) []string {
+	var ks []string
+	for _, r := range rs.rules() {
+		ks = append(ks, r.Key)
+	}
+	return ks
+}
+
+func TestDirReload(t *testing.T) {
+	dir := t.TempDir()
+	write(t, dir, "a.lua", fmt.Sprintf(luaRule, 10))
+	write(t, dir, "b.cnd", "# priority: 20\n# tags: c , d\nname eq x\n")
+	write(t, dir, "readme.txt", "skip")
+
+	L := lua.NewState()
+	defer L.Close()
+
+	rs := &RuleSet{L: L, name: "test"}
+	rs.Dir(dir, 0)
+	if err := rs.Reload(); err != nil {
+		t.Fatal(err)
+	}
+
+	if ks := keys(rs); len(ks) != 2 || ks[0] != "b" || ks[1] != "a" {
+		t.Fatalf("got %v want [b a]", ks)
+	}
+
+	// lua规则在独立的虚拟机中加载
+	if L.GetGlobal("loaded") != lua.LNil {
+		t.Fatal("rule modified the global of the service LState")
+	}
+
+	var hooked int32
+	rs.hook = pipe.NewChain()
+	rs.hook.NewHandler(func(v any) {
+		// hook 参数为 (v , name)
+		if v == "b" {
+			atomic.AddInt32(&hooked, 1)
+		}
+	})
+
+	rs.ExecAll(map[string]string{"name": "x"})
+	rs.ExecAll("bad")
+	rs.ExecTag("ok", "lua")
+
+	if b := rs.Get("b"); b.Stat().Hit != 1 || !b.Tagged("d") || atomic.LoadInt32(&hooked) != 1 {
+		t.Fatalf("cond rule got %+v hooked %d", b.Stat(), hooked)
+	}
+
+	a := rs.Get("a").Stat()
+	if a.Hit != 3 || a.Errors != 1 {
+		t.Fatalf("lua rule got %+v", a)
+	}
+
+	// 没有变化不重新加载
+	if ok, err := rs.reload(false); ok || err != nil {
+		t.Fatalf("unchanged reload got %v %v", ok, err)
+	}
+
+	// 修改后重新加载 计数继承
+	write(t, dir, "a.lua", fmt.Sprintf(luaRule, 100))
+	if ok, err := rs.reload(false); !ok || err != nil {
+		t.Fatalf("changed reload got %v %v", ok, err)
+	}
+
+	if ks := keys(rs); ks[0] != "a" {
+		t.Fatalf("got %v want a first", ks)
+	}
+
+	if st := rs.Get("a").Stat(); st.Hit != 3 || st.Errors != 1 || st.Priority != 100 {
+		t.Fatalf("reloaded rule got %+v", st)
+	}
+
+	// 失败时保留原有规则 指纹不变时不重复报错
+	write(t, dir, "c.lua", "return")
+	if _, err := rs.reload(false); err == nil {
+		t.Fatal("want load error")
+	}
+
+	if ok, err := rs.reload(false); ok || err != nil {
+		t.Fatalf("failed stamp got %v %v", ok, err)
+	}
+
+	if rs.Len() != 2 {
+		t.Fatalf("got %v", keys(rs))
+	}
+
+	// lua中定义的规则保留
+	rs.Add(&Rule{Key: "inline", Chain: pipe.NewChain()})
+	os.Remove(filepath.Join(dir, "c.lua"))
+	os.Remove(filepath.Join(dir, "b.cnd"))
+	if err := rs.Reload(); err != nil {
+		t.Fatal(err)
+	}
+
+	if ks := keys(rs); len(ks) != 2 || ks[0] != "a" || ks[1] != "inline" {
+		t.Fatalf("got %v want [a inline]", ks)
+	}
+}
+
+func TestDirCondFail(t *testing.T) {
+	dir := t.TempDir()
+	write(t, dir, "a.cnd", "# priority: 1\n")
+
+	rs := &RuleSet{L: lua.NewState(), name: "test"}
+	rs.Dir(dir, 0)
+	if err := rs.Reload(); err == nil {
+		t.Fatal("want not found condition")
+	}
+
+	write(t, dir, "a.cnd", "# enable: false\nname eq x\n")
+	if err := rs.Reload(); err != nil {
+		t.Fatal(err)
+	}
+
+	rs.ExecAll(map[string]string{"name": "x"})
+	if st := rs.Get("a").Stat(); st.Enable || st.Hit != 0 {
+		t.Fatalf("got %+v", st)
+	}
+}
+
+// 执行规则时重新加载
+func TestDirConcurrent(t *testing.T) {
+	dir := t.TempDir()
+	write(t, dir, "a.lua", fmt.Sprintf(luaRule, 1))
+
+	rs := &RuleSet{L: lua.NewState(), name: "test"}
+	rs.Dir(dir, 0)
+	if err := rs.Reload(); err != nil {
+		t.Fatal(err)
+	}
+
+	var wg sync.WaitGroup
+	wg.Add(2)
+	go func() {
+		defer wg.Done()
+		for i := 0; i < 200; i++ {
+			rs.ExecAll("ok")
+		}
+	}()
+
+	go func() {
+		defer wg.Done()
+		for i := 0; i < 20; i++ {
+			if err := rs.Reload(); err != nil {
+				t.Error(err)
+			}
+		}
+	}()
+	wg.Wait()
+
+	if st := rs.Get("a").Stat(); st.Hit != 200 {
+		t.Fatalf("got %+v", st)
+	}
+}
+
+// 替换后旧的虚拟机在执行结束后关闭 Close 关闭当前的虚拟机
+func TestDirState(t *testing.T) {
+	dir := t.TempDir()
+	write(t, dir, "a.lua", fmt.Sprintf(luaRule, 1))
+
+	rs := &RuleSet{L: lua.NewState(), name: "test"}
+	rs.Dir(dir, 0)
+	if err := rs.Reload(); err != nil {
+		t.Fatal(err)
+	}
+	first := rs.vm
+
+	_, release := rs.snapshot()
+	if err := rs.Reload(); err != nil {
+		t.Fatal(err)
+	}
+
+	if first.co.IsClosed() {
+		t.Fatal("vm closed while rules are running")
+	}
+	release()
+	if !first.co.IsClosed() {
+		t.Fatal("replaced vm not closed")
+	}
+
+	second := rs.vm
+	rs.Add(&Rule{Key: "inline", Chain: pipe.NewChain()})
+	if err := rs.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	if !second.co.IsClosed() || rs.vm != nil {
+		t.Fatal("current vm not closed")
+	}
+
+	if ks := keys(rs); len(ks) != 1 || ks[0] != "inline" {
+		t.Fatalf("got %v want [inline]", ks)
+	}
+}
+
+// 修改属性与执行规则并发
+func TestMetaConcurrent(t *testing.T) {
+	L := lua.NewState()
+	defer L.Close()
+
+	rs := &RuleSet{L: L, name: "test"}
+	rs.Add(&Rule{Key: "a", Chain: pipe.NewChain()})
+	rs.Add(&Rule{Key: "b", Chain: pipe.NewChain(), Priority: 5})
+	L.SetGlobal("rs", rs)
+
+	done := make(chan struct{})
+	var wg sync.WaitGroup
+	wg.Add(2)
+	go func() {
+		defer wg.Done()
+		for {
+			select {
+			case <-done:
+				return
+			default:
+				rs.ExecAll("ok")
+			}
+		}
+	}()
+
+	go func() {
+		defer wg.Done()
+		for i := 0; i < 100; i++ {
+			rs.Add(&Rule{Key: "c", Chain: pipe.NewChain()})
+		}
+	}()
+
+	for i := 0; i < 100; i++ {
+		if err := L.DoString(fmt.Sprintf(`rs.meta("a", {priority = %d, enable = %v})`, i%10, i%2 == 0)); err != nil {
+			t.Fatal(err)
+		}
+	}
+	close(done)
+	wg.Wait()
+
+	if n := rs.Len(); n != 3 {
+		t.Fatalf("got %v", keys(rs))
+	}
+
+	if st := rs.Get("a").Stat(); st.Priority != 9 || st.Enable {
+		t.Fatalf("got %+v", st)
+	}
+}
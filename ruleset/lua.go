@@ -3,6 +3,7 @@ package ruleset
 import (
 	"github.com/vela-public/onekit/lua"
 	"github.com/vela-public/onekit/treekit"
+	"time"
 )
 
 func NewRulesetL(L *lua.LState) int {
@@ -20,6 +21,36 @@ func NewRulesetL(L *lua.LState) int {
 		r.name = name
 		r.Data = nil
 		r.L = L
+		r.hook = nil
+		r.dir = ""
+	})
+
+	treekit.Start(L, pro.Data(), L.PanicErr)
+	L.Push(pro.Unwrap())
+	return 1
+}
+
+// NewRuleDirL ruleset.dir(path , interval) 从目录加载规则 文件变化后自动替换
+func NewRuleDirL(L *lua.LState) int {
+	path := L.CheckString(1)
+	interval := time.Duration(L.IsInt(2)) * time.Second
+	pro := treekit.LazyCNF[RuleSet, string](L, &path)
+
+	pro.Build(func(_ *string) *RuleSet {
+		rs := &RuleSet{
+			L:    L,
+			name: path,
+		}
+		rs.Dir(path, interval)
+		return rs
+	})
+
+	pro.Rebuild(func(_ *string, r *RuleSet) {
+		r.name = path
+		r.Data = nil
+		r.L = L
+		r.hook = nil
+		r.Dir(path, interval)
 	})
 
 	treekit.Start(L, pro.Data(), L.PanicErr)
@@ -28,5 +59,7 @@ func NewRulesetL(L *lua.LState) int {
 }
 
 func Preload(p lua.Preloader) {
-	p.Set("ruleset", lua.NewExport("lua.ruleset.export", lua.WithFunc(NewRulesetL)))
+	kv := lua.NewUserKV()
+	kv.Set("dir", lua.NewFunction(NewRuleDirL))
+	p.Set("ruleset", lua.NewExport("lua.ruleset.export", lua.WithFunc(NewRulesetL), lua.WithTable(kv)))
 }
@@ -0,0 +1,133 @@
+package ruleset
+
+import (
+	"github.com/vela-public/onekit/cond"
+	"github.com/vela-public/onekit/pipe"
+	"sync/atomic"
+)
+
+type Rule struct {
+	Key      string
+	Chain    *pipe.Chain
+	Priority int
+	Tags     []string
+	Disable  bool
+	Source   string // 从文件加载时记录路径 lua中定义的规则为空
+
+	cnd    *cond.Cond
+	hit    uint64
+	errors uint64
+}
+
+// RuleMeta 规则属性 rs.meta("name" , {priority = 10 , tags = {"a" , "b"} , enable = true})
+type RuleMeta struct {
+	Priority int      `lua:"priority"`
+	Tags     []string `lua:"tags"`
+	Enable   bool     `lua:"enable"`
+}
+
+// RuleStat 规则统计 用于 Metadata
+type RuleStat struct {
+	Priority int      `json:"priority"`
+	Tags     []string `json:"tags,omitempty"`
+	Enable   bool     `json:"enable"`
+	Source   string   `json:"source,omitempty"`
+	Hit      uint64   `json:"hit"`
+	Errors   uint64   `json:"errors"`
+}
+
+func (r *Rule) Nil() bool {
+	if r.Key == "" || r.Chain == nil {
+		return true
+	}
+
+	return false
+}
+
+func (r *Rule) Enable() bool {
+	return !r.Disable
+}
+
+func (r *Rule) Tagged(tag string) bool {
+	for _, item := range r.Tags {
+		if item == tag {
+			return true
+		}
+	}
+	return false
+}
+
+func (r *Rule) Meta() RuleMeta {
+	return RuleMeta{
+		Priority: r.Priority,
+		Tags:     r.Tags,
+		Enable:   r.Enable(),
+	}
+}
+
+func (r *Rule) With(m RuleMeta) {
+	r.Priority = m.Priority
+	r.Tags = m.Tags
+	r.Disable = !m.Enable
+}
+
+func (r *Rule) Stat() RuleStat {
+	return RuleStat{
+		Priority: r.Priority,
+		Tags:     r.Tags,
+		Enable:   r.Enable(),
+		Source:   r.Source,
+		Hit:      atomic.LoadUint64(&r.hit),
+		Errors:   atomic.LoadUint64(&r.errors),
+	}
+}
+
+// invoke 执行规则 条件规则命中后交给 hook 处理
+func (rs *RuleSet) invoke(r *Rule, v any) {
+	if r.Nil() || r.Disable {
+		return
+	}
+
+	if r.cnd != nil {
+		if !r.cnd.Match(v) {
+			return
+		}
+
+		atomic.AddUint64(&r.hit, 1)
+		if hook := rs.hook; hook != nil {
+			hook.Invokes([]any{v, r.Key}, pipe.Error(r.fail))
+		}
+		return
+	}
+
+	if r.Chain.Len() == 0 {
+		return
+	}
+
+	atomic.AddUint64(&r.hit, 1)
+	r.Chain.Invoke(v, pipe.Error(r.fail))
+}
+
+// clone 修改属性时使用的副本 计数原子读取
+func (r *Rule) clone() *Rule {
+	cp := &Rule{
+		Key:      r.Key,
+		Chain:    r.Chain,
+		Priority: r.Priority,
+		Tags:     r.Tags,
+		Disable:  r.Disable,
+		Source:   r.Source,
+		cnd:      r.cnd,
+	}
+	cp.inherit(r)
+	return cp
+}
+
+func (r *Rule) inherit(old *Rule) {
+	atomic.StoreUint64(&r.hit, atomic.LoadUint64(&old.hit))
+	atomic.StoreUint64(&r.errors, atomic.LoadUint64(&old.errors))
+}
+
+func (r *Rule) fail(error) {
+	atomic.AddUint64(&r.errors, 1)
+}
@@ -1,31 +1,31 @@
 package ruleset
 
 import (
+	"context"
 	"encoding/json"
 	"github.com/vela-public/onekit/libkit"
 	"github.com/vela-public/onekit/lua"
+	"github.com/vela-public/onekit/luakit"
 	"github.com/vela-public/onekit/pipe"
 	"github.com/vela-public/onekit/treekit"
+	"sort"
 	"strings"
+	"sync"
+	"time"
 )
 
-type Rule struct {
-	Key   string
-	Chain *pipe.Chain
-}
-
-func (r *Rule) Nil() bool {
-	if r.Key == "" || r.Chain == nil {
-		return true
-	}
-
-	return false
-}
-
 type RuleSet struct {
-	L    *lua.LState
-	name string
-	Data []*Rule
+	L        *lua.LState
+	name     string
+	Data     []*Rule
+	mutex    sync.RWMutex
+	hook     *pipe.Chain
+	dir      string
+	interval time.Duration
+	stamp    string
+	loading  sync.Mutex // 串行加载目录 保护 stamp
+	vm       *state     // 当前目录规则的虚拟机
+	cancel   context.CancelFunc
 }
 
 func (rs *RuleSet) Name() string {
@@ -33,19 +33,49 @@ func (rs *RuleSet) Name() string {
 }
 
 func (rs *RuleSet) Startup(env *treekit.Env) error {
+	if rs.dir == "" {
+		return nil
+	}
+
+	if err := rs.Reload(); err != nil {
+		return err
+	}
+
+	if rs.cancel != nil {
+		rs.cancel()
+	}
+
+	ctx, cancel := context.WithCancel(env.Context())
+	rs.cancel = cancel
+	go rs.watch(ctx, env)
 	return nil
 }
 
 func (rs *RuleSet) Close() error {
+	if rs.cancel != nil {
+		rs.cancel()
+		rs.cancel = nil
+	}
+
+	//目录规则随虚拟机一起移除 lua中定义的规则保留
+	if vm := rs.swap(nil, nil); vm != nil {
+		vm.retire()
+	}
 	return nil
 }
 
+// Metadata 每个规则的优先级 标签 开关 以及命中和错误次数
 func (rs *RuleSet) Metadata() libkit.DataKV[string, any] {
-	return libkit.DataKV[string, any]{}
+	rules := rs.rules()
+	kv := make(libkit.DataKV[string, any], 0, len(rules))
+	for _, r := range rules {
+		kv = append(kv, libkit.KeyVal[string, any]{Key: r.Key, Value: r.Stat()})
+	}
+	return kv
 }
 
 func (rs *RuleSet) Text() []byte {
-	text, _ := json.Marshal(rs)
+	text, _ := json.Marshal(rs.Metadata())
 	return text
 }
 
@@ -57,21 +87,51 @@ func (rs *RuleSet) AssertFunction() (*lua.LFunction, bool) { return nil, false }
 func (rs *RuleSet) Hijack(fsm *lua.CallFrameFSM) bool      { return false }
 
 func (rs *RuleSet) Exec(v any, names ...string) {
-	sz := len(names)
-	for i := 0; i < sz; i++ {
-		name := names[i]
-		idx := rs.Have(name)
-		if idx == -1 {
-			continue
+	rules, release := rs.snapshot()
+	defer release()
+
+	for _, name := range names {
+		for _, r := range rules {
+			if !r.Nil() && r.Key == name {
+				rs.invoke(r, v)
+				break
+			}
 		}
-		r := rs.At(idx)
-		if r.Nil() || r.Chain.Len() == 0 {
-			return
+	}
+}
+
+// ExecTag 按优先级执行带有标签的规则
+func (rs *RuleSet) ExecTag(v any, tags ...string) {
+	rules, release := rs.snapshot()
+	defer release()
+
+	for _, r := range rules {
+		for _, tag := range tags {
+			if r.Tagged(tag) {
+				rs.invoke(r, v)
+				break
+			}
 		}
-		r.Chain.Invoke(v)
 	}
+}
+
+// ExecAll 按优先级执行所有规则
+func (rs *RuleSet) ExecAll(v any) {
+	rules, release := rs.snapshot()
+	defer release()
+
+	for _, r := range rules {
+		rs.invoke(r, v)
+	}
+}
 
+func (rs *RuleSet) WithTag(tags ...string) lua.Invoker {
+	return func(v any) error {
+		rs.ExecTag(v, tags...)
+		return nil
+	}
 }
+
 func (rs *RuleSet) Use(rules ...string) lua.Invoker {
 	return func(v any) error {
 		rs.Exec(v, rules...)
@@ -138,6 +198,59 @@ func (rs *RuleSet) ByL(L *lua.LState) int {
 	return 1
 }
 
+func (rs *RuleSet) WithTagL(L *lua.LState) int {
+	tags := lua.Unpack[string](L)
+	L.Push(rs.WithTag(tags...))
+	return 1
+}
+
+func (rs *RuleSet) AllL(L *lua.LState) int {
+	rs.ExecAll(L.Get(1))
+	return 0
+}
+
+// MetaL rs.meta("name" , {priority = 10 , tags = {"a"} , enable = false})
+// 执行中的规则不加锁读取属性 修改副本后整体替换
+func (rs *RuleSet) MetaL(L *lua.LState) int {
+	name := L.CheckString(1)
+	r := rs.Get(name)
+	if r == nil {
+		L.RaiseError("not found rule %s", name)
+		return 0
+	}
+
+	m := r.Meta()
+	if err := luakit.TableTo(L, L.CheckTable(2), &m); err != nil {
+		L.RaiseError("rule %s meta %v", name, err)
+		return 0
+	}
+
+	rs.mutex.Lock()
+	defer rs.mutex.Unlock()
+
+	i := rs.index(name)
+	if i == -1 {
+		L.RaiseError("not found rule %s", name)
+		return 0
+	}
+
+	cp := rs.Data[i].clone()
+	cp.With(m)
+
+	data := make([]*Rule, len(rs.Data))
+	copy(data, rs.Data)
+	data[i] = cp
+	rs.Data = data
+	rs.sort()
+	return 0
+}
+
+// OnL rs.on(fn) 条件规则命中后回调 fn(v , name)
+func (rs *RuleSet) OnL(L *lua.LState) int {
+	rs.hook = pipe.Lua(L, pipe.LState(L), pipe.Seek(1))
+	return 0
+}
+
 func (rs *RuleSet) Index(L *lua.LState, key string) lua.LValue {
 	switch key {
 	case "use":
@@ -146,6 +259,16 @@ func (rs *RuleSet) Index(L *lua.LState, key string) lua.LValue {
 		return lua.NewFunction(rs.UseTagL)
 	case "by":
 		return lua.NewFunction(rs.ByL)
+	case "with_tag":
+		return lua.NewFunction(rs.WithTagL)
+	case "all":
+		return lua.NewFunction(rs.AllL)
+	case "meta":
+		return lua.NewFunction(rs.MetaL)
+	case "on":
+		return lua.NewFunction(rs.OnL)
+	case "len":
+		return lua.LInt(rs.Len())
 	}
 
 	if strings.HasPrefix(key, "use_") {
@@ -164,8 +287,8 @@ func (rs *RuleSet) NewIndex(L *lua.LState, key string, val lua.LValue) {
 		return
 	}
 
-	idx := rs.Have(key)
-	if idx == -1 {
+	r := rs.Get(key)
+	if r == nil {
 		rs.Add(&Rule{
 			Key:   key,
 			Chain: pipe.LValue(val, pipe.LState(L)),
@@ -173,38 +296,116 @@ func (rs *RuleSet) NewIndex(L *lua.LState, key string, val lua.LValue) {
 		return
 	}
 
-	rs.At(idx).Chain.Merge(pipe.LValue(val, pipe.LState(L)))
+	r.Chain.Merge(pipe.LValue(val, pipe.LState(L)))
 }
 
 func (rs *RuleSet) Len() int {
+	rs.mutex.RLock()
+	defer rs.mutex.RUnlock()
 	return len(rs.Data)
 }
 
+// rules 当前规则的快照 已按优先级排序
+func (rs *RuleSet) rules() []*Rule {
+	rs.mutex.RLock()
+	defer rs.mutex.RUnlock()
+	return rs.Data
+}
+
+// snapshot 执行规则时使用 同时引用目录规则的虚拟机 release 之前不会被关闭
+func (rs *RuleSet) snapshot() ([]*Rule, func()) {
+	rs.mutex.RLock()
+	defer rs.mutex.RUnlock()
+
+	vm := rs.vm
+	if vm == nil {
+		return rs.Data, func() {}
+	}
+
+	vm.hold()
+	return rs.Data, vm.leave
+}
+
 func (rs *RuleSet) At(i int) *Rule {
-	sz := rs.Len()
-	if i < 0 || i >= sz {
+	rules := rs.rules()
+	if i < 0 || i >= len(rules) {
 		return &Rule{}
 	}
-	return rs.Data[i]
+	return rules[i]
 }
 
-func (rs *RuleSet) Have(key string) int {
-	sz := rs.Len()
-	if sz == 0 {
-		return -1
+func (rs *RuleSet) Get(key string) *Rule {
+	for _, r := range rs.rules() {
+		if !r.Nil() && r.Key == key {
+			return r
+		}
 	}
+	return nil
+}
 
-	for i := 0; i < sz; i++ {
-		r := rs.At(i)
+func (rs *RuleSet) Have(key string) int {
+	rs.mutex.RLock()
+	defer rs.mutex.RUnlock()
+	return rs.index(key)
+}
+
+// index 调用方持有锁
+func (rs *RuleSet) index(key string) int {
+	for i, r := range rs.Data {
 		if !r.Nil() && r.Key == key {
 			return i
 		}
 	}
 	return -1
 }
+
+// sort 优先级高的在前 相同优先级保持添加顺序 调用方持有写锁
+func (rs *RuleSet) sort() {
+	data := make([]*Rule, len(rs.Data))
+	copy(data, rs.Data)
+	sort.SliceStable(data, func(i, j int) bool {
+		return data[i].Priority > data[j].Priority
+	})
+	rs.Data = data
+}
+
 func (rs *RuleSet) Add(rule *Rule) {
-	if rs.Have(rule.Key) != -1 {
+	rs.mutex.Lock()
+	defer rs.mutex.Unlock()
+
+	if rs.index(rule.Key) != -1 {
 		return
 	}
+
 	rs.Data = append(rs.Data, rule)
+	rs.sort()
+}
+
+// swap 替换文件加载的规则 lua中定义的规则保留 返回被替换的虚拟机
+func (rs *RuleSet) swap(rules []*Rule, vm *state) *state {
+	rs.mutex.Lock()
+	defer rs.mutex.Unlock()
+
+	prev := make(map[string]*Rule, len(rs.Data))
+	data := make([]*Rule, 0, len(rs.Data)+len(rules))
+	for _, r := range rs.Data {
+		if r.Source == "" {
+			data = append(data, r)
+			continue
+		}
+		prev[r.Key] = r
+	}
+
+	//同名规则继承命中和错误次数
+	for _, r := range rules {
+		if old, ok := prev[r.Key]; ok {
+			r.inherit(old)
+		}
+	}
+	rs.Data = append(data, rules...)
+	rs.sort()
+
+	last := rs.vm
+	rs.vm = vm
+	return last
 }
@@ -153,6 +153,7 @@ func Read(name string, path string) (*ServiceEntry, error) {
 	s := &ServiceEntry{
 		Dialect: true,
 		Name:    name,
+		local:   true,
 	}
 
 	st, err := fd.Stat()
@@ -0,0 +1,42 @@
+package treekit
+
+import (
+	"github.com/vela-public/onekit/lua"
+	"sync"
+)
+
+// Quotas 虚拟机的资源限制 没有单独设置的服务或者任务使用默认值
+type Quotas struct {
+	mutex sync.RWMutex
+	def   lua.Quota
+	keys  map[string]lua.Quota
+}
+
+// Set keys 为空时设置默认值
+func (q *Quotas) Set(quota lua.Quota, keys ...string) {
+	q.mutex.Lock()
+	defer q.mutex.Unlock()
+
+	if len(keys) == 0 {
+		q.def = quota
+		return
+	}
+
+	for _, key := range keys {
+		q.keys[key] = quota
+	}
+}
+
+func (q *Quotas) Get(key string) lua.Quota {
+	q.mutex.RLock()
+	defer q.mutex.RUnlock()
+
+	if v, ok := q.keys[key]; ok {
+		return v
+	}
+	return q.def
+}
+
+func NewQuotas() *Quotas {
+	return &Quotas{keys: make(map[string]lua.Quota)}
+}
@@ -2,6 +2,7 @@ package treekit
 
 import (
 	"context"
+	"errors"
 	"fmt"
 	"github.com/vela-public/onekit/errkit"
 	"github.com/vela-public/onekit/libkit"
@@ -46,6 +47,7 @@ type MicroService struct {
 		//error
 		Error error
 		Stack string
+		Quota *lua.QuotaError //超出资源限制
 
 		//flag for MicroService
 		mute sync.Mutex
@@ -90,6 +92,12 @@ func (ms *MicroService) undo(op SerErrNo) {
 	ms.private.Flag &= ^op
 }
 
+func (ms *MicroService) flag() SerErrNo {
+	ms.private.mute.Lock()
+	defer ms.private.mute.Unlock()
+	return ms.private.Flag
+}
+
 func (ms *MicroService) set(op SerErrNo) {
 	ms.private.mute.Lock()
 	defer ms.private.mute.Unlock()
@@ -138,15 +146,20 @@ func (ms *MicroService) build() {
 	ms.handler.Audit = pipe.NewChain()
 
 	//init lua.LState coroutine
-	kit := ms.root.LuaKit() // 功能的注入 lua 虚拟机
-	ms.Preload(kit)
-	ms.private.LState = kit.NewState(ctx, ms.Key(), func(option *lua.Options) {
+	ms.Preload(ms.root.LuaKit()) // 功能的注入 lua 虚拟机
+	ms.private.LState = ms.NewState()
+	ms.set(Register)
+}
+
+// NewState 与服务相同注入的虚拟机 其他协程加载脚本时使用独立的虚拟机 注入只在 build 时执行一次
+func (ms *MicroService) NewState() *lua.LState {
+	kit := ms.root.LuaKit()
+	return kit.NewState(ms.private.Context, ms.Key(), func(option *lua.Options) {
 		option.Exdata = ms
+		option.Quota = ms.root.Quota(ms.Key())
 		option.ErrHandle = func(err error) {
 		}
 	})
-
-	ms.set(Register)
 }
 
 func (ms *MicroService) update(config *MicoServiceConfig) {
@@ -209,6 +222,7 @@ func (ms *MicroService) succeed() {
 		ms.config.Source = nil
 	}
 	ms.private.Error = nil
+	ms.private.Quota = nil
 }
 
 func (ms *MicroService) disable() {
@@ -220,6 +234,12 @@ func (ms *MicroService) disable() {
 func (ms *MicroService) fail(err error) {
 	ms.set(Fail)
 	ms.private.Error = err
+	ms.private.Quota = nil
+
+	var qe *lua.QuotaError
+	if errors.As(err, &qe) {
+		ms.private.Quota = qe
+	}
 }
 
 func (ms *MicroService) panic(err error) {
@@ -450,6 +470,10 @@ func (ms *MicroService) Create(L *lua.LState, name string, typeof string) *Proce
 }
 
 func (ms *MicroService) SafeCall() *MicroService {
+	//重新记录依赖
+	ms.processes.Link = nil
+	ms.root.depend.reset(ms.Key())
+
 	fn, err := ms.private.LState.Load(ms.config.NewReader(), ms.config.Key)
 	if err != nil {
 		ms.panic(err)
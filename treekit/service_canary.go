@@ -0,0 +1,410 @@
+package treekit
+
+import (
+	"context"
+	"fmt"
+	"github.com/vela-public/onekit/bucket"
+	"go.etcd.io/bbolt"
+	"sync"
+	"time"
+)
+
+const (
+	RolloutCanary   = "canary"
+	RolloutStable   = "stable"
+	RolloutRollback = "rollback"
+	RolloutFail     = "fail"
+)
+
+// Rollout 服务更新的观察结果
+type Rollout struct {
+	Status string    `json:"status"`
+	Hash   string    `json:"hash"`   //新版本
+	Stable string    `json:"stable"` //上一个稳定版本
+	Reason string    `json:"reason,omitempty"`
+	Start  time.Time `json:"start"`
+	Until  time.Time `json:"until"`
+
+	cancel    context.CancelFunc
+	candidate *MicroService
+}
+
+// Canary 服务更新时 已有正常运行的版本则新版本作为候选并行启动 观察期内保持健康才替换旧版本
+// 并记录为稳定版本保存到 bbolt 候选版本启动失败或者不健康时直接关闭 旧版本不受影响
+// 没有正常运行的版本时原地更新 不健康时回滚到上一个稳定版本
+type Canary struct {
+	mutex   sync.Mutex
+	db      *bbolt.DB
+	name    string
+	window  time.Duration
+	status  map[string]*Rollout
+	pending map[string]*MicroService //等待唤醒的候选版本
+}
+
+func (c *Canary) bucket() *bucket.Bucket[MicoServiceConfig] {
+	return bucket.Pack[MicoServiceConfig](c.db, c.name)
+}
+
+// Stable 最近一次稳定运行的配置
+func (c *Canary) Stable(key string) (*MicoServiceConfig, error) {
+	cfg, err := c.bucket().Get(key).Unwrap()
+	if err != nil {
+		return nil, err
+	}
+
+	if len(cfg.Source) == 0 {
+		return nil, fmt.Errorf("not found %s stable version", key)
+	}
+	return &cfg, nil
+}
+
+func (c *Canary) save(cfg *MicoServiceConfig) error {
+	return c.bucket().Set(cfg.Key, *cfg, 0)
+}
+
+// stage 记录候选版本 替换同一个服务还未唤醒的候选版本
+func (c *Canary) stage(cand *MicroService) {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+	if old, ok := c.pending[cand.Key()]; ok {
+		old.retire()
+	}
+	c.pending[cand.Key()] = cand
+}
+
+// take 取出候选版本
+func (c *Canary) take(key string, hash string) *MicroService {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+
+	cand, ok := c.pending[key]
+	if !ok || cand.config.Hash != hash {
+		return nil
+	}
+	delete(c.pending, key)
+	return cand
+}
+
+// begin 开始观察 取消同一个服务之前的观察并关闭之前的候选版本
+func (c *Canary) begin(parent context.Context, key string, hash string, cand *MicroService) context.Context {
+	ctx, cancel := context.WithCancel(parent)
+	now := time.Now()
+	r := &Rollout{
+		Status:    RolloutCanary,
+		Hash:      hash,
+		Start:     now,
+		Until:     now.Add(c.window),
+		cancel:    cancel,
+		candidate: cand,
+	}
+
+	if stable, err := c.Stable(key); err == nil {
+		r.Stable = stable.Hash
+	}
+
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+	if old, ok := c.status[key]; ok {
+		old.cancel()
+		if old.candidate != nil && old.Status == RolloutCanary {
+			old.candidate.retire()
+		}
+	}
+	c.status[key] = r
+	return ctx
+}
+
+// finish 记录结果 观察期内服务又更新过时忽略
+func (c *Canary) finish(key string, hash string, status string, reason string) bool {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+
+	r, ok := c.status[key]
+	if !ok || r.Hash != hash {
+		return false
+	}
+
+	r.Status = status
+	r.Reason = reason
+	if status == RolloutStable {
+		r.Stable = hash
+	}
+	r.cancel()
+	r.candidate = nil
+	return true
+}
+
+// remove 服务删除时清除稳定版本
+func (c *Canary) remove(key string) {
+	c.mutex.Lock()
+	if r, ok := c.status[key]; ok {
+		r.cancel()
+		if r.candidate != nil {
+			r.candidate.retire()
+		}
+		delete(c.status, key)
+	}
+	if cand, ok := c.pending[key]; ok {
+		cand.retire()
+		delete(c.pending, key)
+	}
+	c.mutex.Unlock()
+
+	_ = c.bucket().Delete(key)
+}
+
+func (c *Canary) View(key string) *Rollout {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+
+	r, ok := c.status[key]
+	if !ok {
+		return nil
+	}
+
+	v := *r
+	v.cancel = nil
+	v.candidate = nil
+	return &v
+}
+
+func NewCanary(db *bbolt.DB, window time.Duration) *Canary {
+	if window <= 0 {
+		window = 30 * time.Second
+	}
+
+	return &Canary{
+		db:      db,
+		name:    "service_stable",
+		window:  window,
+		status:  make(map[string]*Rollout),
+		pending: make(map[string]*MicroService),
+	}
+}
+
+// healthy 服务正常运行并且没有失败的 process
+func (mt *MsTree) healthy(ms *MicroService) error {
+	switch {
+	case ms.has(Disable):
+		return nil
+	case ms.has(Panic):
+		return fmt.Errorf("service panic")
+	case ms.has(Fail):
+		if err := ms.UnwrapErr(); err != nil {
+			return err
+		}
+		return fmt.Errorf("service fail")
+	case !ms.has(Running):
+		return fmt.Errorf("service not running")
+	}
+
+	ms.processes.mutex.RLock()
+	defer ms.processes.mutex.RUnlock()
+	for _, pro := range ms.processes.data {
+		if pro.has(Failed) {
+			return fmt.Errorf("%s failed %v", pro.Name(), pro.info)
+		}
+	}
+	return nil
+}
+
+// retire 关闭被替换 放弃或者移除的版本 取消上下文后依附在虚拟机上的注册一起失效
+func (ms *MicroService) retire() {
+	ms.Close()
+	ms.private.Cancel()
+}
+
+// stage 已有正常运行的版本时 新版本作为候选版本并行启动 不替换正在运行的服务
+func (mt *MsTree) stage(entry *ServiceEntry) (bool, error) {
+	c := mt.private.canary
+	if c == nil {
+		return false, nil
+	}
+
+	old, ok := mt.find(entry.Name)
+	if !ok || old.config.Hash == entry.Hash || old.has(Disable) || mt.healthy(old) != nil {
+		return false, nil
+	}
+
+	cfg, err := entry.Config()
+	if err != nil {
+		return true, err
+	}
+
+	cand := &MicroService{root: mt, config: cfg}
+	cand.build()
+	c.stage(cand)
+	return true, nil
+}
+
+// rollout 更新后的服务进入观察期 启动失败时直接回滚或者放弃候选版本
+func (mt *MsTree) rollout(entries []*ServiceEntry) {
+	c := mt.private.canary
+	if c == nil {
+		return
+	}
+
+	for _, entry := range entries {
+		cfg, err := entry.Config()
+		if err != nil {
+			continue
+		}
+
+		if cand := c.take(cfg.Key, cfg.Hash); cand != nil {
+			ctx := c.begin(mt.Context(), cfg.Key, cfg.Hash, cand)
+			e := mt.SafeWakeup(cand)
+			if e == nil {
+				e = mt.healthy(cand)
+			}
+
+			if e != nil {
+				mt.discard(cand, e)
+				continue
+			}
+			go mt.observe(ctx, cand, cfg)
+			continue
+		}
+
+		ms, ok := mt.find(entry.Name)
+		if !ok {
+			continue
+		}
+
+		ctx := c.begin(mt.Context(), cfg.Key, cfg.Hash, nil)
+		if e := mt.healthy(ms); e != nil {
+			mt.rollback(ms, cfg.Hash, e)
+			continue
+		}
+		go mt.observe(ctx, ms, cfg)
+	}
+}
+
+// observe 观察期结束后持有更新锁 检查服务状态后替换或者回滚
+func (mt *MsTree) observe(ctx context.Context, ms *MicroService, cfg *MicoServiceConfig) {
+	c := mt.private.canary
+	timer := time.NewTimer(c.window)
+	defer timer.Stop()
+
+	select {
+	case <-ctx.Done():
+		return
+	case <-timer.C:
+	}
+
+	mt.private.updating.Lock()
+	defer mt.private.updating.Unlock()
+
+	//等待锁的过程中服务又更新或者被删除
+	if ctx.Err() != nil {
+		return
+	}
+
+	current, _ := mt.find(cfg.Key)
+	candidate := current != ms
+	if err := mt.healthy(ms); err != nil {
+		if candidate {
+			mt.discard(ms, err)
+		} else {
+			mt.rollback(ms, cfg.Hash, err)
+		}
+		return
+	}
+
+	if candidate {
+		mt.swap(ms)
+	}
+
+	if err := c.save(cfg); err != nil {
+		mt.Errorf("service.%s save stable version fail %v", cfg.Key, err)
+	}
+
+	if c.finish(cfg.Key, cfg.Hash, RolloutStable, "") {
+		mt.Debugf("service.%s rollout %s stable", cfg.Key, cfg.Hash)
+		mt.report()
+	}
+}
+
+// swap 候选版本替换正在运行的版本 并重启依赖它的服务
+func (mt *MsTree) swap(cand *MicroService) {
+	var old *MicroService
+	mt.cache.mutex.Lock()
+	for i, ms := range mt.cache.data {
+		if ms.Key() == cand.Key() {
+			old = ms
+			mt.cache.data[i] = cand
+			break
+		}
+	}
+	if old == nil {
+		mt.cache.data = append(mt.cache.data, cand)
+	}
+	mt.cache.mutex.Unlock()
+
+	if old != nil {
+		old.retire()
+	}
+
+	for _, dep := range mt.cascade(cand.Key()) {
+		if e := mt.SafeWakeup(dep); e != nil {
+			mt.Errorf("restart %s service fail %v", dep.Key(), e)
+		}
+	}
+}
+
+// discard 放弃候选版本 正在运行的版本不受影响
+func (mt *MsTree) discard(cand *MicroService, cause error) {
+	c := mt.private.canary
+	key, hash := cand.Key(), cand.config.Hash
+	cand.retire()
+
+	if c.finish(key, hash, RolloutRollback, cause.Error()) {
+		mt.Errorf("service.%s candidate %s fail %v keep running version", key, hash, cause)
+		mt.report()
+	}
+}
+
+// rollback 原地更新的服务回滚到上一个稳定版本 并重启依赖它的服务
+func (mt *MsTree) rollback(ms *MicroService, hash string, cause error) {
+	c := mt.private.canary
+	key := ms.Key()
+
+	stable, err := c.Stable(key)
+	if err != nil || stable.Hash == hash {
+		if c.finish(key, hash, RolloutFail, fmt.Sprintf("%v not found stable version", cause)) {
+			mt.Errorf("service.%s rollout %s fail %v", key, hash, cause)
+			mt.report()
+		}
+		return
+	}
+
+	if !c.finish(key, hash, RolloutRollback, cause.Error()) {
+		return
+	}
+
+	mt.Errorf("service.%s rollout %s fail %v rollback to %s", key, hash, cause, stable.Hash)
+	ms.update(stable)
+	if e := mt.SafeWakeup(ms); e != nil {
+		c.finish(key, hash, RolloutFail, fmt.Sprintf("%v rollback fail %v", cause, e))
+		mt.Errorf("service.%s rollback to %s fail %v", key, stable.Hash, e)
+	}
+
+	for _, dep := range mt.cascade(key) {
+		if e := mt.SafeWakeup(dep); e != nil {
+			mt.Errorf("restart %s service fail %v", dep.Key(), e)
+		}
+	}
+	mt.report()
+}
+
+// settle 唤醒后处理更新和删除的服务
+func (mt *MsTree) settle(updates []*ServiceEntry, removes []string) {
+	c := mt.private.canary
+	if c == nil {
+		return
+	}
+
+	for _, key := range removes {
+		c.remove(key)
+	}
+	mt.rollout(updates)
+}
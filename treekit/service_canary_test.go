@@ -0,0 +1,121 @@
+package treekit
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/vela-public/onekit/luakit"
+)
+
+func newCanaryTree(t *testing.T, window time.Duration) *MsTree {
+	t.Helper()
+	opt := NewMicoServiceOption()
+	opt.Protect(true)
+	opt.Canary(newHistoryDB(t), window)
+	opt.Error(func(error) {})
+
+	ctx, cancel := context.WithCancel(context.Background())
+	t.Cleanup(cancel)
+	return NewMicoSrvTree(ctx, luakit.Apply("luakit"), opt)
+}
+
+func waitRollout(t *testing.T, mt *MsTree, key string, hash string, status string) *Rollout {
+	t.Helper()
+	deadline := time.Now().Add(2 * time.Second)
+	for time.Now().Before(deadline) {
+		if r := mt.Canary().View(key); r != nil && r.Hash == hash && r.Status == status {
+			return r
+		}
+		time.Sleep(5 * time.Millisecond)
+	}
+	t.Fatalf("%s rollout %s want %s got %+v", key, hash, status, mt.Canary().View(key))
+	return nil
+}
+
+func running(t *testing.T, mt *MsTree, key string) *MicroService {
+	t.Helper()
+	ms, ok := mt.find(key)
+	if !ok {
+		t.Fatalf("not found %s", key)
+	}
+	return ms
+}
+
+// 候选版本与正在运行的版本并行 观察期通过后才替换
+func TestCanarySideBySide(t *testing.T) {
+	mt := newCanaryTree(t, 100*time.Millisecond)
+	entry := func(hash string, code string) []*ServiceEntry {
+		return []*ServiceEntry{{ID: 1, Name: "app", Hash: hash, Chunk: []byte(code)}}
+	}
+
+	_ = mt.DoDiff(entry("v1", `local a = 1`))
+	waitRollout(t, mt, "app", "v1", RolloutStable)
+	v1 := running(t, mt, "app")
+
+	// 候选版本启动失败 正在运行的版本不受影响
+	_ = mt.DoDiff(entry("v2", `error("boom")`))
+	r := waitRollout(t, mt, "app", "v2", RolloutRollback)
+	if r.Stable != "v1" {
+		t.Fatalf("stable %s want v1", r.Stable)
+	}
+
+	if ms := running(t, mt, "app"); ms != v1 || !ms.has(Running) {
+		t.Fatalf("running version replaced by failed candidate")
+	}
+
+	// 观察期内仍然是旧版本
+	_ = mt.DoDiff(entry("v3", `local b = 2`))
+	if r = mt.Canary().View("app"); r.Status != RolloutCanary || r.Hash != "v3" {
+		t.Fatalf("rollout %+v", r)
+	}
+
+	if ms := running(t, mt, "app"); ms != v1 {
+		t.Fatal("candidate swapped before observe")
+	}
+
+	waitRollout(t, mt, "app", "v3", RolloutStable)
+	v3 := running(t, mt, "app")
+	if v3 == v1 || v3.config.Hash != "v3" || !v3.has(Running) {
+		t.Fatalf("candidate not swapped %s", v3.config.Hash)
+	}
+
+	if v1.private.Context.Err() == nil {
+		t.Fatal("replaced version not closed")
+	}
+
+	if stable, err := mt.Canary().Stable("app"); err != nil || stable.Hash != "v3" {
+		t.Fatalf("stable %v %v", stable, err)
+	}
+
+	if n := mt.Length(); n != 1 {
+		t.Fatalf("services %d want 1", n)
+	}
+}
+
+// 新的更新取消之前的候选版本
+func TestCanarySupersede(t *testing.T) {
+	mt := newCanaryTree(t, 100*time.Millisecond)
+	entry := func(hash string) []*ServiceEntry {
+		return []*ServiceEntry{{ID: 1, Name: "app", Hash: hash, Chunk: []byte(`local a = "` + hash + `"`)}}
+	}
+
+	_ = mt.DoDiff(entry("v1"))
+	waitRollout(t, mt, "app", "v1", RolloutStable)
+
+	_ = mt.DoDiff(entry("v2"))
+	c := mt.Canary()
+	c.mutex.Lock()
+	cand := c.status["app"].candidate
+	c.mutex.Unlock()
+
+	_ = mt.DoDiff(entry("v3"))
+	if cand.private.Context.Err() == nil {
+		t.Fatal("superseded candidate not closed")
+	}
+
+	waitRollout(t, mt, "app", "v3", RolloutStable)
+	if ms := running(t, mt, "app"); ms.config.Hash != "v3" {
+		t.Fatalf("running %s want v3", ms.config.Hash)
+	}
+}
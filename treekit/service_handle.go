@@ -32,15 +32,20 @@ func (ms *MicroService) View() *ServiceView {
 		Hash:    ms.config.Hash,
 		Link:    strings.Join(ms.processes.Link, ","),
 		From:    ms.way(),
-		Status:  ms.private.Flag.String(),
+		Status:  ms.flag().String(),
 		Uptime:  ms.private.Uptime,
 		Dialect: ms.config.Dialect,
 		MTime:   ms.config.MTime,
 	}
 
+	if c := ms.root.private.canary; c != nil {
+		tv.Rollout = c.View(ms.Key())
+	}
+
 	if e := ms.UnwrapErr(); e != nil {
 		tv.Failed = true
 		tv.Cause = e.Error()
+		tv.Quota = ms.private.Quota
 	} else {
 		tv.Failed = false
 	}
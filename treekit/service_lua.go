@@ -97,6 +97,10 @@ func (ms *MicroService) importL(L *lua.LState) int {
 		L.RaiseError("loop call %s", ms.Key())
 		return 0
 	}
+	if err := ms.root.depend.link(ms.Key(), key); err != nil {
+		L.RaiseError("%v", err)
+		return 0
+	}
 	ms.link(key)
 	//提前唤醒
 	if tas.has(Register) {
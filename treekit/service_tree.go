@@ -15,6 +15,9 @@ type MsTree struct {
 		data  []*MicroService
 	}
 
+	//服务依赖
+	depend *Depend
+
 	handler struct {
 		Report *pipe.Chain
 		Create *pipe.Chain
@@ -29,7 +32,14 @@ type MsTree struct {
 		context context.Context
 		cancel  context.CancelFunc
 		luakit  *luakit.Kit
+		keyring *KeyRing
+		quota   *Quotas
+		canary  *Canary
+		reject  map[string]string
 		error   error
+
+		//服务更新 观察期结束后的替换和回滚串行执行
+		updating sync.Mutex
 	}
 }
 
@@ -82,6 +92,21 @@ func (mt *MsTree) LuaKit() *luakit.Kit {
 	return mt.private.luakit.Clone()
 }
 
+func (mt *MsTree) Quota(key string) lua.Quota {
+	if mt.private.quota == nil {
+		return lua.Quota{}
+	}
+	return mt.private.quota.Get(key)
+}
+
+func (mt *MsTree) Canary() *Canary {
+	return mt.private.canary
+}
+
+func (mt *MsTree) Depend() *Depend {
+	return mt.depend
+}
+
 func (mt *MsTree) Context() context.Context {
 	return mt.private.context
 }
@@ -121,7 +146,8 @@ func (mt *MsTree) Remove(filter func(ms *MicroService) bool) {
 			mss = append(mss, mt.cache.data[i])
 			continue
 		}
-		ms.Close()
+		ms.retire()
+		mt.depend.remove(ms.Key())
 		mt.Debugf("service.%s remove succeed", ms.Key())
 	}
 	mt.cache.data = mss
@@ -141,10 +167,14 @@ func (mt *MsTree) Close() error {
 func NewMicoSrvTree(parent context.Context, kit *luakit.Kit, option *MicroServiceOption) *MsTree {
 	ctx, cancel := context.WithCancel(parent)
 	tree := &MsTree{}
+	tree.depend = NewDepend()
 	tree.private.context = ctx
 	tree.private.cancel = cancel
 	tree.private.luakit = kit
 	tree.private.protect = option.protect
+	tree.private.keyring = option.keyring
+	tree.private.quota = option.quota
+	tree.private.canary = option.canary
 	tree.handler.Report = option.report
 	tree.handler.Create = option.create
 	tree.handler.Error = option.error
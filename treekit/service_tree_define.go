@@ -22,19 +22,36 @@ func (mt *MsTree) diff(ctx *fasthttp.RequestCtx) (err error) {
 		return
 	}
 
+	mt.private.updating.Lock()
+	defer mt.private.updating.Unlock()
+
+	if err = diff.Verify(mt.private.keyring); err != nil {
+		mt.Errorf("%v", err)
+		return
+	}
+
+	diff.Updates = mt.accept(diff.Updates)
+
 	//diff remove task by ids
+	var names, removes []string
 	mt.Remove(func(ms *MicroService) bool {
-		return libkit.In(diff.Removes, ms.ID())
+		if libkit.In(diff.Removes, ms.ID()) {
+			removes = append(removes, ms.Key())
+			return true
+		}
+		return false
 	})
 
+	names = append(names, removes...)
 	errs := errkit.New()
 	for _, entry := range diff.Updates {
-		if e := mt.Register(entry.Name, entry.Chunk, func(c *MicoServiceConfig) {
-			c.ID = entry.ID
-			c.Hash = entry.Hash
-			c.Dialect = entry.Dialect
-			c.MTime = entry.MTime
-		}); e != nil {
+		if staged, e := mt.stage(entry); staged {
+			errs.Try(entry.Name, e)
+			continue
+		}
+
+		names = append(names, entry.Name)
+		if e := mt.Register(entry.Name, entry.Chunk, entry.option); e != nil {
 			errs.Try(entry.Name, e)
 		}
 	}
@@ -43,7 +60,9 @@ func (mt *MsTree) diff(ctx *fasthttp.RequestCtx) (err error) {
 		mt.Errorf(e.Error())
 	}
 
+	mt.cascade(names...)
 	mt.Wakeup()
+	mt.settle(diff.Updates, removes)
 	return mt.HttpServiceView(ctx)
 }
 
@@ -0,0 +1,203 @@
+package treekit
+
+import (
+	"fmt"
+	"github.com/vela-public/onekit/libkit"
+	"regexp"
+	"sort"
+	"strings"
+	"sync"
+)
+
+// import("key.name") import "key.name"
+var importRe = regexp.MustCompile(`(?m)^[^-\n]*?\bimport\s*\(?\s*["']([^."'\s]+)\.`)
+
+type node struct {
+	deps   []string
+	static bool //源码扫描得到 服务运行后替换为 import 记录
+}
+
+// Depend 服务依赖图 边为 服务 -> 被导入的服务
+type Depend struct {
+	mutex sync.RWMutex
+	nodes map[string]*node
+}
+
+// scan 服务运行前通过源码预估依赖 只用于启动排序
+func (d *Depend) scan(key string, source []byte) {
+	var deps []string
+	for _, m := range importRe.FindAllSubmatch(source, -1) {
+		dep := string(m[1])
+		if dep != key && !libkit.In(deps, dep) {
+			deps = append(deps, dep)
+		}
+	}
+
+	d.mutex.Lock()
+	defer d.mutex.Unlock()
+	d.nodes[key] = &node{deps: deps, static: true}
+}
+
+// reset 服务重新运行前清空依赖 由 import 重新记录
+func (d *Depend) reset(key string) {
+	d.mutex.Lock()
+	defer d.mutex.Unlock()
+	d.nodes[key] = &node{}
+}
+
+func (d *Depend) remove(key string) {
+	d.mutex.Lock()
+	defer d.mutex.Unlock()
+	delete(d.nodes, key)
+}
+
+// path 查找 from 到 to 的依赖路径 忽略源码扫描的依赖
+func (d *Depend) path(from, to string, seen map[string]bool) []string {
+	if from == to {
+		return []string{to}
+	}
+
+	if seen[from] {
+		return nil
+	}
+	seen[from] = true
+
+	n, ok := d.nodes[from]
+	if !ok || n.static {
+		return nil
+	}
+
+	for _, dep := range n.deps {
+		if p := d.path(dep, to, seen); p != nil {
+			return append([]string{from}, p...)
+		}
+	}
+	return nil
+}
+
+// link 记录 from 导入 to 形成环时返回错误
+func (d *Depend) link(from, to string) error {
+	d.mutex.Lock()
+	defer d.mutex.Unlock()
+
+	if p := d.path(to, from, make(map[string]bool)); p != nil {
+		return fmt.Errorf("import cycle %s -> %s", from, strings.Join(p, " -> "))
+	}
+
+	n, ok := d.nodes[from]
+	if !ok || n.static {
+		n = &node{}
+		d.nodes[from] = n
+	}
+
+	if !libkit.In(n.deps, to) {
+		n.deps = append(n.deps, to)
+	}
+	return nil
+}
+
+// Dependents 依赖 keys 的所有服务 包含间接依赖
+func (d *Depend) Dependents(keys ...string) []string {
+	d.mutex.RLock()
+	defer d.mutex.RUnlock()
+
+	var ret []string
+	todo := append([]string(nil), keys...)
+	seen := make(map[string]bool)
+	for _, key := range keys {
+		seen[key] = true
+	}
+
+	for len(todo) > 0 {
+		key := todo[0]
+		todo = todo[1:]
+		for name, n := range d.nodes {
+			if seen[name] || n.static || !libkit.In(n.deps, key) {
+				continue
+			}
+			seen[name] = true
+			ret = append(ret, name)
+			todo = append(todo, name)
+		}
+	}
+
+	sort.Strings(ret)
+	return ret
+}
+
+// Sort 按依赖排序 被依赖的服务在前 相互依赖的服务保持原有顺序放在最后并返回错误
+func (d *Depend) Sort(keys []string) ([]string, error) {
+	d.mutex.RLock()
+	defer d.mutex.RUnlock()
+
+	pending := make(map[string]int, len(keys))
+	for _, key := range keys {
+		pending[key] = 0
+	}
+
+	edges := make(map[string][]string)
+	for _, key := range keys {
+		n, ok := d.nodes[key]
+		if !ok {
+			continue
+		}
+		for _, dep := range n.deps {
+			if _, ok := pending[dep]; ok && dep != key {
+				pending[key]++
+				edges[dep] = append(edges[dep], key)
+			}
+		}
+	}
+
+	ret := make([]string, 0, len(keys))
+	done := make(map[string]bool, len(keys))
+	for len(ret) < len(keys) {
+		ready := false
+		for _, key := range keys {
+			if done[key] || pending[key] > 0 {
+				continue
+			}
+			done[key] = true
+			ready = true
+			ret = append(ret, key)
+			for _, next := range edges[key] {
+				pending[next]--
+			}
+		}
+
+		if !ready {
+			break
+		}
+	}
+
+	if len(ret) == len(keys) {
+		return ret, nil
+	}
+
+	var cycle []string
+	for _, key := range keys {
+		if !done[key] {
+			cycle = append(cycle, key)
+			ret = append(ret, key)
+		}
+	}
+	return ret, fmt.Errorf("depend cycle %s", strings.Join(cycle, ","))
+}
+
+// View 每个服务的依赖
+func (d *Depend) View() map[string][]string {
+	d.mutex.RLock()
+	defer d.mutex.RUnlock()
+
+	tab := make(map[string][]string, len(d.nodes))
+	for key, n := range d.nodes {
+		if len(n.deps) > 0 {
+			tab[key] = append([]string(nil), n.deps...)
+		}
+	}
+	return tab
+}
+
+func NewDepend() *Depend {
+	return &Depend{nodes: make(map[string]*node)}
+}
@@ -0,0 +1,114 @@
+package treekit
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestDependSort(t *testing.T) {
+	cases := []struct {
+		name   string
+		source map[string]string
+		keys   []string
+		want   string
+		cycle  bool
+	}{
+		{
+			name: "none",
+			keys: []string{"a", "b", "c"},
+			want: "a,b,c",
+		},
+		{
+			name:   "chain",
+			source: map[string]string{"a": `local b = import("b.x")`, "b": `import "c.y"`},
+			keys:   []string{"a", "b", "c"},
+			want:   "c,b,a",
+		},
+		{
+			name:   "diamond",
+			source: map[string]string{"a": "import('b.x')\nimport('c.x')", "b": `import("d.x")`, "c": `import("d.x")`},
+			keys:   []string{"a", "b", "c", "d"},
+			want:   "d,b,c,a",
+		},
+		{
+			name:   "outside",
+			source: map[string]string{"a": `import("z.x")`, "b": `import("a.x")`},
+			keys:   []string{"b", "a"},
+			want:   "a,b",
+		},
+		{
+			name:   "comment",
+			source: map[string]string{"a": `-- import("b.x")`},
+			keys:   []string{"a", "b"},
+			want:   "a,b",
+		},
+		{
+			name:   "self",
+			source: map[string]string{"a": `import("a.x")`},
+			keys:   []string{"a"},
+			want:   "a",
+		},
+		{
+			name:   "cycle",
+			source: map[string]string{"a": `import("b.x")`, "b": `import("c.x")`, "c": `import("a.x")`, "d": `import("a.x")`},
+			keys:   []string{"d", "e", "a", "b", "c"},
+			want:   "e,d,a,b,c",
+			cycle:  true,
+		},
+	}
+
+	for _, c := range cases {
+		d := NewDepend()
+		for key, source := range c.source {
+			d.scan(key, []byte(source))
+		}
+
+		ret, err := d.Sort(c.keys)
+		if got := strings.Join(ret, ","); got != c.want {
+			t.Fatalf("%s got %s want %s", c.name, got, c.want)
+		}
+
+		if c.cycle != (err != nil) {
+			t.Fatalf("%s cycle error %v", c.name, err)
+		}
+	}
+}
+
+func TestDependLink(t *testing.T) {
+	d := NewDepend()
+	// 源码扫描的依赖不参与环检测
+	d.scan("c", []byte(`import("a.x")`))
+
+	steps := []struct {
+		from, to string
+		fail     bool
+	}{
+		{"a", "b", false},
+		{"b", "c", false},
+		{"a", "b", false},
+		{"c", "a", true},
+		{"c", "d", false},
+		{"d", "a", true},
+		{"b", "b", true},
+	}
+
+	for _, step := range steps {
+		err := d.link(step.from, step.to)
+		if step.fail != (err != nil) {
+			t.Fatalf("link %s -> %s error %v", step.from, step.to, err)
+		}
+	}
+
+	if err := d.link("c", "a"); err == nil || !strings.Contains(err.Error(), "c -> a -> b -> c") {
+		t.Fatalf("cycle error %v", err)
+	}
+
+	view := d.View()
+	if strings.Join(view["a"], ",") != "b" || strings.Join(view["c"], ",") != "d" {
+		t.Fatalf("view %v", view)
+	}
+
+	if got := strings.Join(d.Dependents("d"), ","); got != "a,b,c" {
+		t.Fatalf("dependents %s", got)
+	}
+}
@@ -2,8 +2,11 @@ package treekit
 
 import (
 	"github.com/vela-public/onekit/cast"
+	"github.com/vela-public/onekit/lua"
 	"github.com/vela-public/onekit/noop"
 	"github.com/vela-public/onekit/pipe"
+	"go.etcd.io/bbolt"
+	"time"
 )
 
 type MicroServiceOption struct {
@@ -13,6 +16,9 @@ type MicroServiceOption struct {
 	wakeup  *pipe.Chain
 	panic   *pipe.Chain
 	report  *pipe.Chain
+	keyring *KeyRing
+	quota   *Quotas
+	canary  *Canary
 	protect bool
 }
 
@@ -42,6 +48,7 @@ func DefaultServiceOption() *MicroServiceOption {
 func NewMicoServiceOption() *MicroServiceOption {
 	return &MicroServiceOption{
 		protect: false,
+		quota:   NewQuotas(),
 		create:  pipe.NewChain(),
 		error:   pipe.NewChain(),
 		debug:   pipe.NewLazyChain[string](),
@@ -55,12 +62,35 @@ func (mso *MicroServiceOption) Protect(flag bool) {
 	mso.protect = flag
 }
 
+// KeyRing 配置后远程下发的服务必须携带有效的签名
+func (mso *MicroServiceOption) KeyRing(kr *KeyRing) {
+	mso.keyring = kr
+}
+
+// Quota 服务虚拟机的资源限制 keys 为空时对所有服务生效
+func (mso *MicroServiceOption) Quota(q lua.Quota, keys ...string) {
+	mso.quota.Set(q, keys...)
+}
+
+// Canary 更新的服务观察 window 时间后记录为稳定版本 失败时回滚
+func (mso *MicroServiceOption) Canary(db *bbolt.DB, window time.Duration) {
+	mso.canary = NewCanary(db, window)
+}
+
 func (mso *MicroServiceOption) Create(fn func(*Process)) {
-	mso.create.NewHandler(fn)
+	mso.create.NewHandler(func(v any) {
+		if p, ok := v.(*Process); ok {
+			fn(p)
+		}
+	})
 }
 
 func (mso *MicroServiceOption) Error(fn func(error)) {
-	mso.error.NewHandler(fn)
+	mso.error.NewHandler(func(v any) {
+		if err, ok := v.(error); ok {
+			fn(err)
+		}
+	})
 }
 
 func (mso *MicroServiceOption) Debug(fn func(string)) {
@@ -68,13 +98,25 @@ func (mso *MicroServiceOption) Debug(fn func(string)) {
 }
 
 func (mso *MicroServiceOption) Wakeup(fn func(*Process)) {
-	mso.wakeup.NewHandler(fn)
+	mso.wakeup.NewHandler(func(v any) {
+		if p, ok := v.(*Process); ok {
+			fn(p)
+		}
+	})
 }
 
 func (mso *MicroServiceOption) Panic(fn func(error)) {
-	mso.panic.NewHandler(fn)
+	mso.panic.NewHandler(func(v any) {
+		if err, ok := v.(error); ok {
+			fn(err)
+		}
+	})
 }
 
 func (mso *MicroServiceOption) Report(fn func(*MsTree)) {
-	mso.report.NewHandler(fn)
+	mso.report.NewHandler(func(v any) {
+		if mt, ok := v.(*MsTree); ok {
+			fn(mt)
+		}
+	})
 }
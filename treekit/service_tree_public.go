@@ -6,6 +6,7 @@ import (
 	"github.com/vela-public/onekit/errkit"
 	"github.com/vela-public/onekit/libkit"
 	"os"
+	"strings"
 )
 
 func (mt *MsTree) UnwrapErr() error {
@@ -52,14 +53,16 @@ func (mt *MsTree) View() *TreeView {
 	mt.cache.mutex.RLock()
 	defer mt.cache.mutex.RUnlock()
 	tv := new(TreeView)
+	tv.Reject = mt.private.reject
 	sz := len(mt.cache.data)
 	if sz == 0 {
 		return tv
 	}
-	for i := 0; i < sz; i++ {
-		tas := mt.cache.data[i]
+	for _, tas := range mt.order() {
 		tv.Services = append(tv.Services, tas.View())
+		tv.Order = append(tv.Order, tas.Key())
 	}
+	tv.Depend = mt.depend.View()
 	return tv
 }
 
@@ -91,48 +94,47 @@ func (mt *MsTree) DoDiff(v []*ServiceEntry) error {
 		})
 	}
 
-	linked := func(filter func(...string) bool, ss []*ServiceEntry, todo func(link string)) {
-		for _, entry := range ss {
-			if filter(entry.Name) {
-				todo(entry.Name)
-			}
-		}
-	}
+	return mt.update(diff)
+}
 
-	for _, mod := range diff.Nothing {
-		ms, ok := mt.find(mod.Name)
-		if !ok {
-			ms.NoError("can view %s service but not found service", mod.Name)
+// accept 校验服务签名 本地加载的服务不需要签名 拒绝的服务记录在 TreeView.Reject 并上报
+func (mt *MsTree) accept(entries []*ServiceEntry) []*ServiceEntry {
+	var ret []*ServiceEntry
+	reject := make(map[string]string)
+	for _, entry := range entries {
+		if entry.local {
+			ret = append(ret, entry)
 			continue
 		}
 
-		if len(ms.config.Source) == 0 {
+		if err := entry.Verify(mt.private.keyring); err != nil {
+			reject[entry.Name] = err.Error()
+			mt.Errorf("%v", err)
 			continue
 		}
+		ret = append(ret, entry)
+	}
 
-		linked(ms.BeLink, diff.Updates, func(link string) {
-			if !ms.HasSource() {
-				mt.Errorf("want update %s service cause linked %s but not found source", ms.Key(), link)
-				return
-			}
-			diff.Updates = append(diff.Updates, ms.Again())
-			mt.Debugf("update %s service cause linked %s", ms.Key(), link)
-		})
+	mt.cache.mutex.Lock()
+	mt.private.reject = reject
+	mt.cache.mutex.Unlock()
 
-		linked(ms.BeLink, diff.Removes, func(link string) {
-			if !ms.HasSource() {
-				mt.Errorf("want remove %s service cause linked %s but not found source", ms.Key(), link)
-				return
-			}
-			diff.Updates = append(diff.Updates, ms.Again())
-			mt.Debugf("update %s service cause linked %s", ms.Key(), link)
-		})
+	if len(reject) > 0 {
+		mt.report()
 	}
-
-	return mt.update(diff)
+	return ret
 }
 
+// update 持有更新锁 与观察期结束后的替换和回滚 目录监听的更新串行执行
 func (mt *MsTree) update(d Diff) error {
+	mt.private.updating.Lock()
+	defer mt.private.updating.Unlock()
+	return mt.apply(d)
+}
+
+// apply 调用方需要持有更新锁
+func (mt *MsTree) apply(d Diff) error {
+	d.Updates = mt.accept(d.Updates)
 	if d.NotChange() {
 		return nil
 	}
@@ -148,13 +150,15 @@ func (mt *MsTree) update(d Diff) error {
 	})
 
 	errs := errkit.New()
+	names := d.RemoveNames()
 	for _, entry := range d.Updates {
-		if e := mt.Register(entry.Name, entry.Chunk, func(c *MicoServiceConfig) {
-			c.ID = entry.ID
-			c.Hash = entry.Hash
-			c.Dialect = entry.Dialect
-			c.MTime = entry.MTime
-		}); e != nil {
+		if staged, e := mt.stage(entry); staged {
+			errs.Try(entry.Name, e)
+			continue
+		}
+
+		names = append(names, entry.Name)
+		if e := mt.Register(entry.Name, entry.Chunk, entry.option); e != nil {
 			errs.Try(entry.Name, e)
 		}
 	}
@@ -162,7 +166,10 @@ func (mt *MsTree) update(d Diff) error {
 	if e := errs.Wrap(); e != nil {
 		mt.Errorf(e.Error())
 	}
+
+	mt.cascade(names...)
 	mt.Wakeup()
+	mt.settle(d.Updates, d.RemoveNames())
 	return mt.UnwrapErr()
 }
 
@@ -185,9 +192,11 @@ func (mt *MsTree) create(config *MicoServiceConfig) (*MicroService, error) {
 		}
 		tas.build()
 		mt.push(tas)
+		mt.depend.scan(config.Key, config.Source)
 		return tas, nil
 	}
 	tas.update(config)
+	mt.depend.scan(config.Key, config.Source)
 	return tas, tas.UnwrapErr()
 }
 
@@ -215,7 +224,7 @@ func (mt *MsTree) DoServiceFile(key string, path string) error {
 	if err != nil {
 		return err
 	}
-	return tas.wakeup()
+	return mt.restart(tas)
 }
 
 func (mt *MsTree) DoString(v *LuaText) error {
@@ -227,7 +236,7 @@ func (mt *MsTree) DoString(v *LuaText) error {
 	if err != nil {
 		return err
 	}
-	return tas.wakeup()
+	return mt.restart(tas)
 }
 
 func (mt *MsTree) Reload(filter func(name string) bool) error {
@@ -303,6 +312,65 @@ func (mt *MsTree) report() {
 	mt.handler.Report.Invoke(mt)
 }
 
+// cascade 依赖 keys 的服务标记为更新 返回按依赖排序的服务
+func (mt *MsTree) cascade(keys ...string) []*MicroService {
+	order, err := mt.depend.Sort(mt.depend.Dependents(keys...))
+	if err != nil {
+		mt.Errorf("%v", err)
+	}
+
+	var ret []*MicroService
+	for _, name := range order {
+		ms, ok := mt.find(name)
+		if !ok || ms.has(Disable) {
+			continue
+		}
+
+		if !ms.HasSource() {
+			mt.Errorf("want restart %s service cause linked %s but not found source", name, strings.Join(keys, ","))
+			continue
+		}
+
+		ms.update(ms.config)
+		mt.Debugf("restart %s service cause linked %s", name, strings.Join(keys, ","))
+		ret = append(ret, ms)
+	}
+	return ret
+}
+
+// restart 唤醒服务后按顺序重启依赖它的服务
+func (mt *MsTree) restart(tas *MicroService) error {
+	err := tas.wakeup()
+	for _, ms := range mt.cascade(tas.Key()) {
+		if e := mt.SafeWakeup(ms); e != nil {
+			mt.Errorf("restart %s service fail %v", ms.Key(), e)
+		}
+	}
+	return err
+}
+
+// order 按依赖排序 被导入的服务先启动
+func (mt *MsTree) order() []*MicroService {
+	sz := len(mt.cache.data)
+	keys := make([]string, sz)
+	tab := make(map[string]*MicroService, sz)
+	for i, tas := range mt.cache.data {
+		keys[i] = tas.Key()
+		tab[tas.Key()] = tas
+	}
+
+	keys, err := mt.depend.Sort(keys)
+	if err != nil {
+		mt.Errorf("%v", err)
+	}
+
+	ret := make([]*MicroService, sz)
+	for i, key := range keys {
+		ret[i] = tab[key]
+	}
+	return ret
+}
+
 func (mt *MsTree) Wakeup() {
 	mt.cache.mutex.RLock()
 	defer mt.cache.mutex.RUnlock()
@@ -312,8 +380,7 @@ func (mt *MsTree) Wakeup() {
 	}
 
 	errs := &errkit.JoinError{}
-	for i := 0; i < sz; i++ {
-		tas := mt.cache.data[i]
+	for _, tas := range mt.order() {
 		err := mt.SafeWakeup(tas)
 		errs.Try(tas.Key(), err)
 	}
@@ -0,0 +1,263 @@
+package treekit
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+type stat struct {
+	mtime time.Time
+	size  int64
+}
+
+// Watcher 轮询本地目录 文件名去掉后缀作为服务名
+// 文件变化后等待 debounce 没有新的变化才通过 DoDiff 的流程更新 编辑器保存时的多次写入只触发一次
+type Watcher struct {
+	mutex    sync.Mutex
+	tree     *MsTree
+	dir      string
+	pattern  string
+	interval time.Duration
+	debounce time.Duration
+	last     map[string]stat //path
+	applied  map[string]stat //path 最近一次更新时的状态
+	keys     map[string]bool //由目录加载的服务
+	dirty    time.Time
+	cancel   context.CancelFunc
+}
+
+func (w *Watcher) key(path string) string {
+	name := filepath.Base(path)
+	return strings.TrimSuffix(name, filepath.Ext(name))
+}
+
+func (w *Watcher) scan() (map[string]stat, error) {
+	files, err := filepath.Glob(filepath.Join(w.dir, w.pattern))
+	if err != nil {
+		return nil, err
+	}
+
+	tab := make(map[string]stat, len(files))
+	for _, path := range files {
+		st, e := os.Stat(path)
+		if e != nil || st.IsDir() {
+			continue
+		}
+		tab[path] = stat{mtime: st.ModTime(), size: st.Size()}
+	}
+	return tab, nil
+}
+
+func (w *Watcher) changed(now map[string]stat) bool {
+	if len(now) != len(w.last) {
+		return true
+	}
+
+	for path, st := range now {
+		old, ok := w.last[path]
+		if !ok || old != st {
+			return true
+		}
+	}
+	return false
+}
+
+// diff 对比服务的 MTime 和 Hash 只处理目录加载的服务
+func (w *Watcher) diff(files map[string]stat) (Diff, error) {
+	var d Diff
+	var errs []string
+	tab := w.tree.Map()
+	keys := make(map[string]bool, len(files))
+
+	paths := make([]string, 0, len(files))
+	for path := range files {
+		paths = append(paths, path)
+	}
+	sort.Strings(paths)
+
+	for _, path := range paths {
+		key := w.key(path)
+		if e := Name(key); e != nil {
+			errs = append(errs, fmt.Sprintf("%s %v", path, e))
+			continue
+		}
+		keys[key] = true
+
+		view, ok := tab[key]
+		if st, seen := w.applied[path]; ok && seen && st == files[path] {
+			continue
+		}
+
+		entry, e := Read(key, path)
+		if e != nil {
+			errs = append(errs, fmt.Sprintf("%s %v", path, e))
+			continue
+		}
+
+		w.applied[path] = files[path]
+		if ok && view.Hash == entry.Hash {
+			continue
+		}
+		d.Updates = append(d.Updates, entry)
+	}
+
+	for path := range w.applied {
+		if _, ok := files[path]; !ok {
+			delete(w.applied, path)
+		}
+	}
+
+	for key := range w.keys {
+		if keys[key] {
+			continue
+		}
+
+		if view, ok := tab[key]; ok {
+			d.Removes = append(d.Removes, &ServiceEntry{
+				Name:  view.Name,
+				ID:    view.ID,
+				MTime: view.MTime,
+			})
+		}
+	}
+	w.keys = keys
+
+	if len(errs) > 0 {
+		return d, fmt.Errorf("%s", strings.Join(errs, "\n"))
+	}
+	return d, nil
+}
+
+// apply 对比和更新期间持有服务树的更新锁
+func (w *Watcher) apply(files map[string]stat) error {
+	w.tree.private.updating.Lock()
+	defer w.tree.private.updating.Unlock()
+
+	d, err := w.diff(files)
+	if d.NotChange() {
+		return err
+	}
+
+	w.tree.Debugf("watch %s update %s remove %s", w.dir,
+		strings.Join(d.UpdateNames(), ","), strings.Join(d.RemoveNames(), ","))
+
+	if e := w.tree.apply(d); e != nil {
+		return e
+	}
+	return err
+}
+
+func (w *Watcher) poll() {
+	files, err := w.scan()
+	if err != nil {
+		w.tree.Errorf("watch %s %v", w.dir, err)
+		return
+	}
+
+	w.mutex.Lock()
+	defer w.mutex.Unlock()
+
+	if w.changed(files) {
+		w.last = files
+		w.dirty = time.Now()
+		return
+	}
+
+	if w.dirty.IsZero() || time.Since(w.dirty) < w.debounce {
+		return
+	}
+
+	w.dirty = time.Time{}
+	if e := w.apply(files); e != nil {
+		w.tree.Errorf("watch %s apply fail %v", w.dir, e)
+	}
+}
+
+func (w *Watcher) loop(ctx context.Context) {
+	tk := time.NewTicker(w.interval)
+	defer tk.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-tk.C:
+			w.poll()
+		}
+	}
+}
+
+func (w *Watcher) Close() error {
+	w.cancel()
+	return nil
+}
+
+// WatchInterval 轮询目录的间隔 默认 1s
+func WatchInterval(d time.Duration) func(*Watcher) {
+	return func(w *Watcher) {
+		if d > 0 {
+			w.interval = d
+		}
+	}
+}
+
+// WatchDebounce 文件停止变化多久后更新 默认 500ms
+func WatchDebounce(d time.Duration) func(*Watcher) {
+	return func(w *Watcher) {
+		if d >= 0 {
+			w.debounce = d
+		}
+	}
+}
+
+// Watch 加载 dir 下匹配 pattern 的脚本 之后文件新增 修改 删除时自动更新服务
+func (mt *MsTree) Watch(dir string, pattern string, options ...func(*Watcher)) (*Watcher, error) {
+	st, err := os.Stat(dir)
+	if err != nil {
+		return nil, err
+	}
+
+	if !st.IsDir() {
+		return nil, fmt.Errorf("watch %s not directory", dir)
+	}
+
+	if pattern == "" {
+		pattern = "*.lua"
+	}
+
+	if _, err = filepath.Match(pattern, ""); err != nil {
+		return nil, err
+	}
+
+	w := &Watcher{
+		tree:     mt,
+		dir:      dir,
+		pattern:  pattern,
+		interval: time.Second,
+		debounce: 500 * time.Millisecond,
+		applied:  make(map[string]stat),
+		keys:     make(map[string]bool),
+	}
+
+	for _, fn := range options {
+		fn(w)
+	}
+
+	files, err := w.scan()
+	if err != nil {
+		return nil, err
+	}
+	w.last = files
+	err = w.apply(files)
+
+	ctx, cancel := context.WithCancel(mt.Context())
+	w.cancel = cancel
+	go w.loop(ctx)
+	return w, err
+}
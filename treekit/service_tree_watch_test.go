@@ -0,0 +1,166 @@
+package treekit
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/vela-public/onekit/luakit"
+)
+
+type watchLog struct {
+	mutex sync.Mutex
+	text  []string
+}
+
+func (l *watchLog) debug(s string) {
+	if !strings.HasPrefix(s, "watch ") {
+		return
+	}
+	l.mutex.Lock()
+	l.text = append(l.text, s)
+	l.mutex.Unlock()
+}
+
+func (l *watchLog) take() []string {
+	l.mutex.Lock()
+	defer l.mutex.Unlock()
+	text := l.text
+	l.text = nil
+	return text
+}
+
+// newWatchTree 轮询间隔足够长 测试里手动调用 poll
+func newWatchTree(t *testing.T, debounce time.Duration) (*MsTree, *Watcher, *watchLog, string) {
+	t.Helper()
+	log := &watchLog{}
+	opt := NewMicoServiceOption()
+	opt.Protect(true)
+	opt.Debug(log.debug)
+	opt.Error(func(error) {})
+
+	ctx, cancel := context.WithCancel(context.Background())
+	t.Cleanup(cancel)
+	mt := NewMicoSrvTree(ctx, luakit.Apply("luakit"), opt)
+
+	dir := t.TempDir()
+	write(t, dir, "aa.lua", `local aa = 1`)
+	write(t, dir, "bb.lua", `local bb = 1`)
+	write(t, dir, "note.txt", `ignore`)
+
+	w, err := mt.Watch(dir, "*.lua", WatchInterval(time.Hour), WatchDebounce(debounce))
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { _ = w.Close() })
+	return mt, w, log, dir
+}
+
+func write(t *testing.T, dir string, name string, text string) {
+	t.Helper()
+	if err := os.WriteFile(filepath.Join(dir, name), []byte(text), 0644); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func keys(mt *MsTree) string {
+	var ret []string
+	for _, ms := range mt.order() {
+		ret = append(ret, ms.Key())
+	}
+	return strings.Join(ret, ",")
+}
+
+func TestWatchMapping(t *testing.T) {
+	mt, w, log, dir := newWatchTree(t, 0)
+	if got := keys(mt); got != "aa,bb" {
+		t.Fatalf("load services %s want aa,bb", got)
+	}
+	log.take()
+
+	settle := func() []string {
+		w.poll() // 发现变化
+		w.poll() // 没有新的变化 更新
+		return log.take()
+	}
+
+	hash := mt.Map()["aa"].Hash
+	write(t, dir, "aa.lua", `local aa = 22`)
+	write(t, dir, "cc.lua", `local cc = 1`)
+	if err := os.Remove(filepath.Join(dir, "bb.lua")); err != nil {
+		t.Fatal(err)
+	}
+
+	text := settle()
+	if len(text) != 1 || !strings.HasSuffix(text[0], "update aa,cc remove bb") {
+		t.Fatalf("watch update %v", text)
+	}
+
+	if got := keys(mt); got != "aa,cc" {
+		t.Fatalf("services %s want aa,cc", got)
+	}
+
+	if mt.Map()["aa"].Hash == hash {
+		t.Fatal("aa hash not changed")
+	}
+
+	// 内容不变只修改时间 不触发更新
+	later := time.Now().Add(time.Minute)
+	if err := os.Chtimes(filepath.Join(dir, "cc.lua"), later, later); err != nil {
+		t.Fatal(err)
+	}
+	if text = settle(); len(text) != 0 {
+		t.Fatalf("touch file want nothing got %v", text)
+	}
+
+	// 不是目录加载的服务不会被删除
+	if err := mt.Register("other", []byte(`local o = 1`)); err != nil {
+		t.Fatal(err)
+	}
+	write(t, dir, "aa.lua", `local aa = 333`)
+	if text = settle(); len(text) != 1 || !strings.HasSuffix(text[0], "update aa remove ") {
+		t.Fatalf("watch update %v", text)
+	}
+	if _, ok := mt.find("other"); !ok {
+		t.Fatal("other service removed by watcher")
+	}
+}
+
+func TestWatchDebounce(t *testing.T) {
+	debounce := 100 * time.Millisecond
+	mt, w, log, dir := newWatchTree(t, debounce)
+	log.take()
+
+	// 编辑器保存时的多次写入
+	for i, text := range []string{`local aa = 22`, `local aa = 333`, `local aa = 4444`} {
+		write(t, dir, "aa.lua", text)
+		w.poll()
+		if i == 0 {
+			time.Sleep(debounce / 2)
+		}
+	}
+
+	w.poll()
+	if text := log.take(); len(text) != 0 {
+		t.Fatalf("update within debounce %v", text)
+	}
+
+	time.Sleep(debounce + 20*time.Millisecond)
+	w.poll()
+	w.poll()
+	if text := log.take(); len(text) != 1 || !strings.HasSuffix(text[0], "update aa remove ") {
+		t.Fatalf("want one update got %v", text)
+	}
+
+	entry, err := Read("aa", filepath.Join(dir, "aa.lua"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if mt.Map()["aa"].Hash != entry.Hash {
+		t.Fatal("service not updated to last write")
+	}
+}
@@ -2,7 +2,11 @@ package treekit
 
 import (
 	"encoding/json"
+	"fmt"
 	"github.com/vela-public/onekit/libkit"
+	"github.com/vela-public/onekit/lua"
+	"strconv"
+	"strings"
 	"time"
 )
 
@@ -23,6 +27,44 @@ type ServiceEntry struct {
 	Chunk   []byte `json:"chunk"`
 	Hash    string `json:"hash"`
 	MTime   int64  `json:"mtime"`
+
+	//签名的公钥编号 为空时尝试所有公钥
+	KeyID     string `json:"key_id"`
+	Signature string `json:"signature"`
+
+	//本地文件加载 不从下发的数据中解析
+	local bool
+}
+
+// Message 签名的内容 代码使用 sha256 代替
+func (se *ServiceEntry) Message() []byte {
+	return []byte(fmt.Sprintf("service\n%d\n%s\n%s", se.ID, se.Name, Sha256(se.Chunk)))
+}
+
+// Verify 配置公钥后必须携带有效的签名
+func (se *ServiceEntry) Verify(kr *KeyRing) error {
+	if kr == nil || kr.Len() == 0 {
+		return nil
+	}
+
+	if err := kr.Verify(se.KeyID, se.Message(), se.Signature); err != nil {
+		return fmt.Errorf("service %s %v", se.Name, err)
+	}
+	return nil
+}
+
+func (se *ServiceEntry) option(c *MicoServiceConfig) {
+	c.ID = se.ID
+	c.Hash = se.Hash
+	c.Dialect = se.Dialect
+	c.MTime = se.MTime
+}
+
+func (se *ServiceEntry) Config() (*MicoServiceConfig, error) {
+	return NewConfig(se.Name, func(c *MicoServiceConfig) {
+		c.Source = se.Chunk
+		se.option(c)
+	})
 }
 
 type Diff struct {
@@ -58,6 +100,31 @@ func (d Diff) RemoveNames() []string {
 type ServiceDiffInfo struct {
 	Removes []int64         `json:"removes"`
 	Updates []*ServiceEntry `json:"updates"`
+
+	//删除列表的签名 更新的服务各自携带签名
+	KeyID     string `json:"key_id"`
+	Signature string `json:"signature"`
+}
+
+// Message 删除列表签名的内容
+func (sd *ServiceDiffInfo) Message() []byte {
+	ids := make([]string, len(sd.Removes))
+	for i, id := range sd.Removes {
+		ids[i] = strconv.FormatInt(id, 10)
+	}
+	return []byte("removes\n" + strings.Join(ids, ","))
+}
+
+// Verify 配置公钥后删除服务必须携带有效的签名
+func (sd *ServiceDiffInfo) Verify(kr *KeyRing) error {
+	if kr == nil || kr.Len() == 0 || len(sd.Removes) == 0 {
+		return nil
+	}
+
+	if err := kr.Verify(sd.KeyID, sd.Message(), sd.Signature); err != nil {
+		return fmt.Errorf("service removes %v", err)
+	}
+	return nil
 }
 
 type Runner struct {
@@ -76,22 +143,27 @@ type LuaText struct {
 }
 
 type ServiceView struct {
-	ID      int64     `json:"id"`
-	Dialect bool      `json:"dialect"`
-	Name    string    `json:"name"`
-	Link    string    `json:"link"`
-	Status  string    `json:"status"`
-	Hash    string    `json:"hash"`
-	From    string    `json:"from"`
-	Uptime  time.Time `json:"uptime"`
-	Failed  bool      `json:"failed"`
-	Cause   string    `json:"cause"`
-	Runners []*Runner `json:"runners"`
-	MTime   int64     `json:"mtime"`
+	ID      int64           `json:"id"`
+	Dialect bool            `json:"dialect"`
+	Name    string          `json:"name"`
+	Link    string          `json:"link"`
+	Status  string          `json:"status"`
+	Hash    string          `json:"hash"`
+	From    string          `json:"from"`
+	Uptime  time.Time       `json:"uptime"`
+	Failed  bool            `json:"failed"`
+	Cause   string          `json:"cause"`
+	Quota   *lua.QuotaError `json:"quota,omitempty"`
+	Rollout *Rollout        `json:"rollout,omitempty"`
+	Runners []*Runner       `json:"runners"`
+	MTime   int64           `json:"mtime"`
 }
 
 type TreeView struct {
-	Services []*ServiceView `json:"tasks"`
+	Services []*ServiceView      `json:"tasks"`
+	Order    []string            `json:"order"`
+	Depend   map[string][]string `json:"depend"`
+	Reject   map[string]string   `json:"reject"`
 }
 
 func (tv *TreeView) Text() []byte {
@@ -0,0 +1,112 @@
+package treekit
+
+import (
+	"crypto/ed25519"
+	"crypto/sha1"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"fmt"
+	"strings"
+	"sync"
+)
+
+// KeyRing ed25519 公钥 用于校验任务和服务的签名 kid 为密钥编号
+type KeyRing struct {
+	mutex sync.RWMutex
+	keys  map[string]ed25519.PublicKey
+}
+
+func (kr *KeyRing) Add(kid string, key []byte) error {
+	if len(key) != ed25519.PublicKeySize {
+		return fmt.Errorf("invalid ed25519 public key %s size %d", kid, len(key))
+	}
+
+	kr.mutex.Lock()
+	defer kr.mutex.Unlock()
+	kr.keys[kid] = ed25519.PublicKey(key)
+	return nil
+}
+
+// AddText 公钥为 base64 或者 hex 编码
+func (kr *KeyRing) AddText(kid string, text string) error {
+	key, err := decode(text)
+	if err != nil {
+		return fmt.Errorf("invalid ed25519 public key %s %v", kid, err)
+	}
+	return kr.Add(kid, key)
+}
+
+func (kr *KeyRing) Remove(kid string) {
+	kr.mutex.Lock()
+	defer kr.mutex.Unlock()
+	delete(kr.keys, kid)
+}
+
+func (kr *KeyRing) Len() int {
+	kr.mutex.RLock()
+	defer kr.mutex.RUnlock()
+	return len(kr.keys)
+}
+
+// Verify kid 为空时尝试所有公钥
+func (kr *KeyRing) Verify(kid string, msg []byte, signature string) error {
+	if signature == "" {
+		return fmt.Errorf("not found signature")
+	}
+
+	sig, err := decode(signature)
+	if err != nil {
+		return fmt.Errorf("invalid signature %v", err)
+	}
+
+	kr.mutex.RLock()
+	defer kr.mutex.RUnlock()
+
+	if kid != "" {
+		key, ok := kr.keys[kid]
+		if !ok {
+			return fmt.Errorf("not found public key %s", kid)
+		}
+
+		if !ed25519.Verify(key, msg, sig) {
+			return fmt.Errorf("signature verify fail with key %s", kid)
+		}
+		return nil
+	}
+
+	for _, key := range kr.keys {
+		if ed25519.Verify(key, msg, sig) {
+			return nil
+		}
+	}
+	return fmt.Errorf("signature verify fail")
+}
+
+func NewKeyRing() *KeyRing {
+	return &KeyRing{keys: make(map[string]ed25519.PublicKey)}
+}
+
+// Sign 生成 base64 编码的签名 下发端使用
+func Sign(key ed25519.PrivateKey, msg []byte) string {
+	return base64.StdEncoding.EncodeToString(ed25519.Sign(key, msg))
+}
+
+func decode(text string) ([]byte, error) {
+	text = strings.TrimSpace(text)
+	if data, err := hex.DecodeString(text); err == nil {
+		return data, nil
+	}
+	return base64.StdEncoding.DecodeString(text)
+}
+
+func Sha1(data []byte) string {
+	sum := sha1.Sum(data)
+	return hex.EncodeToString(sum[:])
+}
+
+// Sha256 签名覆盖的代码摘要 sha1 存在碰撞 不能用于签名
+func Sha256(data []byte) string {
+	sum := sha256.Sum256(data)
+	return hex.EncodeToString(sum[:])
+}
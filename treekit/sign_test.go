@@ -0,0 +1,140 @@
+package treekit
+
+import (
+	"context"
+	"crypto/ed25519"
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/valyala/fasthttp"
+)
+
+func newSignTree(t *testing.T) (*MsTree, ed25519.PrivateKey, *int) {
+	t.Helper()
+	pub, key, err := ed25519.GenerateKey(nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	kr := NewKeyRing()
+	if err = kr.Add("k1", pub); err != nil {
+		t.Fatal(err)
+	}
+
+	reports := new(int)
+	opt := NewMicoServiceOption()
+	opt.KeyRing(kr)
+	opt.Report(func(*MsTree) { *reports++ })
+
+	ctx, cancel := context.WithCancel(context.Background())
+	t.Cleanup(cancel)
+	return NewMicoSrvTree(ctx, nil, opt), key, reports
+}
+
+func TestAcceptSignature(t *testing.T) {
+	mt, key, reports := newSignTree(t)
+
+	signed := &ServiceEntry{ID: 1, Name: "signed", Chunk: []byte("print(1)"), KeyID: "k1"}
+	signed.Signature = Sign(key, signed.Message())
+
+	tampered := &ServiceEntry{ID: 2, Name: "tampered", Chunk: []byte("print(2)")}
+	tampered.Signature = Sign(key, tampered.Message())
+	tampered.Chunk = []byte("os.exit()")
+
+	// dialect 可以被下发的数据伪造 不能跳过校验
+	var spoofed ServiceEntry
+	_ = json.Unmarshal([]byte(`{"id":3,"name":"spoofed","dialect":true,"chunk":"cHJpbnQoMyk="}`), &spoofed)
+
+	path := filepath.Join(t.TempDir(), "local.lua")
+	if err := os.WriteFile(path, []byte("print(4)"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	local, err := Read("local", path)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	ret := mt.accept([]*ServiceEntry{signed, tampered, &spoofed, local})
+	if len(ret) != 2 || ret[0] != signed || ret[1] != local {
+		t.Fatalf("accept got %d entries", len(ret))
+	}
+
+	reject := mt.View().Reject
+	if len(reject) != 2 || reject["tampered"] == "" || reject["spoofed"] == "" {
+		t.Fatalf("reject %v", reject)
+	}
+
+	if *reports != 1 {
+		t.Fatalf("report %d want 1", *reports)
+	}
+}
+
+func TestDiffRemoveSignature(t *testing.T) {
+	mt, key, _ := newSignTree(t)
+
+	post := func(info ServiceDiffInfo) error {
+		body, _ := json.Marshal(info)
+		ctx := &fasthttp.RequestCtx{}
+		ctx.Request.SetBody(body)
+		return mt.diff(ctx)
+	}
+
+	if err := post(ServiceDiffInfo{Removes: []int64{1, 2}}); err == nil {
+		t.Fatal("unsigned removes accepted")
+	}
+
+	info := ServiceDiffInfo{Removes: []int64{1, 2}, KeyID: "k1"}
+	info.Signature = Sign(key, info.Message())
+	info.Removes = []int64{1, 2, 3}
+	if err := post(info); err == nil {
+		t.Fatal("tampered removes accepted")
+	}
+
+	info.Removes = []int64{1, 2}
+	if err := post(info); err != nil {
+		t.Fatalf("signed removes %v", err)
+	}
+}
+
+// 签名覆盖代码的 sha256 摘要
+func TestMessageDigest(t *testing.T) {
+	const digest = "d287bb7f9d15abdc5b6e98536263815744b6ef21c8f3c839fc434ca70d8efe99"
+	code := []byte("print(1)")
+	if sum := Sha256(code); sum != digest {
+		t.Fatalf("sha256 %s", sum)
+	}
+
+	se := &ServiceEntry{ID: 1, Name: "signed", Chunk: code}
+	if msg := string(se.Message()); msg != "service\n1\nsigned\n"+digest {
+		t.Fatalf("service message %q", msg)
+	}
+
+	tc := &TaskConfig{ID: 1, ExecID: 2, Name: "task", Timeout: 3, Interval: 4, Code: string(code)}
+	if msg := string(tc.Message()); msg != "task\n1\n2\ntask\n3\n\n4\n"+digest {
+		t.Fatalf("task message %q", msg)
+	}
+}
+
+func TestTaskSignature(t *testing.T) {
+	pub, key, err := ed25519.GenerateKey(nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	kr := NewKeyRing()
+	if err = kr.Add("k1", pub); err != nil {
+		t.Fatal(err)
+	}
+
+	tc := &TaskConfig{ID: 1, Name: "task", Code: "print(1)", KeyID: "k1"}
+	tc.Signature = Sign(key, tc.Message())
+	if err = tc.Verify(kr); err != nil {
+		t.Fatal(err)
+	}
+
+	tc.Code = "print(2)"
+	if err = tc.Verify(kr); err == nil {
+		t.Fatal("tampered code accepted")
+	}
+}
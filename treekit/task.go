@@ -1,7 +1,9 @@
 package treekit
 
 import (
+	"bytes"
 	"context"
+	"errors"
 	"fmt"
 	"github.com/vela-public/onekit/libkit"
 	"github.com/vela-public/onekit/lua"
@@ -13,12 +15,29 @@ import (
 	"time"
 )
 
+// 任务的触发方式
+const (
+	TriggerPush     = "push"
+	TriggerCron     = "cron"
+	TriggerInterval = "interval"
+	TriggerRerun    = "rerun"
+)
+
+// 捕获输出的最大长度
+const OutputMax = 64 * 1024
+
 type Reply struct {
-	ID      int64                       `json:"id"`
-	ExecID  int64                       `json:"exec_id"`
-	Succeed bool                        `json:"succeed"`
-	Data    *libkit.DataKV[string, any] `json:"data"`
-	Reason  string                      `json:"reason"`
+	ID       int64                       `json:"id"`
+	ExecID   int64                       `json:"exec_id"`
+	Name     string                      `json:"name"`
+	Trigger  string                      `json:"trigger"`
+	Succeed  bool                        `json:"succeed"`
+	Data     *libkit.DataKV[string, any] `json:"data"`
+	Reason   string                      `json:"reason"`
+	Start    time.Time                   `json:"start"`
+	Duration int64                       `json:"duration"` //毫秒
+	Output   string                      `json:"output"`
+	Quota    *lua.QuotaError             `json:"quota,omitempty"`
 }
 
 type Task struct {
@@ -38,6 +57,12 @@ type Task struct {
 		LState  *lua.LState
 	}
 
+	//print error debug 的输出
+	output struct {
+		mutex sync.Mutex
+		data  bytes.Buffer
+	}
+
 	processes struct {
 		mutex sync.RWMutex
 		data  []*Process
@@ -217,28 +242,77 @@ func (t *Task) Startup(v ProcessType, env *Env) {
 
 }
 
-func (t *Task) pcall() {
+// Write 捕获任务的输出 超过 OutputMax 后丢弃
+func (t *Task) Write(p []byte) (int, error) {
+	t.output.mutex.Lock()
+	defer t.output.mutex.Unlock()
+
+	if n := OutputMax - t.output.data.Len(); n > 0 {
+		t.output.data.Write(p[:min(n, len(p))])
+	}
+	return len(p), nil
+}
+
+func (t *Task) Output() string {
+	t.output.mutex.Lock()
+	defer t.output.mutex.Unlock()
+	return t.output.data.String()
+}
+
+// Cancel 取消正在执行的任务
+func (t *Task) Cancel() {
+	if t.private.Cancel != nil {
+		t.private.Cancel()
+	}
+}
+
+func (t *Task) call() error {
 	co := t.private.LState
 	reader := strings.NewReader(t.config.Code)
 
 	fn, err := co.Load(reader, "="+t.config.Name)
 	if err != nil {
-		t.reply.Reason = err.Error()
-		return
+		return err
 	}
 
-	err = co.CallByParam(lua.P{
+	return co.CallByParam(lua.P{
 		Fn:      fn,
 		NRet:    0,
 		Protect: t.Tree().Protect(),
 	})
+}
 
-	if err != nil {
+func (t *Task) pcall() {
+	tree := t.Tree()
+	defer func() {
+		t.private.Cancel()
+		tree.done(t)
+	}()
+
+	err := t.call()
+	if e := t.private.Context.Err(); e != nil && err == nil {
+		//虚拟机被取消时直接退出 不返回错误
+		err = e
+	}
+	t.reply.Duration = time.Since(t.reply.Start).Milliseconds()
+	t.reply.Output = t.Output()
+
+	switch {
+	case err == nil:
+	case errors.Is(t.private.Context.Err(), context.Canceled):
+		t.reply.Reason = "task canceled"
+	case errors.Is(t.private.Context.Err(), context.DeadlineExceeded):
+		t.reply.Reason = fmt.Sprintf("task timeout %s", t.Timeout())
+	default:
 		t.reply.Reason = err.Error()
+		var qe *lua.QuotaError
+		if errors.As(err, &qe) {
+			t.reply.Quota = qe
+		}
 	}
 
 	t.reply.Succeed = err == nil
-	t.Tree().Report(t)
+	tree.Report(t)
 }
 
 func (t *Task) do() error {
@@ -250,11 +324,19 @@ func (t *Task) do() error {
 	t.private.Context = ctx
 	t.private.Cancel = cancel
 
+	// 定时和重新执行的任务 同一个任务同时只执行一次
+	t.reply.Start = time.Now()
+	if !tree.add(t, t.reply.Trigger != TriggerPush) {
+		cancel()
+		return fmt.Errorf("task %s still running skip %s", t.config.Name, t.reply.Trigger)
+	}
+
 	//init lua.LState coroutine
 	kit := tree.NewKit() // 功能的注入 lua 虚拟机
 	t.Preload(kit)
 	t.private.LState = kit.NewState(ctx, t.Key(), func(option *lua.Options) {
 		option.Exdata = t
+		option.Quota = tree.Quota(t.config.Name)
 		option.ErrHandle = func(err error) {
 			if err == nil {
 				return
@@ -262,11 +344,15 @@ func (t *Task) do() error {
 		}
 	})
 
-	tree.Submit(t)
+	if err := tree.Submit(t); err != nil {
+		tree.done(t)
+		t.private.Cancel()
+		return err
+	}
 	return nil
 }
 
-func NewTask(t *TaskTree, config *TaskConfig) *Task {
+func newTask(t *TaskTree, config *TaskConfig, trigger string) *Task {
 	tas := &Task{
 		config: config,
 	}
@@ -276,9 +362,21 @@ func NewTask(t *TaskTree, config *TaskConfig) *Task {
 	tas.reply = &Reply{
 		ID:      config.ID,
 		ExecID:  config.ExecID,
+		Name:    config.Name,
+		Trigger: trigger,
 		Succeed: false,
 		Data:    libkit.NewDataKV[string, any](),
 		Reason:  "",
 	}
 	return tas
 }
+
+// NewTask 代码或者签名校验失败时返回错误 任务不可执行
+func NewTask(t *TaskTree, config *TaskConfig) (*Task, error) {
+	tas := newTask(t, config, TriggerPush)
+	if err := config.Verify(t.private.keyring); err != nil {
+		tas.reply.Reason = err.Error()
+		return tas, err
+	}
+	return tas, nil
+}
@@ -1,5 +1,11 @@
 package treekit
 
+import (
+	"fmt"
+	"github.com/vela-public/onekit/cast"
+	"strings"
+)
+
 type TaskConfig struct {
 	// task ID
 	ID int64 `json:"id"`
@@ -21,4 +27,41 @@ type TaskConfig struct {
 
 	//timeout
 	Timeout int64 `json:"timeout"`
+
+	//定时执行 cron 表达式
+	Cron string `json:"cron"`
+
+	//间隔执行 单位秒 与 cron 二选一
+	Interval int64 `json:"interval"`
+
+	//签名的公钥编号 为空时尝试所有公钥
+	KeyID string `json:"key_id"`
+
+	//ed25519 签名 覆盖 Message 的内容
+	Signature string `json:"signature"`
+}
+
+// Message 签名的内容 代码使用 sha256 代替
+func (tc *TaskConfig) Message() []byte {
+	text := fmt.Sprintf("task\n%d\n%d\n%s\n%d\n%s\n%d\n%s", tc.ID, tc.ExecID, tc.Name, tc.Timeout,
+		tc.Cron, tc.Interval, Sha256(cast.S2B(tc.Code)))
+	return cast.S2B(text)
+}
+
+// Verify 校验代码的 sha1 配置公钥后必须携带有效的签名
+func (tc *TaskConfig) Verify(kr *KeyRing) error {
+	if tc.CodeSha1 != "" {
+		if sum := Sha1(cast.S2B(tc.Code)); !strings.EqualFold(sum, tc.CodeSha1) {
+			return fmt.Errorf("task %s code sha1 mismatch want %s got %s", tc.Name, tc.CodeSha1, sum)
+		}
+	}
+
+	if kr == nil || kr.Len() == 0 {
+		return nil
+	}
+
+	if err := kr.Verify(tc.KeyID, tc.Message(), tc.Signature); err != nil {
+		return fmt.Errorf("task %s %v", tc.Name, err)
+	}
+	return nil
 }
@@ -0,0 +1,156 @@
+package treekit
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Cron 标准的5段表达式 分 时 日 月 周 6段时第一段为秒
+// 支持 * , - / 以及 @yearly @monthly @weekly @daily @hourly
+type Cron struct {
+	second uint64
+	minute uint64
+	hour   uint64
+	dom    uint64
+	month  uint64
+	dow    uint64
+	any    bool //日或者周为 *
+}
+
+var cronMacro = map[string]string{
+	"@yearly":   "0 0 1 1 *",
+	"@annually": "0 0 1 1 *",
+	"@monthly":  "0 0 1 * *",
+	"@weekly":   "0 0 * * 0",
+	"@daily":    "0 0 * * *",
+	"@midnight": "0 0 * * *",
+	"@hourly":   "0 * * * *",
+}
+
+// cronField 解析单个字段 返回位图
+func cronField(text string, min, max int) (uint64, error) {
+	var bits uint64
+	for _, item := range strings.Split(text, ",") {
+		expr, step, hasStep := strings.Cut(item, "/")
+		n := 1
+		if hasStep {
+			v, err := strconv.Atoi(step)
+			if err != nil || v <= 0 {
+				return 0, fmt.Errorf("invalid cron step %s", item)
+			}
+			n = v
+		}
+
+		lo, hi := min, max
+		switch {
+		case expr == "*" || expr == "?":
+		case strings.Contains(expr, "-"):
+			a, b, _ := strings.Cut(expr, "-")
+			var e1, e2 error
+			lo, e1 = strconv.Atoi(a)
+			hi, e2 = strconv.Atoi(b)
+			if e1 != nil || e2 != nil {
+				return 0, fmt.Errorf("invalid cron range %s", item)
+			}
+		default:
+			v, err := strconv.Atoi(expr)
+			if err != nil {
+				return 0, fmt.Errorf("invalid cron value %s", item)
+			}
+			lo = v
+			if !hasStep {
+				hi = v
+			}
+		}
+
+		if lo < min || hi > max || lo > hi {
+			return 0, fmt.Errorf("cron value %s out of range %d-%d", item, min, max)
+		}
+
+		for i := lo; i <= hi; i += n {
+			bits |= 1 << uint(i)
+		}
+	}
+	return bits, nil
+}
+
+func ParseCron(expr string) (*Cron, error) {
+	expr = strings.TrimSpace(expr)
+	if v, ok := cronMacro[expr]; ok {
+		expr = v
+	}
+
+	fields := strings.Fields(expr)
+	switch len(fields) {
+	case 5:
+		fields = append([]string{"0"}, fields...)
+	case 6:
+	default:
+		return nil, fmt.Errorf("invalid cron expression %s", expr)
+	}
+
+	c := &Cron{}
+	var err error
+	ranges := []struct {
+		bits     *uint64
+		min, max int
+	}{
+		{&c.second, 0, 59},
+		{&c.minute, 0, 59},
+		{&c.hour, 0, 23},
+		{&c.dom, 1, 31},
+		{&c.month, 1, 12},
+		{&c.dow, 0, 7},
+	}
+
+	for i, r := range ranges {
+		if *r.bits, err = cronField(fields[i], r.min, r.max); err != nil {
+			return nil, err
+		}
+	}
+
+	//周日可以写作 0 或者 7
+	if c.dow&(1<<7) != 0 {
+		c.dow |= 1
+	}
+
+	c.any = strings.HasPrefix(fields[3], "*") || strings.HasPrefix(fields[5], "*")
+	return c, nil
+}
+
+func (c *Cron) day(t time.Time) bool {
+	dom := c.dom&(1<<uint(t.Day())) != 0
+	dow := c.dow&(1<<uint(t.Weekday())) != 0
+
+	//日或者周为 * 时同时满足 都有限制时满足其一即可
+	if c.any {
+		return dom && dow
+	}
+	return dom || dow
+}
+
+// Next t 之后的下一次触发时间 五年内没有匹配时返回零值
+func (c *Cron) Next(t time.Time) time.Time {
+	t = t.Truncate(time.Second).Add(time.Second)
+	end := t.AddDate(5, 0, 0)
+
+	for t.Before(end) {
+		switch {
+		case c.month&(1<<uint(t.Month())) == 0:
+			t = time.Date(t.Year(), t.Month()+1, 1, 0, 0, 0, 0, t.Location())
+		case !c.day(t):
+			t = time.Date(t.Year(), t.Month(), t.Day()+1, 0, 0, 0, 0, t.Location())
+		case c.hour&(1<<uint(t.Hour())) == 0:
+			t = time.Date(t.Year(), t.Month(), t.Day(), t.Hour()+1, 0, 0, 0, t.Location())
+		case c.minute&(1<<uint(t.Minute())) == 0:
+			t = time.Date(t.Year(), t.Month(), t.Day(), t.Hour(), t.Minute()+1, 0, 0, t.Location())
+		case c.second&(1<<uint(t.Second())) == 0:
+			t = t.Add(time.Second)
+		default:
+			return t
+		}
+	}
+	return time.Time{}
+}
@@ -0,0 +1,82 @@
+package treekit
+
+import (
+	"testing"
+	"time"
+)
+
+func TestParseCron(t *testing.T) {
+	for _, expr := range []string{
+		"* * * *",
+		"60 * * * *",
+		"* 24 * * *",
+		"* * 0 * *",
+		"* * * 13 *",
+		"* * * * 8",
+		"*/0 * * * *",
+		"5-1 * * * *",
+		"a * * * *",
+		"1-a * * * *",
+		"@never",
+	} {
+		if _, err := ParseCron(expr); err == nil {
+			t.Fatalf("%s want error", expr)
+		}
+	}
+}
+
+func TestCronNext(t *testing.T) {
+	at := func(text string) time.Time {
+		v, err := time.Parse("2006-01-02 15:04:05", text)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return v
+	}
+
+	// 2024-01-01 为周一
+	cases := []struct {
+		expr string
+		from string
+		want string
+	}{
+		{"*/15 * * * *", "2024-01-01 00:07:30", "2024-01-01 00:15:00"},
+		{"5,35 * * * *", "2024-01-01 00:05:00", "2024-01-01 00:35:00"},
+		{"0 9-17/4 * * *", "2024-01-01 10:00:00", "2024-01-01 13:00:00"},
+		{"0 9-17/4 * * *", "2024-01-01 17:00:00", "2024-01-02 09:00:00"},
+		{"*/10 * * * * *", "2024-01-01 00:00:05", "2024-01-01 00:00:10"},
+		{"@monthly", "2024-01-15 08:00:00", "2024-02-01 00:00:00"},
+		{"@yearly", "2024-06-01 00:00:00", "2025-01-01 00:00:00"},
+		{"0 0 29 2 *", "2024-03-01 00:00:00", "2028-02-29 00:00:00"},
+
+		// 7 和 0 都表示周日
+		{"30 2 * * 7", "2024-01-01 00:00:00", "2024-01-07 02:30:00"},
+		{"30 2 * * 0", "2024-01-01 00:00:00", "2024-01-07 02:30:00"},
+		{"0 0 * * 5-7", "2024-01-01 00:00:00", "2024-01-05 00:00:00"},
+
+		// 日为 * 时只按周匹配
+		{"0 0 * * 5", "2024-01-05 00:00:00", "2024-01-12 00:00:00"},
+		{"0 0 */2 * 5", "2024-01-05 00:00:00", "2024-01-19 00:00:00"},
+
+		// 日和周都有限制时满足其一
+		{"0 0 13 * 5", "2024-01-01 00:00:00", "2024-01-05 00:00:00"},
+		{"0 0 13 * 5", "2024-01-12 00:00:00", "2024-01-13 00:00:00"},
+		{"0 0 1 * 1", "2024-01-01 00:00:00", "2024-01-08 00:00:00"},
+	}
+
+	for _, c := range cases {
+		cron, err := ParseCron(c.expr)
+		if err != nil {
+			t.Fatalf("%s %v", c.expr, err)
+		}
+
+		if got := cron.Next(at(c.from)); !got.Equal(at(c.want)) {
+			t.Fatalf("%s from %s got %s want %s", c.expr, c.from, got, c.want)
+		}
+	}
+
+	never, _ := ParseCron("0 0 31 2 *")
+	if got := never.Next(at("2024-01-01 00:00:00")); !got.IsZero() {
+		t.Fatalf("never got %s", got)
+	}
+}
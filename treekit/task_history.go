@@ -0,0 +1,72 @@
+package treekit
+
+import (
+	"fmt"
+	"github.com/vela-public/onekit/bucket"
+	"go.etcd.io/bbolt"
+	"strconv"
+	"sync"
+)
+
+// History 任务的执行结果 每个任务一个 bucket 按序号循环覆盖 只保留最近 size 条
+type History struct {
+	mutex sync.Mutex
+	db    *bbolt.DB
+	name  string
+	size  int64
+}
+
+func (h *History) bucket(id int64) *bucket.Bucket[Reply] {
+	return bucket.Pack[Reply](h.db, h.name, strconv.FormatInt(id, 10))
+}
+
+func (h *History) seq(bkt *bucket.Bucket[Reply]) *bucket.Bucket[int64] {
+	return bucket.To[Reply, int64](bkt)
+}
+
+func (h *History) slot(n int64) string {
+	return fmt.Sprintf("%06d", n%h.size)
+}
+
+func (h *History) Push(r *Reply) error {
+	h.mutex.Lock()
+	defer h.mutex.Unlock()
+
+	bkt := h.bucket(r.ID)
+	n := h.seq(bkt).Get("seq").Value()
+	if err := bkt.Set(h.slot(n), *r, 0); err != nil {
+		return err
+	}
+	return h.seq(bkt).Set("seq", n+1, 0)
+}
+
+// Query 按时间倒序返回任务的执行结果
+func (h *History) Query(id int64) ([]*Reply, error) {
+	h.mutex.Lock()
+	defer h.mutex.Unlock()
+
+	bkt := h.bucket(id)
+	n := h.seq(bkt).Get("seq").Value()
+
+	var ret []*Reply
+	for i := n - 1; i >= 0 && i >= n-h.size; i-- {
+		r, err := bkt.Get(h.slot(i)).Unwrap()
+		if err != nil {
+			return ret, fmt.Errorf("task %d history %d %v", id, i, err)
+		}
+		ret = append(ret, &r)
+	}
+	return ret, nil
+}
+
+func NewHistory(db *bbolt.DB, size int) *History {
+	if size <= 0 {
+		size = 32
+	}
+
+	return &History{
+		db:   db,
+		name: "task_history",
+		size: int64(size),
+	}
+}
@@ -0,0 +1,63 @@
+package treekit
+
+import (
+	"path/filepath"
+	"testing"
+
+	"go.etcd.io/bbolt"
+)
+
+func newHistoryDB(t *testing.T) *bbolt.DB {
+	t.Helper()
+	db, err := bbolt.Open(filepath.Join(t.TempDir(), "history.db"), 0600, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { db.Close() })
+	return db
+}
+
+// 超过 size 后循环覆盖最早的记录
+func TestHistoryWrap(t *testing.T) {
+	h := NewHistory(newHistoryDB(t), 3)
+
+	steps := []struct {
+		push int64
+		want []int64
+	}{
+		{1, []int64{1}},
+		{2, []int64{2, 1}},
+		{3, []int64{3, 2, 1}},
+		{4, []int64{4, 3, 2}},
+		{5, []int64{5, 4, 3}},
+		{6, []int64{6, 5, 4}},
+		{7, []int64{7, 6, 5}},
+	}
+
+	for _, step := range steps {
+		if err := h.Push(&Reply{ID: 1, ExecID: step.push}); err != nil {
+			t.Fatal(err)
+		}
+		// 其他任务的记录互不影响
+		_ = h.Push(&Reply{ID: 2, ExecID: -step.push})
+
+		ret, err := h.Query(1)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		if len(ret) != len(step.want) {
+			t.Fatalf("push %d got %d replies", step.push, len(ret))
+		}
+
+		for i, r := range ret {
+			if r.ExecID != step.want[i] {
+				t.Fatalf("push %d reply %d exec %d want %d", step.push, i, r.ExecID, step.want[i])
+			}
+		}
+	}
+
+	if ret, _ := h.Query(3); len(ret) != 0 {
+		t.Fatalf("empty task got %d replies", len(ret))
+	}
+}
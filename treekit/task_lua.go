@@ -1,6 +1,7 @@
 package treekit
 
 import (
+	"bytes"
 	"github.com/vela-public/onekit/event"
 	"github.com/vela-public/onekit/layer"
 	"github.com/vela-public/onekit/lua"
@@ -9,6 +10,20 @@ import (
 	"strings"
 )
 
+func (t *Task) printL(L *lua.LState) int {
+	n := L.GetTop()
+	var buf bytes.Buffer
+	for i := 1; i <= n; i++ {
+		if i > 1 {
+			buf.WriteByte('\t')
+		}
+		buf.WriteString(L.Get(i).String())
+	}
+	buf.WriteByte('\n')
+	_, _ = t.Write(buf.Bytes())
+	return 0
+}
+
 func (t *Task) privateL(L *lua.LState) int {
 	return 0
 }
@@ -39,6 +54,7 @@ func (t *Task) LazyEvent() *event.LazyEvent {
 func (t *Task) NewTaskErrorL(L *lua.LState) int {
 	line := L.Where(1)
 	text := "[" + line[:len(line)-1] + "]" + luakit.Format(L, 0)
+	_, _ = t.Write([]byte(text + "\n"))
 
 	t.LazyEvent().Error(text).Error().Report()
 	return 0
@@ -48,6 +64,7 @@ func (t *Task) NewTaskErrorL(L *lua.LState) int {
 func (t *Task) NewTaskDebugL(L *lua.LState) int {
 	line := L.Where(1)
 	text := "[" + line[:len(line)-1] + "]" + luakit.Format(L, 0)
+	_, _ = t.Write([]byte(text + "\n"))
 
 	ev := t.LazyEvent().Debug(text)
 	if t.Enable(zapcore.DebugLevel) {
@@ -114,6 +131,7 @@ func (t *Task) Preload(kit *luakit.Kit) { //luakit.error() luakit.trace() luakit
 	kit.Set("event", lua.NewFunction(t.NewTaskEventL))
 	kit.Set("error", lua.NewFunction(t.NewTaskErrorL))
 	kit.Set("debug", lua.NewFunction(t.NewTaskDebugL))
+	kit.SetGlobal("print", lua.NewFunction(t.printL))
 	kit.SetGlobal("this", lua.NewGeneric[*Task](t))
 	kit.SetGlobal("import", lua.NewExport("lua.taskit.export", lua.WithFunc(t.importL)))
 }
@@ -0,0 +1,195 @@
+package treekit
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"sync/atomic"
+	"time"
+)
+
+// schedule 定时任务 cron 或者固定间隔触发 上一次未结束时跳过
+type schedule struct {
+	config *TaskConfig
+	cron   *Cron
+	every  time.Duration
+	next   int64 //unix 毫秒
+	cancel context.CancelFunc
+}
+
+func (s *schedule) trigger() string {
+	if s.cron != nil {
+		return TriggerCron
+	}
+	return TriggerInterval
+}
+
+func (s *schedule) after(now time.Time) time.Time {
+	if s.cron != nil {
+		return s.cron.Next(now)
+	}
+	return now.Add(s.every)
+}
+
+func newSchedule(config *TaskConfig) (*schedule, error) {
+	s := &schedule{config: config}
+	switch {
+	case config.Cron != "":
+		c, err := ParseCron(config.Cron)
+		if err != nil {
+			return nil, err
+		}
+		s.cron = c
+	case config.Interval > 0:
+		s.every = time.Duration(config.Interval) * time.Second
+	default:
+		return nil, fmt.Errorf("task %s not found cron or interval", config.Name)
+	}
+	return s, nil
+}
+
+// Execution 正在执行或者定时的任务
+type Execution struct {
+	ID       int64     `json:"id"`
+	ExecID   int64     `json:"exec_id"`
+	Name     string    `json:"name"`
+	Trigger  string    `json:"trigger"`
+	Start    time.Time `json:"start,omitempty"`
+	Cron     string    `json:"cron,omitempty"`
+	Interval int64     `json:"interval,omitempty"`
+	Next     time.Time `json:"next,omitempty"`
+}
+
+func (t *TaskTree) loop(ctx context.Context, s *schedule) {
+	for {
+		next := s.after(time.Now())
+		if next.IsZero() {
+			t.Error(fmt.Errorf("task %s cron %s never trigger", s.config.Name, s.config.Cron))
+			return
+		}
+		atomic.StoreInt64(&s.next, next.UnixMilli())
+
+		timer := time.NewTimer(time.Until(next))
+		select {
+		case <-ctx.Done():
+			timer.Stop()
+			return
+		case <-timer.C:
+		}
+
+		if err := t.run(s.config, s.trigger()); err != nil {
+			t.Error(err)
+		}
+	}
+}
+
+// run 执行已经校验的任务 每次执行生成新的 ExecID
+func (t *TaskTree) run(config *TaskConfig, trigger string) error {
+	cfg := *config
+	if trigger != TriggerPush || cfg.ExecID == 0 {
+		cfg.ExecID = time.Now().UnixNano()
+	}
+	return newTask(t, &cfg, trigger).do()
+}
+
+// Push 校验任务 设置 cron 或者 interval 时定时执行 否则立即执行一次
+func (t *TaskTree) Push(config *TaskConfig) error {
+	tas, err := NewTask(t, config)
+	if err != nil {
+		t.Error(err)
+		t.Report(tas)
+		return err
+	}
+
+	t.retain(config)
+
+	if config.Cron == "" && config.Interval <= 0 {
+		t.Unschedule(config.ID)
+		return t.run(config, TriggerPush)
+	}
+	return t.Schedule(config)
+}
+
+func (t *TaskTree) Schedule(config *TaskConfig) error {
+	s, err := newSchedule(config)
+	if err != nil {
+		return err
+	}
+
+	ctx, cancel := context.WithCancel(t.Context())
+	s.cancel = cancel
+
+	t.cache.mutex.Lock()
+	if old, ok := t.cache.schedules[config.ID]; ok {
+		old.cancel()
+	}
+	t.cache.schedules[config.ID] = s
+	t.cache.mutex.Unlock()
+
+	go t.loop(ctx, s)
+	return nil
+}
+
+// Unschedule 删除定时任务 不影响正在执行的任务
+func (t *TaskTree) Unschedule(id int64) bool {
+	t.cache.mutex.Lock()
+	defer t.cache.mutex.Unlock()
+
+	s, ok := t.cache.schedules[id]
+	if !ok {
+		return false
+	}
+	s.cancel()
+	delete(t.cache.schedules, id)
+	return true
+}
+
+// Rerun 使用最近一次下发的配置重新执行 正在执行时返回错误
+func (t *TaskTree) Rerun(id int64) error {
+	t.cache.mutex.RLock()
+	config, ok := t.cache.configs[id]
+	if !ok {
+		if s, scheduled := t.cache.schedules[id]; scheduled {
+			config, ok = s.config, true
+		}
+	}
+	t.cache.mutex.RUnlock()
+
+	if !ok {
+		return fmt.Errorf("not found task %d", id)
+	}
+	return t.run(config, TriggerRerun)
+}
+
+// List 正在执行的任务和定时任务
+func (t *TaskTree) List() []*Execution {
+	t.cache.mutex.RLock()
+	defer t.cache.mutex.RUnlock()
+
+	var ret []*Execution
+	for _, tas := range t.cache.tasks {
+		ret = append(ret, &Execution{
+			ID:      tas.config.ID,
+			ExecID:  tas.config.ExecID,
+			Name:    tas.config.Name,
+			Trigger: tas.reply.Trigger,
+			Start:   tas.reply.Start,
+		})
+	}
+
+	for _, s := range t.cache.schedules {
+		ret = append(ret, &Execution{
+			ID:       s.config.ID,
+			Name:     s.config.Name,
+			Trigger:  s.trigger(),
+			Cron:     s.config.Cron,
+			Interval: s.config.Interval,
+			Next:     time.UnixMilli(atomic.LoadInt64(&s.next)),
+		})
+	}
+
+	sort.Slice(ret, func(i, j int) bool {
+		return ret[i].ID < ret[j].ID
+	})
+	return ret
+}
@@ -0,0 +1,204 @@
+package treekit
+
+import (
+	"context"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/vela-public/onekit/luakit"
+)
+
+func newTestTaskTree(t *testing.T) (*TaskTree, chan *Reply) {
+	t.Helper()
+	replies := make(chan *Reply, 16)
+	opt := NewTaskTreeOption()
+	opt.History(newHistoryDB(t), 8)
+	opt.Report(func(tas *Task) { replies <- tas.reply })
+
+	ctx, cancel := context.WithCancel(context.Background())
+	t.Cleanup(cancel)
+	return NewTaskTree(ctx, luakit.Apply("luakit"), opt), replies
+}
+
+func waitReply(t *testing.T, replies chan *Reply) *Reply {
+	t.Helper()
+	select {
+	case r := <-replies:
+		return r
+	case <-time.After(2 * time.Second):
+		t.Fatal("task not report")
+		return nil
+	}
+}
+
+func TestTaskCancel(t *testing.T) {
+	tree, replies := newTestTaskTree(t)
+	config := &TaskConfig{ID: 1, ExecID: 100, Name: "loop", Code: "while true do end"}
+	if err := tree.Push(config); err != nil {
+		t.Fatal(err)
+	}
+
+	if !tree.Running(1) || !tree.Have(100) {
+		t.Fatal("task not running")
+	}
+
+	// 正在执行时拒绝重新执行
+	if err := tree.Rerun(1); err == nil {
+		t.Fatal("rerun while running")
+	}
+
+	if tree.Cancel(999) {
+		t.Fatal("cancel unknown exec id")
+	}
+
+	if !tree.Cancel(100) {
+		t.Fatal("cancel fail")
+	}
+
+	r := waitReply(t, replies)
+	if r.Succeed || r.Reason != "task canceled" || r.ExecID != 100 || r.Trigger != TriggerPush {
+		t.Fatalf("canceled reply %+v", r)
+	}
+
+	deadline := time.Now().Add(time.Second)
+	for tree.Running(1) && time.Now().Before(deadline) {
+		time.Sleep(5 * time.Millisecond)
+	}
+	if tree.Running(1) {
+		t.Fatal("canceled task still running")
+	}
+}
+
+func TestTaskRerun(t *testing.T) {
+	tree, replies := newTestTaskTree(t)
+	if err := tree.Rerun(1); err == nil {
+		t.Fatal("rerun unknown task")
+	}
+
+	config := &TaskConfig{ID: 1, ExecID: 100, Name: "hello", Code: `print("hello")`}
+	if err := tree.Push(config); err != nil {
+		t.Fatal(err)
+	}
+
+	first := waitReply(t, replies)
+	if !first.Succeed || first.Output != "hello\n" || first.ExecID != 100 {
+		t.Fatalf("push reply %+v", first)
+	}
+
+	deadline := time.Now().Add(time.Second)
+	for tree.Running(1) && time.Now().Before(deadline) {
+		time.Sleep(5 * time.Millisecond)
+	}
+
+	if err := tree.Rerun(1); err != nil {
+		t.Fatal(err)
+	}
+
+	second := waitReply(t, replies)
+	if !second.Succeed || second.Trigger != TriggerRerun || second.ExecID == 100 {
+		t.Fatalf("rerun reply %+v", second)
+	}
+
+	history, err := tree.History(1)
+	if err != nil || len(history) != 2 || history[0].ExecID != second.ExecID {
+		t.Fatalf("history %d %v", len(history), err)
+	}
+}
+
+func TestTaskSchedule(t *testing.T) {
+	tree, replies := newTestTaskTree(t)
+	config := &TaskConfig{ID: 1, Name: "every", Code: `print("tick")`, Interval: 1}
+	if err := tree.Push(config); err != nil {
+		t.Fatal(err)
+	}
+
+	list := tree.List()
+	if len(list) != 1 || list[0].Trigger != TriggerInterval || list[0].Next.IsZero() {
+		t.Fatalf("list %+v", list)
+	}
+
+	if r := waitReply(t, replies); r.Trigger != TriggerInterval || !r.Succeed {
+		t.Fatalf("interval reply %+v", r)
+	}
+
+	if !tree.Unschedule(1) || tree.Unschedule(1) {
+		t.Fatal("unschedule")
+	}
+
+	select {
+	case r := <-replies:
+		t.Fatalf("unscheduled task triggered %+v", r)
+	case <-time.After(1200 * time.Millisecond):
+	}
+}
+
+// 并发的重新执行只有一个启动
+func TestTaskRerunOnce(t *testing.T) {
+	tree, replies := newTestTaskTree(t)
+	config := &TaskConfig{ID: 1, ExecID: 100, Name: "loop", Code: "while true do end", Cron: "0 0 1 1 *"}
+	if err := tree.Push(config); err != nil {
+		t.Fatal(err)
+	}
+
+	var wg sync.WaitGroup
+	var started int32
+	for i := 0; i < 8; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			if tree.Rerun(1) == nil {
+				atomic.AddInt32(&started, 1)
+			}
+		}()
+	}
+	wg.Wait()
+
+	if started != 1 {
+		t.Fatalf("started %d want 1", started)
+	}
+
+	for _, e := range tree.List() {
+		if e.Trigger == TriggerRerun {
+			tree.Cancel(e.ExecID)
+		}
+	}
+	if r := waitReply(t, replies); r.Trigger != TriggerRerun || r.Succeed {
+		t.Fatalf("rerun reply %+v", r)
+	}
+}
+
+func TestTaskRetain(t *testing.T) {
+	replies := make(chan *Reply, 16)
+	opt := NewTaskTreeOption()
+	opt.Retain(2)
+	opt.Report(func(tas *Task) { replies <- tas.reply })
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	tree := NewTaskTree(ctx, luakit.Apply("luakit"), opt)
+
+	for id := int64(1); id <= 3; id++ {
+		if err := tree.Push(&TaskConfig{ID: id, Name: "retain", Code: `local a = 1`}); err != nil {
+			t.Fatal(err)
+		}
+		waitReply(t, replies)
+	}
+
+	// 重新下发的配置移到最后
+	if err := tree.Push(&TaskConfig{ID: 2, Name: "retain", Code: `local a = 2`}); err != nil {
+		t.Fatal(err)
+	}
+	waitReply(t, replies)
+	if err := tree.Push(&TaskConfig{ID: 4, Name: "retain", Code: `local a = 4`}); err != nil {
+		t.Fatal(err)
+	}
+	waitReply(t, replies)
+
+	tree.cache.mutex.RLock()
+	defer tree.cache.mutex.RUnlock()
+	if len(tree.cache.configs) != 2 || tree.cache.configs[2] == nil || tree.cache.configs[4] == nil {
+		t.Fatalf("retain configs %v", tree.cache.recent)
+	}
+}
@@ -2,7 +2,9 @@ package treekit
 
 import (
 	"context"
+	"fmt"
 	"github.com/panjf2000/ants/v2"
+	"github.com/vela-public/onekit/lua"
 	"github.com/vela-public/onekit/luakit"
 	"github.com/vela-public/onekit/pipe"
 	"sync"
@@ -10,8 +12,11 @@ import (
 
 type TaskTree struct {
 	cache struct {
-		mutex sync.RWMutex
-		tasks []*Task
+		mutex     sync.RWMutex
+		tasks     []*Task //正在执行的任务
+		configs   map[int64]*TaskConfig
+		recent    []int64 //按下发顺序 最早的在前
+		schedules map[int64]*schedule
 	}
 
 	private struct {
@@ -19,7 +24,11 @@ type TaskTree struct {
 		cancel  context.CancelFunc
 		luakit  *luakit.Kit
 		protect bool
+		keyring *KeyRing
+		history *History
+		quota   *Quotas
 		threads *ants.Pool
+		keep    int
 	}
 
 	handler struct {
@@ -34,6 +43,13 @@ func (t *TaskTree) Protect() bool {
 	return t.private.protect
 }
 
+func (t *TaskTree) Quota(name string) lua.Quota {
+	if t.private.quota == nil {
+		return lua.Quota{}
+	}
+	return t.private.quota.Get(name)
+}
+
 func (t *TaskTree) Have(eid int64) bool {
 	t.cache.mutex.RLock()
 	defer t.cache.mutex.RUnlock()
@@ -49,11 +65,99 @@ func (t *TaskTree) Context() context.Context {
 	return t.private.context
 }
 
+// add exclusive 为 true 时同一个任务正在执行则不添加 检查和添加在同一个锁内
+func (t *TaskTree) add(tas *Task, exclusive bool) bool {
+	t.cache.mutex.Lock()
+	defer t.cache.mutex.Unlock()
+	if exclusive {
+		for _, item := range t.cache.tasks {
+			if item.config.ID == tas.config.ID {
+				return false
+			}
+		}
+	}
+	t.cache.tasks = append(t.cache.tasks, tas)
+	return true
+}
+
+// retain 记录最近下发的配置 超过 keep 个时删除最早的
+func (t *TaskTree) retain(config *TaskConfig) {
+	t.cache.mutex.Lock()
+	defer t.cache.mutex.Unlock()
+
+	if _, ok := t.cache.configs[config.ID]; ok {
+		for i, id := range t.cache.recent {
+			if id == config.ID {
+				t.cache.recent = append(t.cache.recent[:i], t.cache.recent[i+1:]...)
+				break
+			}
+		}
+	}
+	t.cache.configs[config.ID] = config
+	t.cache.recent = append(t.cache.recent, config.ID)
+
+	for len(t.cache.recent) > t.private.keep {
+		delete(t.cache.configs, t.cache.recent[0])
+		t.cache.recent = t.cache.recent[1:]
+	}
+}
+
+func (t *TaskTree) done(tas *Task) {
+	t.cache.mutex.Lock()
+	defer t.cache.mutex.Unlock()
+
+	for i, item := range t.cache.tasks {
+		if item == tas {
+			t.cache.tasks = append(t.cache.tasks[:i], t.cache.tasks[i+1:]...)
+			return
+		}
+	}
+}
+
+// Running 任务是否正在执行
+func (t *TaskTree) Running(id int64) bool {
+	t.cache.mutex.RLock()
+	defer t.cache.mutex.RUnlock()
+	for _, task := range t.cache.tasks {
+		if task.config.ID == id {
+			return true
+		}
+	}
+	return false
+}
+
+// Cancel 取消正在执行的任务
+func (t *TaskTree) Cancel(eid int64) bool {
+	t.cache.mutex.RLock()
+	defer t.cache.mutex.RUnlock()
+	for _, task := range t.cache.tasks {
+		if task.config.ExecID == eid {
+			task.Cancel()
+			return true
+		}
+	}
+	return false
+}
+
 func (t *TaskTree) Report(tas *Task) {
+	if h := t.private.history; h != nil {
+		if err := h.Push(tas.reply); err != nil {
+			t.Error(fmt.Errorf("task %s history save fail %v", tas.config.Name, err))
+		}
+	}
+
 	if t.handler.Report != nil {
 		t.handler.Report.Invoke(tas)
 	}
 }
+
+// History 任务最近的执行结果 未配置存储时返回错误
+func (t *TaskTree) History(id int64) ([]*Reply, error) {
+	if t.private.history == nil {
+		return nil, fmt.Errorf("task history not enable")
+	}
+	return t.private.history.Query(id)
+}
 func (t *TaskTree) Error(err error) {
 	if t.handler.Error != nil {
 		t.handler.Error.Invoke(err)
@@ -66,14 +170,15 @@ func (t *TaskTree) Panic(err error) {
 	}
 }
 
-func (t *TaskTree) Submit(tas *Task) {
+func (t *TaskTree) Submit(tas *Task) error {
 	if t.private.threads == nil {
-		return
+		return fmt.Errorf("task pool not ready")
 	}
 	err := t.private.threads.Submit(tas.pcall)
 	if err != nil {
 		t.Error(err)
 	}
+	return err
 }
 
 func NewTaskTree(parent context.Context, kit *luakit.Kit, option *TaskTreeOption) *TaskTree {
@@ -83,6 +188,12 @@ func NewTaskTree(parent context.Context, kit *luakit.Kit, option *TaskTreeOption
 	tree.private.cancel = cancel
 	tree.private.luakit = kit
 	tree.private.protect = option.protect
+	tree.private.keyring = option.keyring
+	tree.private.quota = option.quota
+	tree.private.history = option.history
+	tree.private.keep = option.retain
+	tree.cache.configs = make(map[int64]*TaskConfig)
+	tree.cache.schedules = make(map[int64]*schedule)
 	tree.handler.Report = option.report
 	tree.handler.Error = option.error
 	tree.handler.Panic = option.panic
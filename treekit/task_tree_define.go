@@ -2,10 +2,34 @@ package treekit
 
 import (
 	"encoding/json"
+	"fmt"
 	"github.com/valyala/fasthttp"
 	"github.com/vela-public/onekit/layer"
 )
 
+// TaskQuery 查询 取消 重新执行的参数
+type TaskQuery struct {
+	ID     int64 `json:"id"`
+	ExecID int64 `json:"exec_id"`
+}
+
+func (t *TaskTree) query(ctx *fasthttp.RequestCtx) (*TaskQuery, error) {
+	q := &TaskQuery{}
+	if err := json.Unmarshal(ctx.Request.Body(), q); err != nil {
+		return nil, err
+	}
+	return q, nil
+}
+
+func (t *TaskTree) reply(ctx *fasthttp.RequestCtx, v any) error {
+	text, err := json.Marshal(v)
+	if err != nil {
+		return err
+	}
+	_, err = ctx.Write(text)
+	return err
+}
+
 func (t *TaskTree) PushTask(ctx *fasthttp.RequestCtx) error {
 	body := ctx.Request.Body()
 	config := &TaskConfig{}
@@ -15,15 +39,64 @@ func (t *TaskTree) PushTask(ctx *fasthttp.RequestCtx) error {
 		return err
 	}
 
-	tas := NewTask(t, config)
+	return t.Push(config)
+}
+
+func (t *TaskTree) ListTask(ctx *fasthttp.RequestCtx) error {
+	return t.reply(ctx, t.List())
+}
+
+// CancelTask exec_id 取消正在执行的任务 id 删除定时任务
+func (t *TaskTree) CancelTask(ctx *fasthttp.RequestCtx) error {
+	q, err := t.query(ctx)
+	if err != nil {
+		return err
+	}
+
+	canceled := false
+	if q.ID != 0 {
+		canceled = t.Unschedule(q.ID)
+	}
 
-	if e := tas.do(); e != nil {
-		return e
+	if q.ExecID != 0 {
+		canceled = t.Cancel(q.ExecID) || canceled
 	}
 
-	return nil
+	if !canceled {
+		return fmt.Errorf("not found task id=%d exec_id=%d", q.ID, q.ExecID)
+	}
+	return t.reply(ctx, t.List())
+}
+
+func (t *TaskTree) RerunTask(ctx *fasthttp.RequestCtx) error {
+	q, err := t.query(ctx)
+	if err != nil {
+		return err
+	}
+
+	if err = t.Rerun(q.ID); err != nil {
+		return err
+	}
+	return t.reply(ctx, t.List())
+}
+
+func (t *TaskTree) HistoryTask(ctx *fasthttp.RequestCtx) error {
+	q, err := t.query(ctx)
+	if err != nil {
+		return err
+	}
+
+	ret, err := t.History(q.ID)
+	if err != nil {
+		return err
+	}
+	return t.reply(ctx, ret)
 }
 
 func (t *TaskTree) Define(route layer.RouterType) {
 	_ = route.POST("/api/v1/agent/task/push", route.Then(t.PushTask))
+	_ = route.POST("/api/v1/agent/task/list", route.Then(t.ListTask))
+	_ = route.POST("/api/v1/agent/task/cancel", route.Then(t.CancelTask))
+	_ = route.POST("/api/v1/agent/task/rerun", route.Then(t.RerunTask))
+	_ = route.POST("/api/v1/agent/task/history", route.Then(t.HistoryTask))
 }
@@ -1,7 +1,9 @@
 package treekit
 
 import (
+	"github.com/vela-public/onekit/lua"
 	"github.com/vela-public/onekit/pipe"
+	"go.etcd.io/bbolt"
 )
 
 type TaskTreeOption struct {
@@ -9,12 +11,18 @@ type TaskTreeOption struct {
 	error   *pipe.Chain
 	panic   *pipe.Chain
 	report  *pipe.Chain
+	keyring *KeyRing
+	history *History
+	quota   *Quotas
+	retain  int
 	protect bool
 }
 
 func NewTaskTreeOption() *TaskTreeOption {
 	return &TaskTreeOption{
 		protect: false,
+		retain:  256,
+		quota:   NewQuotas(),
 		create:  pipe.NewChain(),
 		error:   pipe.NewChain(),
 		panic:   pipe.NewChain(),
@@ -26,6 +34,28 @@ func (tt *TaskTreeOption) Protect(flag bool) {
 	tt.protect = flag
 }
 
+// KeyRing 配置后任务必须携带有效的签名
+func (tt *TaskTreeOption) KeyRing(kr *KeyRing) {
+	tt.keyring = kr
+}
+
+// History 保存每个任务最近 size 次的执行结果
+func (tt *TaskTreeOption) History(db *bbolt.DB, size int) {
+	tt.history = NewHistory(db, size)
+}
+
+// Retain Rerun 保留最近下发的 n 个任务配置 默认 256
+func (tt *TaskTreeOption) Retain(n int) {
+	if n > 0 {
+		tt.retain = n
+	}
+}
+
+// Quota 任务虚拟机的资源限制 keys 为任务名称 为空时对所有任务生效
+func (tt *TaskTreeOption) Quota(q lua.Quota, keys ...string) {
+	tt.quota.Set(q, keys...)
+}
+
 func (tt *TaskTreeOption) Error(fn func(error)) {
 	tt.error.NewHandler(func(v any) {
 		if err, ok := v.(error); ok {
@@ -5,9 +5,12 @@
 package webkit
 
 import (
+	"context"
 	"errors"
 	"net"
 	"net/http"
+	"sync/atomic"
+	"time"
 
 	"github.com/valyala/fasthttp"
 )
@@ -24,6 +27,15 @@ type ReverseProxy struct {
 	// clients
 	clients []*fasthttp.HostClient
 
+	// peers keeps health state of clients with the same index
+	peers []*peer
+
+	// hashKey extracts the request key if the balancer is an IPicker
+	hashKey HashKey
+
+	// cancel stops active health checking
+	cancel context.CancelFunc
+
 	// opt contains finally option to open reverseProxy
 	opt     *buildOption
 	OnError func(req *fasthttp.Request, res *fasthttp.Response, err error)
@@ -45,6 +57,7 @@ func NewReverseProxyWith(options ...Option) (*ReverseProxy, error) {
 	if err := proxy.init(); err != nil {
 		return nil, err
 	}
+	proxy.health()
 
 	return proxy, nil
 }
@@ -60,7 +73,19 @@ func (p *ReverseProxy) init() error {
 	if p.opt.openBalance {
 		// config balancer
 		p.clients = make([]*fasthttp.HostClient, 0, len(p.opt.addresses))
-		p.bla = NewBalancer(p.opt.weights)
+		bla, err := newStrategyBalancer(p.opt.strategy, p.opt.addresses, p.opt.weights, p.load)
+		if err != nil {
+			return err
+		}
+		p.bla = bla
+
+		if p.opt.strategy == BalanceHash {
+			key, err := NewHashKey(p.opt.hashKey)
+			if err != nil {
+				return err
+			}
+			p.hashKey = key
+		}
 
 		for _, addr := range p.opt.addresses {
 			client := &fasthttp.HostClient{
@@ -69,6 +94,8 @@ func (p *ReverseProxy) init() error {
 				IsTLS:                  p.opt.tlsConfig != nil,
 				TLSConfig:              p.opt.tlsConfig,
 				DisablePathNormalizing: p.opt.disablePathNormalizing,
+				StreamResponseBody:     p.opt.stream,
+				Dial:                   p.dial(),
 			}
 			p.clients = append(p.clients, client)
 		}
@@ -86,24 +113,140 @@ func (p *ReverseProxy) init() error {
 		TLSConfig:              p.opt.tlsConfig,
 		DisablePathNormalizing: p.opt.disablePathNormalizing,
 		MaxConnDuration:        p.opt.maxConnDuration,
+		StreamResponseBody:     p.opt.stream,
+		Dial:                   p.dial(),
 	}
 	p.clients = append(p.clients, client)
 	return nil
 }
 
-func (p *ReverseProxy) getClient() *fasthttp.HostClient {
+// health creates peers for clients and starts active health checking if configured.
+func (p *ReverseProxy) health() {
+	p.peers = make([]*peer, len(p.clients))
+	for idx, c := range p.clients {
+		p.peers[idx] = &peer{client: c}
+	}
+
+	hc := p.opt.health
+	if !hc.enable() {
+		return
+	}
+	hc.defaults()
+
+	ctx, cancel := context.WithCancel(context.Background())
+	p.cancel = cancel
+	go p.watch(ctx, p.peers, hc)
+}
+
+// load returns in-flight requests of the client with the idx.
+func (p *ReverseProxy) load(idx int) int64 {
+	if idx >= len(p.peers) {
+		return 0
+	}
+	return p.peers[idx].load()
+}
+
+// getClient returns the next healthy client which has not been tried,
+// if all upstream servers are unhealthy the first attempt still goes to the balancer's choice.
+func (p *ReverseProxy) getClient(key []byte, tried []int) (int, *fasthttp.HostClient) {
 	if p.clients == nil {
 		// closed
 		panic("ReverseProxy has been closed")
 	}
 
-	if p.bla != nil {
-		// bla has been opened
+	if p.bla == nil {
+		if len(tried) > 0 {
+			return -1, nil
+		}
+		return 0, p.clients[0]
+	}
+
+	now := time.Now()
+	has := func(idx int) bool {
+		for _, v := range tried {
+			if v == idx {
+				return true
+			}
+		}
+		return false
+	}
+
+	if picker, ok := p.bla.(IPicker); ok {
+		idx := picker.Pick(key, func(idx int) bool {
+			return has(idx) || !p.peers[idx].available(now)
+		})
+		if idx < 0 && len(tried) == 0 {
+			idx = picker.Pick(key, func(int) bool { return false })
+		}
+
+		if idx < 0 {
+			return -1, nil
+		}
+		return idx, p.clients[idx]
+	}
+
+	// bla has been opened
+	for i := 0; i < len(p.clients); i++ {
 		idx := p.bla.Distribute()
-		return p.clients[idx]
+		if !has(idx) && p.peers[idx].available(now) {
+			return idx, p.clients[idx]
+		}
 	}
 
-	return p.clients[0]
+	for idx := range p.clients {
+		if !has(idx) && p.peers[idx].available(now) {
+			return idx, p.clients[idx]
+		}
+	}
+
+	if len(tried) == 0 {
+		idx := p.bla.Distribute()
+		return idx, p.clients[idx]
+	}
+	return -1, nil
+}
+
+// do sends the request to the upstream servers,
+// idempotent requests are retried on the next healthy upstream server.
+func (p *ReverseProxy) do(key []byte, req *fasthttp.Request, res *fasthttp.Response) error {
+	attempts := 1
+	// a streamed request body can not be sent twice
+	if idempotent(req.Header.Method()) && !req.IsBodyStream() {
+		attempts += p.opt.retry
+	}
+
+	var tried []int
+	err := errNoHealthyUpstream
+	for i := 0; i < attempts; i++ {
+		idx, c := p.getClient(key, tried)
+		if c == nil {
+			break
+		}
+		tried = append(tried, idx)
+
+		if i > 0 {
+			res.Reset()
+		}
+
+		// assign the host to support virtual hosting, aka shared web hosting (one IP, multiple domains)
+		req.SetHost(c.Addr)
+
+		// execute the request and rev response with timeout
+		pr := p.peers[idx]
+		if p.opt.stream {
+			err = p.doStream(pr, c, req, res)
+		} else {
+			atomic.AddInt64(&pr.active, 1)
+			err = p.doWithTimeout(c, req, res)
+			atomic.AddInt64(&pr.active, -1)
+		}
+		if err == nil {
+			pr.success()
+			return nil
+		}
+		pr.failure(err, p.opt.outlier)
+	}
+	return err
 }
 
 // ServeHTTP ReverseProxy to serve
@@ -117,6 +260,16 @@ func (p *ReverseProxy) ServeHTTP(ctx *fasthttp.RequestCtx) {
 		req.Header.Add("X-Forwarded-For", ip)
 	}
 
+	var key []byte
+	if p.hashKey != nil {
+		key = p.hashKey(ctx)
+	}
+
+	if isWebSocket(ctx) {
+		p.serveWebSocket(ctx, key)
+		return
+	}
+
 	// to save all response header
 	// resHeaders := make(map[string]string)
 	// res.Header.VisitAll(func(k, v []byte) {
@@ -135,22 +288,8 @@ func (p *ReverseProxy) ServeHTTP(ctx *fasthttp.RequestCtx) {
 		req.Header.Del(h)
 	}
 
-	c := p.getClient()
-
-	// assign the host to support virtual hosting, aka shared web hosting (one IP, multiple domains)
-	req.SetHost(c.Addr)
-
-	// execute the request and rev response with timeout
-	if err := p.doWithTimeout(c, req, res); err != nil {
-		res.SetStatusCode(http.StatusInternalServerError)
-		if errors.Is(err, fasthttp.ErrTimeout) {
-			res.SetStatusCode(http.StatusRequestTimeout)
-		}
-		if p.OnError != nil {
-			p.OnError(req, res, err)
-			return
-		}
-		res.SetBody([]byte(err.Error()))
+	if err := p.do(key, req, res); err != nil {
+		p.fail(ctx, err)
 		return
 	}
 
@@ -161,6 +300,22 @@ func (p *ReverseProxy) ServeHTTP(ctx *fasthttp.RequestCtx) {
 	}
 }
 
+// fail writes the error response
+func (p *ReverseProxy) fail(ctx *fasthttp.RequestCtx, err error) {
+	req := &ctx.Request
+	res := &ctx.Response
+
+	res.SetStatusCode(http.StatusInternalServerError)
+	if errors.Is(err, fasthttp.ErrTimeout) {
+		res.SetStatusCode(http.StatusRequestTimeout)
+	}
+	if p.OnError != nil {
+		p.OnError(req, res, err)
+		return
+	}
+	res.SetBody([]byte(err.Error()))
+}
+
 // doWithTimeout calls fasthttp.HostClient use or DoTimeout, this is depends on p.opt.timeout
 func (p *ReverseProxy) doWithTimeout(pc *fasthttp.HostClient, req *fasthttp.Request, res *fasthttp.Response) error {
 	if p.opt.timeout <= 0 {
@@ -187,7 +342,11 @@ func (p *ReverseProxy) Reset() {
 
 // Close ... clear and release
 func (p *ReverseProxy) Close() {
+	if p.cancel != nil {
+		p.cancel()
+	}
 	p.clients = nil
+	p.peers = nil
 	p.opt = nil
 	p.bla = nil
 	p = nil
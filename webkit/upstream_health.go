@@ -0,0 +1,254 @@
+package webkit
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/valyala/fasthttp"
+)
+
+var errNoHealthyUpstream = errors.New("no healthy upstream server")
+
+const (
+	HealthHTTP = "http"
+	HealthTCP  = "tcp"
+)
+
+// HealthCheck configures active health checking of every upstream address,
+// an empty Type disables it. Interval and Timeout are in milliseconds.
+type HealthCheck struct {
+	Type     string `lua:"type"`
+	Path     string `lua:"path"`
+	Expect   []int  `lua:"expect"` // accepted status codes, 2xx and 3xx if empty
+	Interval int    `lua:"interval"`
+	Timeout  int    `lua:"timeout"`
+	Rise     int    `lua:"rise"` // consecutive successes to mark a down peer up
+	Fall     int    `lua:"fall"` // consecutive failures to mark an up peer down
+}
+
+func (hc *HealthCheck) enable() bool {
+	return hc.Type == HealthHTTP || hc.Type == HealthTCP
+}
+
+func (hc *HealthCheck) defaults() {
+	if hc.Path == "" {
+		hc.Path = "/"
+	}
+	if hc.Interval <= 0 {
+		hc.Interval = 5000
+	}
+	if hc.Timeout <= 0 {
+		hc.Timeout = 2000
+	}
+	if hc.Rise <= 0 {
+		hc.Rise = 2
+	}
+	if hc.Fall <= 0 {
+		hc.Fall = 3
+	}
+}
+
+func (hc *HealthCheck) expect(code int) bool {
+	if len(hc.Expect) == 0 {
+		return code >= 200 && code < 400
+	}
+
+	for _, v := range hc.Expect {
+		if v == code {
+			return true
+		}
+	}
+	return false
+}
+
+// Outlier configures passive ejection, a peer is ejected for Eject milliseconds (30s as default)
+// after Errors consecutive errors or timeouts. Errors <= 0 disables it.
+type Outlier struct {
+	Errors int `lua:"errors"`
+	Eject  int `lua:"eject"`
+}
+
+// PeerStatus is a snapshot of the health of one upstream address.
+type PeerStatus struct {
+	Addr    string    `json:"addr"`
+	Healthy bool      `json:"healthy"`
+	Ejected bool      `json:"ejected"`
+	Errors  int       `json:"errors"`
+	Reason  string    `json:"reason"`
+	Checked time.Time `json:"checked"`
+}
+
+// peer keeps the health state of one HostClient.
+type peer struct {
+	mutex   sync.Mutex
+	client  *fasthttp.HostClient
+	active  int64     // in-flight requests
+	down    bool      // marked by active health check
+	rise    int       // consecutive active successes
+	fall    int       // consecutive active failures
+	errs    int       // consecutive passive errors
+	until   time.Time // ejected until
+	reason  string
+	checked time.Time
+}
+
+func (pr *peer) available(now time.Time) bool {
+	pr.mutex.Lock()
+	defer pr.mutex.Unlock()
+	return !pr.down && !now.Before(pr.until)
+}
+
+func (pr *peer) load() int64 {
+	return atomic.LoadInt64(&pr.active)
+}
+
+// success resets the passive error counter.
+func (pr *peer) success() {
+	pr.mutex.Lock()
+	defer pr.mutex.Unlock()
+	pr.errs = 0
+}
+
+// failure counts a passive error and ejects the peer when reaching the threshold.
+func (pr *peer) failure(err error, o Outlier) {
+	pr.mutex.Lock()
+	defer pr.mutex.Unlock()
+
+	pr.errs++
+	pr.reason = err.Error()
+	if o.Errors <= 0 || pr.errs < o.Errors {
+		return
+	}
+
+	eject := o.Eject
+	if eject <= 0 {
+		eject = 30000
+	}
+
+	pr.errs = 0
+	pr.until = time.Now().Add(time.Duration(eject) * time.Millisecond)
+}
+
+// report records the result of an active health check.
+func (pr *peer) report(err error, hc *HealthCheck) {
+	pr.mutex.Lock()
+	defer pr.mutex.Unlock()
+
+	pr.checked = time.Now()
+	if err != nil {
+		pr.rise = 0
+		pr.fall++
+		pr.reason = err.Error()
+		if pr.fall >= hc.Fall {
+			pr.down = true
+		}
+		return
+	}
+
+	pr.fall = 0
+	pr.rise++
+	if pr.down && pr.rise >= hc.Rise {
+		pr.down = false
+		pr.until = time.Time{}
+		pr.reason = ""
+	}
+}
+
+func (pr *peer) status(now time.Time) PeerStatus {
+	pr.mutex.Lock()
+	defer pr.mutex.Unlock()
+
+	ejected := now.Before(pr.until)
+	return PeerStatus{
+		Addr:    pr.client.Addr,
+		Healthy: !pr.down && !ejected,
+		Ejected: ejected,
+		Errors:  pr.errs,
+		Reason:  pr.reason,
+		Checked: pr.checked,
+	}
+}
+
+// probe does one active health check against the peer.
+func (pr *peer) probe(hc *HealthCheck) error {
+	timeout := time.Duration(hc.Timeout) * time.Millisecond
+	if hc.Type == HealthTCP {
+		conn, err := net.DialTimeout("tcp", pr.client.Addr, timeout)
+		if err != nil {
+			return err
+		}
+		return conn.Close()
+	}
+
+	req := fasthttp.AcquireRequest()
+	res := fasthttp.AcquireResponse()
+	defer func() {
+		fasthttp.ReleaseRequest(req)
+		fasthttp.ReleaseResponse(res)
+	}()
+
+	req.SetRequestURI(hc.Path)
+	req.SetHost(pr.client.Addr)
+	req.Header.SetMethod(fasthttp.MethodGet)
+	if err := pr.client.DoTimeout(req, res, timeout); err != nil {
+		return err
+	}
+
+	if code := res.StatusCode(); !hc.expect(code) {
+		return fmt.Errorf("health check %s unexpected status %d", hc.Path, code)
+	}
+	return nil
+}
+
+// watch runs active health checks until the proxy is closed.
+func (p *ReverseProxy) watch(ctx context.Context, peers []*peer, hc HealthCheck) {
+	tk := time.NewTicker(time.Duration(hc.Interval) * time.Millisecond)
+	defer tk.Stop()
+
+	check := func() {
+		var wg sync.WaitGroup
+		for _, pr := range peers {
+			wg.Add(1)
+			go func(pr *peer) {
+				defer wg.Done()
+				pr.report(pr.probe(&hc), &hc)
+			}(pr)
+		}
+		wg.Wait()
+	}
+
+	check()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-tk.C:
+			check()
+		}
+	}
+}
+
+// Health returns the health of every upstream address.
+func (p *ReverseProxy) Health() []PeerStatus {
+	now := time.Now()
+	ret := make([]PeerStatus, 0, len(p.peers))
+	for _, pr := range p.peers {
+		ret = append(ret, pr.status(now))
+	}
+	return ret
+}
+
+// idempotent requests can be retried on the next backend safely.
+func idempotent(method []byte) bool {
+	switch string(method) {
+	case fasthttp.MethodGet, fasthttp.MethodHead, fasthttp.MethodOptions,
+		fasthttp.MethodPut, fasthttp.MethodDelete, fasthttp.MethodTrace:
+		return true
+	}
+	return false
+}
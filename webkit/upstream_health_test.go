@@ -0,0 +1,237 @@
+package webkit
+
+import (
+	"errors"
+	"net"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/valyala/fasthttp"
+)
+
+// backend serves the name of the upstream server and counts requests.
+func backend(t *testing.T, name string, hits *int64) string {
+	t.Helper()
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	srv := &fasthttp.Server{Handler: func(ctx *fasthttp.RequestCtx) {
+		atomic.AddInt64(hits, 1)
+		ctx.SetBodyString(name)
+	}}
+	go func() { _ = srv.Serve(ln) }()
+	t.Cleanup(func() { _ = srv.Shutdown() })
+	return ln.Addr().String()
+}
+
+// refused returns an address nobody listens on.
+func refused(t *testing.T) string {
+	t.Helper()
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	addr := ln.Addr().String()
+	_ = ln.Close()
+	return addr
+}
+
+func newTestProxy(t *testing.T, peers map[string]Weight, options ...Option) *ReverseProxy {
+	t.Helper()
+	p, err := NewReverseProxyWith(append([]Option{WithBalancer(peers), WithTimeout(time.Second)}, options...)...)
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(p.Close)
+	return p
+}
+
+func send(p *ReverseProxy, method string) (string, error) {
+	req := fasthttp.AcquireRequest()
+	res := fasthttp.AcquireResponse()
+	defer func() {
+		fasthttp.ReleaseRequest(req)
+		fasthttp.ReleaseResponse(res)
+	}()
+
+	req.SetRequestURI("/")
+	req.Header.SetMethod(method)
+	if err := p.do(nil, req, res); err != nil {
+		return "", err
+	}
+	return string(res.Body()), nil
+}
+
+func status(p *ReverseProxy, addr string) PeerStatus {
+	for _, st := range p.Health() {
+		if st.Addr == addr {
+			return st
+		}
+	}
+	return PeerStatus{}
+}
+
+func TestUpstreamDefault(t *testing.T) {
+	var hits int64
+	good := backend(t, "good", &hits)
+	bad := refused(t)
+	p := newTestProxy(t, map[string]Weight{good: 1, bad: 1})
+
+	var fails int
+	for i := 0; i < 10; i++ {
+		if _, err := send(p, fasthttp.MethodGet); err != nil {
+			fails++
+		}
+	}
+
+	// no retry and no ejection as default, half of the requests go to the dead server
+	if fails != 5 || hits != 5 {
+		t.Fatalf("fails %d hits %d want 5 and 5", fails, hits)
+	}
+
+	if st := status(p, bad); st.Ejected || st.Errors != 5 {
+		t.Fatalf("bad server %+v", st)
+	}
+}
+
+func TestUpstreamRetry(t *testing.T) {
+	var hits int64
+	good := backend(t, "good", &hits)
+	bad := refused(t)
+	p := newTestProxy(t, map[string]Weight{good: 1, bad: 1}, WithRetry(1))
+
+	for i := 0; i < 10; i++ {
+		body, err := send(p, fasthttp.MethodGet)
+		if err != nil || body != "good" {
+			t.Fatalf("get %d body %q err %v", i, body, err)
+		}
+	}
+
+	// non idempotent requests are never retried
+	var fails int
+	for i := 0; i < 10; i++ {
+		if _, err := send(p, fasthttp.MethodPost); err != nil {
+			fails++
+		}
+	}
+	if fails != 5 {
+		t.Fatalf("post fails %d want 5", fails)
+	}
+}
+
+func TestUpstreamEject(t *testing.T) {
+	var hits int64
+	good := backend(t, "good", &hits)
+	bad := refused(t)
+	p := newTestProxy(t, map[string]Weight{good: 1, bad: 1}, WithOutlier(2, 200*time.Millisecond))
+
+	var fails int
+	for i := 0; i < 10; i++ {
+		if _, err := send(p, fasthttp.MethodPost); err != nil {
+			fails++
+		}
+	}
+
+	// ejected after two consecutive errors
+	if fails != 2 {
+		t.Fatalf("fails %d want 2", fails)
+	}
+
+	st := status(p, bad)
+	if !st.Ejected || st.Healthy || st.Reason == "" {
+		t.Fatalf("bad server not ejected %+v", st)
+	}
+
+	time.Sleep(250 * time.Millisecond)
+	if st = status(p, bad); st.Ejected || !st.Healthy {
+		t.Fatalf("bad server not back after eject %+v", st)
+	}
+
+	// every upstream server is ejected, the request still goes to the balancer's choice
+	p = newTestProxy(t, map[string]Weight{bad: 1}, WithOutlier(1, time.Minute))
+	for i := 0; i < 2; i++ {
+		if _, err := send(p, fasthttp.MethodGet); err == nil || errors.Is(err, errNoHealthyUpstream) {
+			t.Fatalf("want dial error got %v", err)
+		}
+	}
+}
+
+func TestPeerRiseFall(t *testing.T) {
+	hc := HealthCheck{Type: HealthTCP}
+	hc.defaults()
+	pr := &peer{client: &fasthttp.HostClient{Addr: "127.0.0.1:1"}}
+	fail := errors.New("connection refused")
+
+	step := []struct {
+		err  error
+		down bool
+	}{
+		{fail, false},
+		{fail, false},
+		{nil, false}, // a success resets the fall counter
+		{fail, false},
+		{fail, false},
+		{fail, true}, // fall 3
+		{nil, true},
+		{fail, true}, // a failure resets the rise counter
+		{nil, true},
+		{nil, false}, // rise 2
+	}
+
+	for i, s := range step {
+		pr.report(s.err, &hc)
+		if st := pr.status(time.Now()); st.Healthy == s.down {
+			t.Fatalf("step %d healthy %v want %v", i, st.Healthy, !s.down)
+		}
+	}
+}
+
+func TestHealthCheckActive(t *testing.T) {
+	var hits int64
+	good := backend(t, "good", &hits)
+	bad := refused(t)
+	p := newTestProxy(t, map[string]Weight{good: 1, bad: 1},
+		WithHealthCheck(HealthCheck{Type: HealthHTTP, Interval: 10, Timeout: 100, Fall: 1}))
+
+	deadline := time.Now().Add(2 * time.Second)
+	for status(p, bad).Healthy {
+		if time.Now().After(deadline) {
+			t.Fatalf("bad server still healthy %+v", status(p, bad))
+		}
+		time.Sleep(5 * time.Millisecond)
+	}
+
+	if st := status(p, good); !st.Healthy || st.Checked.IsZero() {
+		t.Fatalf("good server %+v", st)
+	}
+
+	for i := 0; i < 10; i++ {
+		body, err := send(p, fasthttp.MethodPost)
+		if err != nil || body != "good" {
+			t.Fatalf("post %d body %q err %v", i, body, err)
+		}
+	}
+}
+
+func TestUpstreamConfigOptions(t *testing.T) {
+	cfg := &UpstreamConfig{Peers: map[string]Weight{"127.0.0.1:1": 1}}
+	option := defaultBuildOption()
+	for _, fn := range cfg.options() {
+		fn.apply(option)
+	}
+	if option.retry != 0 || option.outlier.Errors != 0 {
+		t.Fatalf("default retry %d outlier %+v", option.retry, option.outlier)
+	}
+
+	cfg.Retry = 2
+	cfg.Outlier = Outlier{Errors: 3, Eject: 100}
+	for _, fn := range cfg.options() {
+		fn.apply(option)
+	}
+	if option.retry != 2 || option.outlier != cfg.Outlier {
+		t.Fatalf("retry %d outlier %+v", option.retry, option.outlier)
+	}
+}
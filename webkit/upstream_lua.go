@@ -7,11 +7,47 @@ import (
 	"github.com/vela-public/onekit/treekit"
 	"reflect"
 	"strings"
+	"time"
 )
 
 type UpstreamConfig struct {
-	Name  string            `lua:"name"`
-	Peers map[string]Weight `lua:"peers"`
+	Name    string            `lua:"name"`
+	Peers   map[string]Weight `lua:"peers"`
+	Check   HealthCheck       `lua:"check"`
+	Outlier Outlier           `lua:"outlier"`
+	Retry   int               `lua:"retry"`
+	Balance string            `lua:"balance"`  // round_robin least_conn random_two hash
+	HashKey string            `lua:"hash_key"` // ip header:<name> cookie:<name>
+	Stream  bool              `lua:"stream"`
+	Idle    int               `lua:"idle"` // idle timeout of streamed bodies and websocket in milliseconds
+}
+
+func (cfg *UpstreamConfig) options() []Option {
+	options := []Option{WithBalancer(cfg.Peers), WithHealthCheck(cfg.Check)}
+	if cfg.Outlier.Errors > 0 {
+		options = append(options, WithOutlier(cfg.Outlier.Errors, time.Duration(cfg.Outlier.Eject)*time.Millisecond))
+	}
+
+	if cfg.Retry > 0 {
+		options = append(options, WithRetry(cfg.Retry))
+	}
+
+	if cfg.Balance != "" {
+		options = append(options, WithStrategy(cfg.Balance))
+	}
+
+	if cfg.HashKey != "" {
+		options = append(options, WithHashKey(cfg.HashKey))
+	}
+
+	if cfg.Stream {
+		options = append(options, WithStream(true))
+	}
+
+	if cfg.Idle > 0 {
+		options = append(options, WithIdleTimeout(time.Duration(cfg.Idle)*time.Millisecond))
+	}
+	return options
 }
 
 type Upstream struct {
@@ -24,9 +60,16 @@ func (u *Upstream) Metadata() libkit.DataKV[string, any] {
 }
 func (u *Upstream) Name() string   { return u.config.Name }
 func (u *Upstream) TypeOf() string { return reflect.TypeOf(u).String() }
-func (u *Upstream) Close() error   { return nil }
+func (u *Upstream) Close() error {
+	if u.srv != nil {
+		u.srv.Close()
+		u.srv = nil
+	}
+	return nil
+}
+
 func (u *Upstream) Start() error {
-	srv, err := NewReverseProxyWith(WithBalancer(u.config.Peers))
+	srv, err := NewReverseProxyWith(u.config.options()...)
 	if err != nil {
 		return err
 	}
@@ -70,12 +113,39 @@ func (u *Upstream) OnErrorL(L *lua.LState) int {
 	return 0
 }
 
+// healthL returns health of every upstream server
+// {{addr = "127.0.0.1:80", healthy = true, ejected = false, errors = 0, reason = "", checked = 0}}
+func (u *Upstream) healthL(L *lua.LState) int {
+	tab := L.CreateTable(len(u.config.Peers), 0)
+	if u.srv == nil {
+		L.Push(tab)
+		return 1
+	}
+
+	for _, st := range u.srv.Health() {
+		item := L.CreateTable(0, 6)
+		item.RawSetString("addr", lua.S2L(st.Addr))
+		item.RawSetString("healthy", lua.LBool(st.Healthy))
+		item.RawSetString("ejected", lua.LBool(st.Ejected))
+		item.RawSetString("errors", lua.LInt(st.Errors))
+		item.RawSetString("reason", lua.S2L(st.Reason))
+		if !st.Checked.IsZero() {
+			item.RawSetString("checked", lua.LInt64(st.Checked.Unix()))
+		}
+		tab.Append(item)
+	}
+	L.Push(tab)
+	return 1
+}
+
 func (u *Upstream) Index(L *lua.LState, key string) lua.LValue {
 	switch key {
 	case "run":
 		return lua.NewFunction(u.runL)
 	case "vague":
 		return lua.NewFunction(u.OnErrorL)
+	case "health":
+		return lua.NewFunction(u.healthL)
 	}
 	return lua.LNil
 }
@@ -37,6 +37,28 @@ type buildOption struct {
 
 	// maxConnDuration of hostClient
 	maxConnDuration time.Duration
+
+	// health configures active health checking, disabled as default.
+	health HealthCheck
+
+	// outlier configures passive ejection of upstream servers, disabled as default.
+	outlier Outlier
+
+	// retry times of idempotent requests on the next healthy upstream server, disabled as default.
+	retry int
+
+	// strategy of the balancer, round robin as default.
+	strategy string
+
+	// hashKey is the source of the request key used by consistent hashing, client ip as default.
+	hashKey string
+
+	// stream response bodies instead of buffering them, request bodies are streamed
+	// if fasthttp.Server.StreamRequestBody is enabled.
+	stream bool
+
+	// idle timeout of streamed bodies and websocket connections, disabled as default.
+	idle time.Duration
 }
 
 func defaultBuildOption() *buildOption {
@@ -128,3 +150,61 @@ func WithMaxConnDuration(d time.Duration) Option {
 		o.maxConnDuration = d
 	})
 }
+
+// WithHealthCheck enables active HTTP or TCP health checking of every upstream server.
+func WithHealthCheck(hc HealthCheck) Option {
+	return newFuncBuildOption(func(o *buildOption) {
+		o.health = hc
+	})
+}
+
+// WithOutlier ejects an upstream server after consecutive errors or timeouts,
+// errors <= 0 disables ejection.
+func WithOutlier(errors int, eject time.Duration) Option {
+	return newFuncBuildOption(func(o *buildOption) {
+		o.outlier = Outlier{Errors: errors, Eject: int(eject.Milliseconds())}
+	})
+}
+
+// WithRetry sets retry times of idempotent requests, n <= 0 disables retrying.
+func WithRetry(n int) Option {
+	return newFuncBuildOption(func(o *buildOption) {
+		if n < 0 {
+			n = 0
+		}
+		o.retry = n
+	})
+}
+
+// WithStrategy sets the strategy of the balancer, one of round_robin (default),
+// least_conn, random_two and hash.
+func WithStrategy(strategy string) Option {
+	return newFuncBuildOption(func(o *buildOption) {
+		o.strategy = strategy
+	})
+}
+
+// WithHashKey enables consistent hashing on the request key for sticky sessions,
+// source is one of "ip", "header:<name>" and "cookie:<name>".
+func WithHashKey(source string) Option {
+	return newFuncBuildOption(func(o *buildOption) {
+		o.strategy = BalanceHash
+		o.hashKey = source
+	})
+}
+
+// WithStream streams response bodies of upstream servers to the client,
+// large downloads and server-sent events are not buffered in memory.
+func WithStream(stream bool) Option {
+	return newFuncBuildOption(func(o *buildOption) {
+		o.stream = stream
+	})
+}
+
+// WithIdleTimeout closes streamed bodies and websocket connections which
+// transfer no data within d.
+func WithIdleTimeout(d time.Duration) Option {
+	return newFuncBuildOption(func(o *buildOption) {
+		o.idle = d
+	})
+}
@@ -0,0 +1,241 @@
+package webkit
+
+import (
+	"bytes"
+	"fmt"
+	"hash/crc32"
+	"math/rand"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"sync/atomic"
+
+	"github.com/valyala/fasthttp"
+)
+
+const (
+	BalanceRoundRobin = "round_robin"
+	BalanceLeastConn  = "least_conn"
+	BalanceRandomTwo  = "random_two"
+	BalanceHash       = "hash"
+)
+
+// virtual nodes of each weight on the hash ring
+const _hashReplicas = 160
+
+// IPicker is implemented by balancers which choose an upstream server by the request key
+// or the state of upstream servers. skip reports whether the idx is unavailable or has been tried,
+// it returns -1 if all upstream servers are skipped.
+type IPicker interface {
+	IBalancer
+	Pick(key []byte, skip func(idx int) bool) int
+}
+
+// loadFunc returns in-flight requests of the upstream server with the idx.
+type loadFunc func(idx int) int64
+
+func weightOf(w W) int64 {
+	if n := w.Weight(); n > 0 {
+		return int64(n)
+	}
+	return 1
+}
+
+// lighter reports whether the upstream server a has less load per weight than b.
+func lighter(load loadFunc, ws []W, a, b int) bool {
+	return load(a)*weightOf(ws[b]) < load(b)*weightOf(ws[a])
+}
+
+// leastConnBalancer chooses the upstream server with the least in-flight requests per weight,
+// ties are broken by rotating the start index.
+type leastConnBalancer struct {
+	weights []W
+	load    loadFunc
+	next    uint32
+}
+
+func (lb *leastConnBalancer) Distribute() int {
+	return lb.Pick(nil, func(int) bool { return false })
+}
+
+func (lb *leastConnBalancer) Pick(_ []byte, skip func(idx int) bool) int {
+	n := len(lb.weights)
+	start := int(atomic.AddUint32(&lb.next, 1) % uint32(n))
+
+	choice := -1
+	for i := 0; i < n; i++ {
+		idx := (start + i) % n
+		if skip(idx) {
+			continue
+		}
+
+		if choice == -1 || lighter(lb.load, lb.weights, idx, choice) {
+			choice = idx
+		}
+	}
+	return choice
+}
+
+// randomTwoBalancer picks two random upstream servers and chooses the lighter one.
+type randomTwoBalancer struct {
+	mutex   sync.Mutex
+	rnd     *rand.Rand
+	weights []W
+	load    loadFunc
+}
+
+func (rb *randomTwoBalancer) Distribute() int {
+	return rb.Pick(nil, func(int) bool { return false })
+}
+
+func (rb *randomTwoBalancer) Pick(_ []byte, skip func(idx int) bool) int {
+	candidates := make([]int, 0, len(rb.weights))
+	for idx := range rb.weights {
+		if !skip(idx) {
+			candidates = append(candidates, idx)
+		}
+	}
+
+	switch len(candidates) {
+	case 0:
+		return -1
+	case 1:
+		return candidates[0]
+	}
+
+	rb.mutex.Lock()
+	i := rb.rnd.Intn(len(candidates))
+	j := rb.rnd.Intn(len(candidates) - 1)
+	rb.mutex.Unlock()
+
+	if j >= i {
+		j++
+	}
+
+	a, b := candidates[i], candidates[j]
+	if lighter(rb.load, rb.weights, b, a) {
+		return b
+	}
+	return a
+}
+
+// hashBalancer maps the request key onto a consistent hash ring. virtual nodes are
+// hashed by the address, so adding or removing an upstream server only moves its own keys,
+// and skipped servers are passed by walking the ring clockwise.
+type hashBalancer struct {
+	ring  []uint32
+	nodes map[uint32]int // ring point => idx
+	size  int
+	rr    IBalancer // used when the request has no key
+}
+
+func (hb *hashBalancer) Distribute() int {
+	return hb.rr.Distribute()
+}
+
+func (hb *hashBalancer) Pick(key []byte, skip func(idx int) bool) int {
+	if len(key) == 0 {
+		for i := 0; i < hb.size; i++ {
+			if idx := hb.rr.Distribute(); !skip(idx) {
+				return idx
+			}
+		}
+		return -1
+	}
+
+	h := ringHash(key)
+	start := sort.Search(len(hb.ring), func(i int) bool { return hb.ring[i] >= h })
+
+	seen := make(map[int]bool, hb.size)
+	for i := 0; i < len(hb.ring) && len(seen) < hb.size; i++ {
+		idx := hb.nodes[hb.ring[(start+i)%len(hb.ring)]]
+		if seen[idx] {
+			continue
+		}
+		seen[idx] = true
+
+		if !skip(idx) {
+			return idx
+		}
+	}
+	return -1
+}
+
+// ringHash spreads similar keys such as "addr#1" and "addr#2" with the murmur3 finalizer.
+func ringHash(data []byte) uint32 {
+	h := crc32.ChecksumIEEE(data)
+	h ^= h >> 16
+	h *= 0x85ebca6b
+	h ^= h >> 13
+	h *= 0xc2b2ae35
+	h ^= h >> 16
+	return h
+}
+
+func newHashBalancer(addresses []string, ws []W) *hashBalancer {
+	hb := &hashBalancer{
+		nodes: make(map[uint32]int),
+		size:  len(addresses),
+		rr:    NewBalancer(ws),
+	}
+
+	for idx, addr := range addresses {
+		n := int(weightOf(ws[idx])) * _hashReplicas
+		for i := 0; i < n; i++ {
+			h := ringHash([]byte(addr + "#" + strconv.Itoa(i)))
+			if _, ok := hb.nodes[h]; ok {
+				continue
+			}
+			hb.nodes[h] = idx
+			hb.ring = append(hb.ring, h)
+		}
+	}
+
+	sort.Slice(hb.ring, func(i, j int) bool { return hb.ring[i] < hb.ring[j] })
+	return hb
+}
+
+// newStrategyBalancer constructs the balancer of the strategy, round robin as default.
+func newStrategyBalancer(strategy string, addresses []string, ws []W, load loadFunc) (IBalancer, error) {
+	switch strategy {
+	case "", BalanceRoundRobin:
+		return NewBalancer(ws), nil
+	case BalanceLeastConn:
+		return &leastConnBalancer{weights: ws, load: load}, nil
+	case BalanceRandomTwo:
+		return &randomTwoBalancer{weights: ws, load: load, rnd: rand.New(rand.NewSource(rand.Int63()))}, nil
+	case BalanceHash:
+		return newHashBalancer(addresses, ws), nil
+	}
+	return nil, fmt.Errorf("invalid balance strategy %s", strategy)
+}
+
+// HashKey extracts the key of consistent hashing from the request,
+// source is one of "ip", "header:<name>" and "cookie:<name>".
+type HashKey func(ctx *fasthttp.RequestCtx) []byte
+
+func NewHashKey(source string) (HashKey, error) {
+	kind, name, _ := strings.Cut(source, ":")
+	switch strings.ToLower(kind) {
+	case "", "ip":
+		return func(ctx *fasthttp.RequestCtx) []byte {
+			return ctx.RemoteIP()
+		}, nil
+	case "header":
+		if name == "" {
+			return nil, fmt.Errorf("invalid hash key %s not found header name", source)
+		}
+		return func(ctx *fasthttp.RequestCtx) []byte {
+			return bytes.TrimSpace(ctx.Request.Header.Peek(name))
+		}, nil
+	case "cookie":
+		if name == "" {
+			return nil, fmt.Errorf("invalid hash key %s not found cookie name", source)
+		}
+		return func(ctx *fasthttp.RequestCtx) []byte {
+			return ctx.Request.Header.Cookie(name)
+		}, nil
+	}
+	return nil, fmt.Errorf("invalid hash key %s", source)
+}
@@ -0,0 +1,119 @@
+package webkit
+
+import (
+	"net"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/valyala/fasthttp"
+)
+
+// idleConn extends the read and write deadline before every io, so a streamed body
+// is only cut off when no data is transferred within idle. the deadline set by
+// fasthttp.HostClient for the whole request is respected unless the body is streamed,
+// a long download or server-sent events must not end at the request timeout.
+type idleConn struct {
+	net.Conn
+	idle   time.Duration
+	stream bool
+	rd     time.Time
+	wd     time.Time
+}
+
+func (c *idleConn) deadline(hard time.Time) time.Time {
+	t := time.Now().Add(c.idle)
+	if !c.stream && !hard.IsZero() && hard.Before(t) {
+		return hard
+	}
+	return t
+}
+
+func (c *idleConn) Read(b []byte) (int, error) {
+	if err := c.Conn.SetReadDeadline(c.deadline(c.rd)); err != nil {
+		return 0, err
+	}
+	return c.Conn.Read(b)
+}
+
+func (c *idleConn) Write(b []byte) (int, error) {
+	if err := c.Conn.SetWriteDeadline(c.deadline(c.wd)); err != nil {
+		return 0, err
+	}
+	return c.Conn.Write(b)
+}
+
+func (c *idleConn) SetDeadline(t time.Time) error {
+	c.rd, c.wd = t, t
+	return c.Conn.SetDeadline(t)
+}
+
+func (c *idleConn) SetReadDeadline(t time.Time) error {
+	c.rd = t
+	return c.Conn.SetReadDeadline(t)
+}
+
+func (c *idleConn) SetWriteDeadline(t time.Time) error {
+	c.wd = t
+	return c.Conn.SetWriteDeadline(t)
+}
+
+// dial returns the DialFunc of HostClient, nil means the default one.
+func (p *ReverseProxy) dial() fasthttp.DialFunc {
+	idle, stream := p.opt.idle, p.opt.stream
+	if idle <= 0 {
+		return nil
+	}
+
+	return func(addr string) (net.Conn, error) {
+		conn, err := fasthttp.Dial(addr)
+		if err != nil {
+			return nil, err
+		}
+		return &idleConn{Conn: conn, idle: idle, stream: stream}, nil
+	}
+}
+
+// streamBody is the streamed body of the upstream response, done is called once
+// when fasthttp closes it after the body is written to the client or the request ends.
+type streamBody struct {
+	res  *fasthttp.Response
+	once sync.Once
+	done func()
+}
+
+func (b *streamBody) Read(p []byte) (int, error) {
+	return b.res.BodyStream().Read(p)
+}
+
+func (b *streamBody) Close() error {
+	var err error
+	b.once.Do(func() {
+		err = b.res.CloseBodyStream()
+		fasthttp.ReleaseResponse(b.res)
+		b.done()
+	})
+	return err
+}
+
+// doStream sends the request with a standalone response, the peer keeps counting the request
+// as in-flight until the streamed body is closed.
+func (p *ReverseProxy) doStream(pr *peer, c *fasthttp.HostClient, req *fasthttp.Request, res *fasthttp.Response) error {
+	done := func() { atomic.AddInt64(&pr.active, -1) }
+	up := fasthttp.AcquireResponse()
+	atomic.AddInt64(&pr.active, 1)
+
+	err := p.doWithTimeout(c, req, up)
+	if err != nil || !up.IsBodyStream() {
+		if err == nil {
+			up.CopyTo(res)
+		}
+		fasthttp.ReleaseResponse(up)
+		done()
+		return err
+	}
+
+	up.Header.CopyTo(&res.Header)
+	res.SetBodyStream(&streamBody{res: up, done: done}, up.Header.ContentLength())
+	return nil
+}
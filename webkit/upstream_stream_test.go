@@ -0,0 +1,200 @@
+package webkit
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/gorilla/websocket"
+	"github.com/valyala/fasthttp"
+)
+
+// slowBackend writes n chunks with the gap, release blocks the last chunk until closed.
+func slowBackend(t *testing.T, n int, gap time.Duration, release chan struct{}) string {
+	t.Helper()
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	srv := &fasthttp.Server{Handler: func(ctx *fasthttp.RequestCtx) {
+		ctx.SetBodyStreamWriter(func(w *bufio.Writer) {
+			for i := 0; i < n; i++ {
+				if i == n-1 && release != nil {
+					<-release
+				}
+				fmt.Fprintf(w, "chunk%d;", i)
+				_ = w.Flush()
+				time.Sleep(gap)
+			}
+		})
+	}}
+	go func() { _ = srv.Serve(ln) }()
+	t.Cleanup(func() { _ = srv.Shutdown() })
+	return ln.Addr().String()
+}
+
+func TestStreamActive(t *testing.T) {
+	release := make(chan struct{})
+	addr := slowBackend(t, 3, 0, release)
+	p := newTestProxy(t, map[string]Weight{addr: 1}, WithStream(true))
+
+	req := fasthttp.AcquireRequest()
+	res := fasthttp.AcquireResponse()
+	defer fasthttp.ReleaseRequest(req)
+	req.SetRequestURI("/")
+
+	if err := p.do(nil, req, res); err != nil {
+		t.Fatal(err)
+	}
+
+	// the body is still being transferred after do returns
+	if n := p.load(0); n != 1 {
+		t.Fatalf("active %d want 1 while streaming", n)
+	}
+
+	close(release)
+	body, err := io.ReadAll(res.BodyStream())
+	if err != nil || string(body) != "chunk0;chunk1;chunk2;" {
+		t.Fatalf("body %q err %v", body, err)
+	}
+
+	if n := p.load(0); n != 1 {
+		t.Fatalf("active %d want 1 before close", n)
+	}
+
+	fasthttp.ReleaseResponse(res)
+	if n := p.load(0); n != 0 {
+		t.Fatalf("active %d want 0 after close", n)
+	}
+}
+
+func TestStreamIdle(t *testing.T) {
+	// the whole body takes longer than the request timeout but never idles
+	addr := slowBackend(t, 6, 50*time.Millisecond, nil)
+	p := newTestProxy(t, map[string]Weight{addr: 1}, WithStream(true),
+		WithTimeout(150*time.Millisecond), WithIdleTimeout(200*time.Millisecond))
+
+	res := fasthttp.AcquireResponse()
+	defer fasthttp.ReleaseResponse(res)
+	req := fasthttp.AcquireRequest()
+	defer fasthttp.ReleaseRequest(req)
+	req.SetRequestURI("/")
+
+	if err := p.do(nil, req, res); err != nil {
+		t.Fatal(err)
+	}
+	body, err := io.ReadAll(res.BodyStream())
+	if err != nil || strings.Count(string(body), "chunk") != 6 {
+		t.Fatalf("body %q err %v", body, err)
+	}
+
+	// no data within idle cuts the body off
+	release := make(chan struct{})
+	defer close(release)
+	addr = slowBackend(t, 2, 0, release)
+	p = newTestProxy(t, map[string]Weight{addr: 1}, WithStream(true), WithIdleTimeout(100*time.Millisecond))
+
+	res.Reset()
+	if err = p.do(nil, req, res); err != nil {
+		t.Fatal(err)
+	}
+
+	start := time.Now()
+	if _, err = io.ReadAll(res.BodyStream()); err == nil {
+		t.Fatal("want idle timeout")
+	}
+	if d := time.Since(start); d > time.Second {
+		t.Fatalf("idle timeout after %v", d)
+	}
+}
+
+// serve runs the proxy on a local listener.
+func serve(t *testing.T, p *ReverseProxy) string {
+	t.Helper()
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	srv := &fasthttp.Server{Handler: p.ServeHTTP}
+	go func() { _ = srv.Serve(ln) }()
+	t.Cleanup(func() { _ = srv.Shutdown() })
+	return ln.Addr().String()
+}
+
+func TestWebSocketEcho(t *testing.T) {
+	up := websocket.Upgrader{}
+	backend := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		conn, err := up.Upgrade(w, r, nil)
+		if err != nil {
+			return
+		}
+		defer conn.Close()
+		for {
+			mt, data, err := conn.ReadMessage()
+			if err != nil {
+				return
+			}
+			_ = conn.WriteMessage(mt, append([]byte(r.URL.Path+":"), data...))
+		}
+	}))
+	defer backend.Close()
+
+	p := newTestProxy(t, map[string]Weight{strings.TrimPrefix(backend.URL, "http://"): 1})
+	conn, _, err := websocket.DefaultDialer.Dial("ws://"+serve(t, p)+"/echo", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer conn.Close()
+
+	for _, text := range []string{"hello", "world"} {
+		if err = conn.WriteMessage(websocket.TextMessage, []byte(text)); err != nil {
+			t.Fatal(err)
+		}
+		_, data, err := conn.ReadMessage()
+		if err != nil || string(data) != "/echo:"+text {
+			t.Fatalf("echo %q err %v", data, err)
+		}
+	}
+}
+
+func TestWebSocketRefused(t *testing.T) {
+	backend := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		w.Header().Set("X-Reason", "token expired")
+		w.Header().Add("Set-Cookie", "a=1")
+		w.Header().Add("Set-Cookie", "b=2")
+		w.WriteHeader(http.StatusForbidden)
+		_, _ = w.Write([]byte(`{"error":"forbidden"}`))
+	}))
+	defer backend.Close()
+
+	p := newTestProxy(t, map[string]Weight{strings.TrimPrefix(backend.URL, "http://"): 1})
+	_, resp, err := websocket.DefaultDialer.Dial("ws://"+serve(t, p)+"/ws", nil)
+	if !errors.Is(err, websocket.ErrBadHandshake) || resp == nil {
+		t.Fatalf("want bad handshake got %v", err)
+	}
+	defer resp.Body.Close()
+
+	body, _ := io.ReadAll(resp.Body)
+	if resp.StatusCode != http.StatusForbidden || string(body) != `{"error":"forbidden"}` {
+		t.Fatalf("status %d body %q", resp.StatusCode, body)
+	}
+
+	if v := resp.Header.Get("X-Reason"); v != "token expired" {
+		t.Fatalf("X-Reason %q", v)
+	}
+	if v := resp.Header.Get("Content-Type"); v != "application/json" {
+		t.Fatalf("Content-Type %q", v)
+	}
+	if v := resp.Header.Values("Set-Cookie"); len(v) != 2 {
+		t.Fatalf("Set-Cookie %v", v)
+	}
+}
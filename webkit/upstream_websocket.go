@@ -0,0 +1,257 @@
+package webkit
+
+import (
+	"bufio"
+	"bytes"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"net/url"
+	"strings"
+	"sync/atomic"
+	"time"
+
+	"github.com/gorilla/websocket"
+	"github.com/valyala/fasthttp"
+)
+
+// the origin is forwarded and checked by the upstream server
+var wsUpgrader = websocket.Upgrader{
+	CheckOrigin: func(r *http.Request) bool { return true },
+}
+
+// handshake headers generated by websocket.Dialer
+var wsHeaders = []string{
+	"Host",
+	"Sec-Websocket-Key",
+	"Sec-Websocket-Version",
+	"Sec-Websocket-Extensions",
+}
+
+// isWebSocket reports whether the request asks to upgrade to websocket.
+func isWebSocket(ctx *fasthttp.RequestCtx) bool {
+	return ctx.IsGet() && ctx.Request.Header.ConnectionUpgrade() &&
+		strings.EqualFold(string(ctx.Request.Header.Peek(fasthttp.HeaderUpgrade)), "websocket")
+}
+
+// hijackWriter adapts the hijacked connection to http.ResponseWriter for websocket.Upgrader,
+// the handshake error is written back as a plain http response by flush.
+type hijackWriter struct {
+	conn   net.Conn
+	header http.Header
+	code   int
+	body   bytes.Buffer
+}
+
+func (w *hijackWriter) Header() http.Header         { return w.header }
+func (w *hijackWriter) WriteHeader(code int)        { w.code = code }
+func (w *hijackWriter) Write(b []byte) (int, error) { return w.body.Write(b) }
+
+func (w *hijackWriter) Hijack() (net.Conn, *bufio.ReadWriter, error) {
+	return w.conn, bufio.NewReadWriter(bufio.NewReader(w.conn), bufio.NewWriter(w.conn)), nil
+}
+
+func (w *hijackWriter) flush() {
+	if w.code == 0 {
+		return
+	}
+
+	var buf bytes.Buffer
+	fmt.Fprintf(&buf, "HTTP/1.1 %d %s\r\n", w.code, http.StatusText(w.code))
+	w.header.Set("Content-Length", fmt.Sprint(w.body.Len()))
+	w.header.Set("Connection", "close")
+	_ = w.header.Write(&buf)
+	buf.WriteString("\r\n")
+	buf.Write(w.body.Bytes())
+	_, _ = w.conn.Write(buf.Bytes())
+}
+
+// wsRequest copies the handshake of the client for websocket.Upgrader,
+// the hijack handler must not retain references to ctx members.
+func wsRequest(ctx *fasthttp.RequestCtx) *http.Request {
+	r := &http.Request{
+		Method:     string(ctx.Method()),
+		Proto:      "HTTP/1.1",
+		ProtoMajor: 1,
+		ProtoMinor: 1,
+		Header:     make(http.Header),
+		Host:       string(ctx.Host()),
+		RequestURI: string(ctx.RequestURI()),
+		RemoteAddr: ctx.RemoteAddr().String(),
+	}
+	r.URL, _ = url.ParseRequestURI(r.RequestURI)
+
+	ctx.Request.Header.VisitAll(func(k, v []byte) {
+		r.Header.Add(string(k), string(v))
+	})
+	return r
+}
+
+// wsForward returns the headers sent to the upstream server without hop-by-hop and handshake headers.
+func wsForward(r *http.Request) http.Header {
+	header := r.Header.Clone()
+	for _, h := range hopHeaders {
+		header.Del(h)
+	}
+
+	for _, h := range wsHeaders {
+		header.Del(h)
+	}
+	return header
+}
+
+// wsResponse returns the headers of the refused upgrade sent back to the client,
+// the body is read into memory so the length is set by fasthttp.
+func wsResponse(h http.Header) http.Header {
+	header := h.Clone()
+	for _, k := range hopHeaders {
+		header.Del(k)
+	}
+	header.Del("Content-Length")
+	return header
+}
+
+// serveWebSocket dials the upstream server first, then hijacks the connection
+// of the client and relays messages both ways until either side closes.
+func (p *ReverseProxy) serveWebSocket(ctx *fasthttp.RequestCtx, key []byte) {
+	idx, c := p.getClient(key, nil)
+	if c == nil {
+		p.fail(ctx, errNoHealthyUpstream)
+		return
+	}
+	pr := p.peers[idx]
+
+	scheme := "ws"
+	if p.opt.tlsConfig != nil {
+		scheme = "wss"
+	}
+
+	dialer := websocket.Dialer{
+		TLSClientConfig:  p.opt.tlsConfig,
+		HandshakeTimeout: p.opt.timeout,
+	}
+	if dialer.HandshakeTimeout <= 0 {
+		dialer.HandshakeTimeout = websocket.DefaultDialer.HandshakeTimeout
+	}
+
+	r := wsRequest(ctx)
+	backend, resp, err := dialer.Dial(scheme+"://"+c.Addr+r.RequestURI, wsForward(r))
+	if err != nil {
+		if resp != nil && errors.Is(err, websocket.ErrBadHandshake) {
+			// the upstream server refused the upgrade, pass the response through
+			pr.success()
+			body, _ := io.ReadAll(io.LimitReader(resp.Body, 64*1024))
+			_ = resp.Body.Close()
+			for k, values := range wsResponse(resp.Header) {
+				for _, v := range values {
+					ctx.Response.Header.Add(k, v)
+				}
+			}
+			ctx.SetStatusCode(resp.StatusCode)
+			ctx.SetBody(body)
+			return
+		}
+
+		pr.failure(err, p.opt.outlier)
+		p.fail(ctx, err)
+		return
+	}
+	pr.success()
+
+	header := make(http.Header)
+	if proto := backend.Subprotocol(); proto != "" {
+		header.Set("Sec-Websocket-Protocol", proto)
+	}
+	for _, v := range resp.Header.Values("Set-Cookie") {
+		header.Add("Set-Cookie", v)
+	}
+
+	idle := p.opt.idle
+	ctx.HijackSetNoResponse(true)
+	ctx.Hijack(func(conn net.Conn) {
+		atomic.AddInt64(&pr.active, 1)
+		defer atomic.AddInt64(&pr.active, -1)
+
+		w := &hijackWriter{conn: conn, header: make(http.Header)}
+		client, e := wsUpgrader.Upgrade(w, r, header)
+		if e != nil {
+			w.flush()
+			_ = backend.Close()
+			return
+		}
+		wsPipe(client, backend, idle)
+	})
+}
+
+// wsPipe relays messages between the client and the upstream server,
+// idle > 0 closes both when no message is received within idle.
+func wsPipe(client, backend *websocket.Conn, idle time.Duration) {
+	errc := make(chan error, 2)
+	go wsRelay(backend, client, idle, errc)
+	go wsRelay(client, backend, idle, errc)
+
+	// wait for the close handshake of the other side
+	<-errc
+	select {
+	case <-errc:
+	case <-time.After(time.Second):
+	}
+
+	_ = client.Close()
+	_ = backend.Close()
+}
+
+// wsRelay copies messages and control frames from src to dst.
+func wsRelay(dst, src *websocket.Conn, idle time.Duration, errc chan<- error) {
+	refresh := func() {
+		if idle > 0 {
+			_ = src.SetReadDeadline(time.Now().Add(idle))
+			_ = dst.SetWriteDeadline(time.Now().Add(idle))
+		}
+	}
+
+	control := func(mt int) func(string) error {
+		return func(data string) error {
+			refresh()
+			return dst.WriteControl(mt, []byte(data), time.Now().Add(time.Second))
+		}
+	}
+	src.SetPingHandler(control(websocket.PingMessage))
+	src.SetPongHandler(control(websocket.PongMessage))
+	src.SetCloseHandler(func(code int, text string) error {
+		return dst.WriteControl(websocket.CloseMessage, websocket.FormatCloseMessage(code, text), time.Now().Add(time.Second))
+	})
+
+	for {
+		refresh()
+		mt, r, err := src.NextReader()
+		if err != nil {
+			var ce *websocket.CloseError
+			if !errors.As(err, &ce) {
+				msg := websocket.FormatCloseMessage(websocket.CloseGoingAway, "upstream proxy closed")
+				_ = dst.WriteControl(websocket.CloseMessage, msg, time.Now().Add(time.Second))
+			}
+			errc <- err
+			return
+		}
+
+		w, err := dst.NextWriter(mt)
+		if err != nil {
+			errc <- err
+			return
+		}
+
+		if _, err = io.Copy(w, r); err != nil {
+			_ = w.Close()
+			errc <- err
+			return
+		}
+
+		if err = w.Close(); err != nil {
+			errc <- err
+			return
+		}
+	}
+}